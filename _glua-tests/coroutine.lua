@@ -1,17 +1,142 @@
-co = coroutine.wrap(function()
-  co()
-end)
-
-local ok, msg = pcall(function()
-  co()
-end)
-assert(not ok and string.find(msg, "can not resume a running thread"))
-
-co = coroutine.wrap(function()
-  return 1
-end)
-assert(co() == 1)
-local ok, msg = pcall(function()
-  co()
-end)
-assert(not ok and string.find(msg, "can not resume a dead thread"))
+co = coroutine.wrap(function()
+  co()
+end)
+
+local ok, msg = pcall(function()
+  co()
+end)
+assert(not ok and string.find(msg, "can not resume a running thread"))
+
+co = coroutine.wrap(function()
+  return 1
+end)
+assert(co() == 1)
+local ok, msg = pcall(function()
+  co()
+end)
+assert(not ok and string.find(msg, "can not resume a dead thread"))
+
+-- yield across pcall and xpcall
+co = coroutine.wrap(function(a)
+  local ok, b, c = pcall(function(x)
+    local y = coroutine.yield(x + 1)
+    return y * 2, "done"
+  end, a)
+  assert(ok and b == 20 and c == "done")
+  local ok2, msg = pcall(function()
+    coroutine.yield("again")
+    error("boom", 0)
+  end)
+  assert(not ok2 and msg == "boom")
+  local ok3, msg3 = xpcall(function()
+    coroutine.yield("xp")
+    error("inner", 0)
+  end, function(e) return "handled: " .. e end)
+  assert(not ok3 and msg3 == "handled: inner")
+  return "end"
+end)
+assert(co(1) == 2)
+assert(co(10) == "again")
+assert(co() == "xp")
+assert(co() == "end")
+
+co = coroutine.create(function()
+  return pcall(pcall, coroutine.yield, 1)
+end)
+local ok, v = coroutine.resume(co)
+assert(ok and v == 1)
+local ok, a, b, c = coroutine.resume(co, "x")
+assert(ok and a == true and b == true and c == "x")
+assert(coroutine.status(co) == "dead")
+
+-- a Go function tail called after a yield across pcall
+co = coroutine.create(function() local ok, v = pcall(function() coroutine.yield(1); return tostring(42) end); return "done", ok, v end)
+local ok, v = coroutine.resume(co)
+assert(ok and v == 1)
+local ok, a, b, c = coroutine.resume(co)
+assert(ok and a == "done" and b == true and c == "42")
+assert(coroutine.status(co) == "dead")
+
+-- yield inside metamethods and iterators
+local mt = {
+  __index = function(t, k) return coroutine.yield(k) end,
+  __add = function(a, b) return coroutine.yield("add") end,
+  __lt = function(a, b) return coroutine.yield("lt") end,
+  __le = function(a, b) return coroutine.yield("le") end,
+  __newindex = function(t, k, v) coroutine.yield("set " .. k) rawset(t, k, v) end,
+  __concat = function(a, b) return coroutine.yield("concat") end,
+}
+co = coroutine.wrap(function()
+  local obj = setmetatable({}, mt)
+  local r = {}
+  r[1] = obj.key
+  r[2] = obj + 1
+  if obj < obj then r[3] = "lt" end
+  if obj <= obj then r[4] = "le" end
+  obj.name = "n"
+  r[5] = rawget(obj, "name")
+  local sum = 0
+  for i in function(_, i) i = (i or 0) + 1; if i <= 3 then return coroutine.yield(i) end end do
+    sum = sum + i
+  end
+  r[6] = sum
+  r[7] = "a" .. obj .. "b" .. obj
+  return r
+end)
+assert(co() == "key")
+assert(co("v") == "add")
+assert(co(42) == "lt")
+assert(co(true) == "le")
+assert(co(false) == "set name")
+assert(co() == 1)
+assert(co(1) == 2)
+assert(co(2) == 3)
+assert(co(3) == "concat")
+assert(co("c1") == "concat")
+local r = co("c2")
+assert(r[1] == "v" and r[2] == 42 and r[3] == "lt" and r[4] == nil and r[5] == "n" and r[6] == 6 and r[7] == "ac2")
+
+co = coroutine.create(function()
+  local t = setmetatable({}, {__tostring = function() coroutine.yield() return "t" end})
+  return tostring(t)
+end)
+local ok, msg = coroutine.resume(co)
+assert(not ok and string.find(msg, "attempt to yield across metamethod/C-call boundary", 1, true))
+
+-- isyieldable and running
+assert(coroutine.isyieldable() == false)
+local main, ismain = coroutine.running()
+assert(main == nil and ismain == true)
+co = coroutine.create(function()
+  local th, ismain = coroutine.running()
+  assert(type(th) == "thread" and ismain == false)
+  assert(coroutine.isyieldable())
+  local _, y = pcall(coroutine.isyieldable)
+  return y
+end)
+local ok, y = coroutine.resume(co)
+assert(ok and y == true)
+
+-- close
+co = coroutine.create(function()
+  coroutine.yield(1)
+end)
+coroutine.resume(co)
+assert(coroutine.status(co) == "suspended")
+assert(coroutine.close(co) == true)
+assert(coroutine.status(co) == "dead")
+local ok, msg = coroutine.resume(co)
+assert(not ok and string.find(msg, "can not resume a dead thread"))
+co = coroutine.create(function()
+  error("failed", 0)
+end)
+coroutine.resume(co)
+local ok, msg = coroutine.close(co)
+assert(ok == false and msg == "failed")
+assert(coroutine.close(co) == true)
+assert(coroutine.close(coroutine.create(print)) == true)
+co = coroutine.create(function()
+  return coroutine.close(co)
+end)
+local ok, msg = coroutine.resume(co)
+assert(not ok and string.find(msg, "can not close a running coroutine"))
@@ -0,0 +1,55 @@
+local s, e, y, m = re.find("date: 2021-03-04", [[(\d+)-(\d+)]])
+assert(s == 7 and e == 13 and y == "2021" and m == "03")
+assert(re.find("abc", "x") == nil)
+assert(re.find("abcabc", "b", 3) == 5)
+
+assert(re.match("key=value", [[(\w+)=(\w+)]]) == "key")
+assert(select(2, re.match("key=value", [[(\w+)=(\w+)]])) == "value")
+assert(re.match("hello world", [[wor|hel]]) == "hel")
+
+local caps = re.capture("user: alice", [[(?P<field>\w+): (?P<name>\w+)]])
+assert(caps[0] == "user: alice")
+assert(caps.field == "user" and caps[1] == "user")
+assert(caps.name == "alice" and caps[2] == "alice")
+assert(re.capture("nothing", [[\d+]]) == nil)
+
+local words = {}
+for w in re.gmatch("one two  three", [[\w+]]) do
+  table.insert(words, w)
+end
+assert(#words == 3 and words[3] == "three")
+local pairs_ = {}
+for k, v in re.gmatch("a=1,b=2", [[(\w)=(\d)]]) do
+  pairs_[k] = v
+end
+assert(pairs_.a == "1" and pairs_.b == "2")
+
+assert(re.gsub("hello world", [[(\w+)]], "<$1>") == "<hello> <world>")
+assert(re.gsub("hello world", [[(?P<w>\w+)]], "${w}!") == "hello! world!")
+assert(select(2, re.gsub("a b c", [[\w]], "x", 2)) == 2)
+assert(re.gsub("$name is $age", [[\$(\w+)]], {name = "bob", age = 3}) == "bob is 3")
+assert(re.gsub("abc", [[\w]], function(c)
+  if c == "b" then return nil end
+  return c:upper()
+end) == "AbC")
+
+local parts = re.split("a, b,c", [[,\s*]])
+assert(#parts == 3 and parts[1] == "a" and parts[2] == "b" and parts[3] == "c")
+assert(#re.split("a,b,c", ",", 2) == 2)
+assert(re.quote("a.b") == [[a\.b]])
+
+local r = re.compile([[^(\d+)\.(\d+)$]])
+assert(tostring(r) == [[regexp: ^(\d+)\.(\d+)$]])
+assert(r:pattern() == [[^(\d+)\.(\d+)$]])
+assert(r:match("1.25") == "1")
+assert(r:find("3.5") == 1)
+assert(r:gsub("1.5", "$2.$1") == "5.1")
+assert(re.find("10.20", r) == 1)
+local n = 0
+for a in r:gmatch("7.8") do n = n + 1 end
+assert(n == 1)
+
+local bad, msg = re.compile("(")
+assert(bad == nil and string.find(msg, "missing closing"))
+local ok, err = pcall(re.find, "x", "(")
+assert(not ok and string.find(err, "missing closing"))
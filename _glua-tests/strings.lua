@@ -1,13 +1,48 @@
-
-local ok, msg = pcall(function()
-  string.dump()
-end)
-assert(not ok and string.find(msg, "GopherLua does not support the string.dump"))
-assert(string.find("","aaa") == nil)
-assert(string.gsub("hello world", "(%w+)", "%1 %1 %c") == "hello hello %c world world %c")
-
-local ret1, ret2, ret3, ret4 = string.find("aaa bbb", "(%w+())")
-assert(ret1 == 1)
-assert(ret2 == 3)
-assert(ret3 == "aaa")
-assert(ret4 == 4)
+
+local ok, msg = pcall(function()
+  string.dump()
+end)
+assert(not ok and string.find(msg, "GopherLua does not support the string.dump"))
+assert(string.find("","aaa") == nil)
+assert(string.gsub("hello world", "(%w+)", "%1 %1 %c") == "hello hello %c world world %c")
+
+local ret1, ret2, ret3, ret4 = string.find("aaa bbb", "(%w+())")
+assert(ret1 == 1)
+assert(ret2 == 3)
+assert(ret3 == "aaa")
+assert(ret4 == 4)
+
+-- string.pack / string.unpack
+assert(string.packsize("i4") == 4)
+assert(string.packsize("<i2i8") == 10)
+assert(string.packsize("!<i2i8") == 16)
+assert(string.pack(">I2", 0x0102) == "\1\2")
+assert(string.pack("<I2", 0x0102) == "\2\1")
+assert(string.pack("b", -1) == "\255")
+assert(string.unpack("<i2", "\255\255") == -1)
+assert(string.unpack("<I2", "\255\255") == 65535)
+assert(string.unpack("<i16", string.pack("<i16", -3)) == -3)
+
+local packed = string.pack("<i4 z s1 d c3", 100, "hello", "ab", 1.5, "xy")
+local n, z, s, d, c, nextpos = string.unpack("<i4 z s1 d c3", packed)
+assert(n == 100 and z == "hello" and s == "ab" and d == 1.5 and c == "xy\0")
+assert(nextpos == #packed + 1)
+assert(string.unpack("<f", string.pack("<f", 0.5)) == 0.5)
+assert(select(2, string.unpack("B", "\1\2", 2)) == 3)
+
+local ok, msg = pcall(string.pack, "i1", 200)
+assert(not ok and string.find(msg, "integer overflow"))
+ok, msg = pcall(string.unpack, "i4", "\1\2")
+assert(not ok and string.find(msg, "data string too short"))
+ok, msg = pcall(string.unpack, "s1", "\10abc")
+assert(not ok and string.find(msg, "data string too short"))
+ok, msg = pcall(string.unpack, "z", "abc")
+assert(not ok and string.find(msg, "unfinished string"))
+ok, msg = pcall(string.packsize, "s")
+assert(not ok and string.find(msg, "variable%-length format"))
+ok, msg = pcall(string.pack, "i17", 1)
+assert(not ok and string.find(msg, "out of limits"))
+ok, msg = pcall(string.pack, "!3i4", 1)
+assert(not ok and string.find(msg, "not power of 2"))
+ok, msg = pcall(string.pack, "y", 1)
+assert(not ok and string.find(msg, "invalid format option"))
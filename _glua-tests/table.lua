@@ -1,37 +1,59 @@
-local a = {}
-assert(table.maxn(a) == 0)
-a["key"] = 1
-assert(table.maxn(a) == 0)
-table.insert(a, 10)
-table.insert(a, 3, 10)
-assert(table.maxn(a) == 3)
-
-local ok, msg = pcall(function()
-  table.insert(a)
-end)
-assert(not ok and string.find(msg, "wrong number of arguments"))
-
-a = {}
-a["key0"] = "0"
-a["key1"] = "1"
-a[1] = 1
-a[2] = 2
-a[true] = "true"
-a[false] = "false"
-for k, v in pairs(a) do
-  if k == "key0" then
-    assert(v == "0")
-  elseif k == "key1" then
-    assert(v == "1")
-  elseif k == 1 then
-    assert(v == 1)
-  elseif k == 2 then
-    assert(v == 2)
-  elseif k == true then
-    assert(v == "true")
-  elseif k == false then
-    assert(v == "false")
-  else
-    error("unexpected key:" .. tostring(k))
-  end
-end
+local a = {}
+assert(table.maxn(a) == 0)
+a["key"] = 1
+assert(table.maxn(a) == 0)
+table.insert(a, 10)
+table.insert(a, 3, 10)
+assert(table.maxn(a) == 3)
+
+local ok, msg = pcall(function()
+  table.insert(a)
+end)
+assert(not ok and string.find(msg, "wrong number of arguments"))
+
+a = {}
+a["key0"] = "0"
+a["key1"] = "1"
+a[1] = 1
+a[2] = 2
+a[true] = "true"
+a[false] = "false"
+for k, v in pairs(a) do
+  if k == "key0" then
+    assert(v == "0")
+  elseif k == "key1" then
+    assert(v == "1")
+  elseif k == 1 then
+    assert(v == 1)
+  elseif k == 2 then
+    assert(v == 2)
+  elseif k == true then
+    assert(v == "true")
+  elseif k == false then
+    assert(v == "false")
+  else
+    error("unexpected key:" .. tostring(k))
+  end
+end
+
+-- frozen tables
+local conf = table.freeze({name = "app", nested = {port = 80}})
+assert(table.isfrozen(conf) and not table.isfrozen(conf.nested))
+for _, f in ipairs({
+  function() conf.name = "x" end,
+  function() conf.other = 1 end,
+  function() rawset(conf, "name", "x") end,
+  function() table.insert(conf, 1) end,
+  function() table.remove(conf) end,
+  function() setmetatable(conf, {}) end,
+}) do
+  local ok, msg = pcall(f)
+  assert(not ok and string.find(msg, "attempt to modify a frozen table", 1, true))
+end
+conf.nested.port = 81
+assert(conf.nested.port == 81)
+table.freeze(conf.nested, true)
+assert(not pcall(function() conf.nested.port = 82 end))
+local deep = table.freeze({a = {b = {c = {}}}}, true)
+assert(table.isfrozen(deep.a.b.c))
+assert(not pcall(function() deep.a.b.c.d = 1 end))
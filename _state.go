@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/edunx/lua/parse"
 	"io"
+	"io/fs"
 	"math"
 	"os"
 	"runtime"
@@ -25,12 +26,27 @@ type ApiError struct {
 	Type       ApiErrorType
 	Object     LValue
 	StackTrace string
-	// Underlying error. This attribute is set only if the Type is ApiErrorFile or ApiErrorSyntax
+	// Underlying error. This attribute is set if the Type is ApiErrorFile or ApiErrorSyntax, or
+	// if Object is an error object that wraps a Go error (see RaiseErrorWrap).
 	Cause error
+	// Frames of the Lua call stack when the error was raised, innermost first.
+	Frames []StackFrame
+}
+
+// StackFrame is a frame of the call stack of an ApiError.
+type StackFrame struct {
+	// Source is the chunk name of a Lua function, or "[G]" for a Go function.
+	Source string
+	// Line is the current line of a Lua function, or 0 for a Go function.
+	Line int
+	// Column is the current column of a Lua function, or 0 if it is unknown.
+	Column int
+	// Function is the name of the function, as it appears in StackTrace.
+	Function string
 }
 
 func newApiError(code ApiErrorType, object LValue) *ApiError {
-	return &ApiError{code, object, "", nil}
+	return &ApiError{Type: code, Object: object, Cause: goErrorCause(object)}
 }
 
 func newApiErrorS(code ApiErrorType, message string) *ApiError {
@@ -38,14 +54,26 @@ func newApiErrorS(code ApiErrorType, message string) *ApiError {
 }
 
 func newApiErrorE(code ApiErrorType, err error) *ApiError {
-	return &ApiError{code, LString(err.Error()), "", err}
+	return &ApiError{Type: code, Object: LString(err.Error()), Cause: err}
 }
 
 func (e *ApiError) Error() string {
+	msg := errorObjectString(e.Object)
 	if len(e.StackTrace) > 0 {
-		return fmt.Sprintf("%s\n%s", e.Object.String(), e.StackTrace)
+		return fmt.Sprintf("%s\n%s", msg, e.StackTrace)
 	}
-	return e.Object.String()
+	return msg
+}
+
+// Unwrap returns the underlying Go error, so that errors.Is and errors.As can inspect it.
+func (e *ApiError) Unwrap() error {
+	return e.Cause
+}
+
+// setTrace records the call stack of L in the error.
+func (e *ApiError) setTrace(L *LState) {
+	e.StackTrace = L.stackTrace(0)
+	e.Frames = L.stackFrames()
 }
 
 type ApiErrorType int
@@ -104,6 +132,17 @@ type Options struct {
 	// If `MinimizeStackMemory` is set, the call stack will be automatically grown or shrank up to a limit of
 	// `CallStackSize` in order to minimize memory usage. This does incur a slight performance penalty.
 	MinimizeStackMemory bool
+	// Filesystem used by require, LoadFile, DoFile, dofile and loadfile instead of the OS filesystem.
+	// Paths are converted to slash-separated paths relative to the root of FS.
+	FS fs.FS
+	// If `FSForIO` is set, io.open, io.lines and io.input open files from FS as well. Files opened
+	// for writing require FS to implement WritableFS.
+	FSForIO bool
+	// If `Optimize` is set, the chunks loaded by the state are rewritten by Optimize.
+	Optimize bool
+	// Hub used by the hub library. If it is nil, the state creates a hub of its own, so
+	// states only see each other's messages when they are given the same hub.
+	Hub *Hub
 }
 
 /* }}} */
@@ -116,6 +155,7 @@ type Debug struct {
 	What            string
 	Source          string
 	CurrentLine     int
+	CurrentColumn   int
 	NUpvalues       int
 	LineDefined     int
 	LastLineDefined int
@@ -136,6 +176,11 @@ type callFrame struct {
 	NArgs      int
 	NRet       int
 	TailCall   int
+	// Nested is true when the frame was pushed by a Go call into Lua (callR), so that its
+	// caller is a Go function or a VM instruction waiting on the Go stack.
+	Nested bool
+	// Cont finishes a Go function frame whose Go call was unwound by a yield.
+	Cont *continuation
 }
 
 type callFrameStack interface {
@@ -541,6 +586,7 @@ func newGlobal() *Global {
 		Global:     newLTable(0, 64),
 		builtinMts: make(map[int]LValue),
 		tempFiles:  make([]*os.File, 0, 10),
+		reCache:    &reCache{},
 	}
 }
 
@@ -550,7 +596,7 @@ func newGlobal() *Global {
 
 func panicWithTraceback(L *LState) {
 	err := newApiError(ApiErrorRun, L.Get(-1))
-	err.StackTrace = L.stackTrace(0)
+	err.setTrace(L)
 	panic(err)
 }
 
@@ -686,6 +732,9 @@ func (ls *LState) where(level int, skipg bool) string {
 	line := ""
 	if proto != nil {
 		line = fmt.Sprintf("%v:", proto.DbgSourcePositions[cf.Pc-1])
+		if column := proto.column(cf.Pc - 1); column > 0 {
+			line = fmt.Sprintf("%v:%v:", proto.DbgSourcePositions[cf.Pc-1], column)
+		}
 	}
 	return fmt.Sprintf("%v:%v", sourcename, line)
 }
@@ -719,6 +768,30 @@ func (ls *LState) stackTrace(level int) string {
 	return fmt.Sprintf("%s\n%s", header, strings.Join(buf, "\n"))
 }
 
+func (ls *LState) stackFrames() []StackFrame {
+	var frames []StackFrame
+	if ls.currentFrame == nil {
+		return frames
+	}
+	for i := 0; ; i++ {
+		dbg, ok := ls.GetStack(i)
+		if !ok {
+			break
+		}
+		cf := dbg.frame
+		frame := StackFrame{Source: "[G]", Function: ls.rawFrameFuncName(cf)}
+		if proto := cf.Fn.Proto; proto != nil {
+			frame.Source = proto.SourceName
+			if cf.Pc > 0 && cf.Pc <= len(proto.DbgSourcePositions) {
+				frame.Line = proto.DbgSourcePositions[cf.Pc-1]
+				frame.Column = proto.column(cf.Pc - 1)
+			}
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
 func (ls *LState) formattedFrameFuncName(fr *callFrame) string {
 	name, ischunk := ls.frameFuncName(fr)
 	if ischunk {
@@ -1038,13 +1111,16 @@ func (ls *LState) callR(nargs, nret, rbase int) {
 		NRet:       nret,
 		Parent:     ls.currentFrame,
 		TailCall:   0,
+		Nested:     true,
 	}, lv, meta)
 	if ls.G.MainThread == nil {
 		ls.G.MainThread = ls
 		ls.G.CurrentThread = ls
 		ls.mainLoop(ls, nil)
 	} else {
+		ls.nestedCalls++
 		ls.mainLoop(ls, ls.currentFrame)
+		ls.nestedCalls--
 	}
 	if nret != MultRet {
 		ls.reg.SetTop(rbase + nret)
@@ -1151,6 +1227,7 @@ func (ls *LState) setFieldString(obj LValue, key string, value LValue) {
 		tb, istable := curobj.(*LTable)
 		if istable {
 			if tb.RawGetString(key) != LNil {
+				ls.checkFrozen(tb)
 				tb.RawSetString(key, value)
 				return
 			}
@@ -1160,6 +1237,7 @@ func (ls *LState) setFieldString(obj LValue, key string, value LValue) {
 			if !istable {
 				ls.RaiseError("attempt to index a non-table object(%v) with key '%s'", curobj.Type().String(), key)
 			}
+			ls.checkFrozen(tb)
 			tb.RawSetString(key, value)
 			return
 		}
@@ -1527,7 +1605,15 @@ func (ls *LState) RaiseError(format string, args ...interface{}) {
 	ls.raiseError(1, format, args...)
 }
 
+// RaiseErrorWrap raises an error object that wraps err. Lua sees it as a userdata that
+// tostring converts to the message of err, prefixed with the position like RaiseError does,
+// and the ApiError returned to Go unwraps to err.
+func (ls *LState) RaiseErrorWrap(err error) {
+	ls.Error(ls.newGoError(err, ls.where(0, true)), 0)
+}
+
 // This function is equivalent to lua_error( http://www.lua.org/manual/5.1/manual.html#lua_error ).
+// If lv is an error object created by NewError, the ApiError keeps its Go error as Cause.
 func (ls *LState) Error(lv LValue, level int) {
 	if str, ok := lv.(LString); ok {
 		ls.raiseError(level, string(str))
@@ -1575,6 +1661,7 @@ func (ls *LState) GetInfo(what string, dbg *Debug, fn LValue) (LValue, error) {
 			if !f.IsG && dbg.frame != nil {
 				if dbg.frame.Pc > 0 {
 					dbg.CurrentLine = f.Proto.DbgSourcePositions[dbg.frame.Pc-1]
+					dbg.CurrentColumn = f.Proto.column(dbg.frame.Pc - 1)
 				}
 			} else {
 				dbg.CurrentLine = -1
@@ -1715,10 +1802,12 @@ func (ls *LState) RawSet(tb *LTable, key LValue, value LValue) {
 	} else if key == LNil {
 		ls.RaiseError("table index is nil")
 	}
+	ls.checkFrozen(tb)
 	tb.RawSet(key, value)
 }
 
 func (ls *LState) RawSetInt(tb *LTable, key int, value LValue) {
+	ls.checkFrozen(tb)
 	tb.RawSetInt(key, value)
 }
 
@@ -1816,6 +1905,9 @@ func (ls *LState) Load(reader io.Reader, name string) (*LFunction, error) {
 	if err != nil {
 		return nil, newApiErrorE(ApiErrorSyntax, err)
 	}
+	if ls.Options.Optimize {
+		Optimize(proto)
+	}
 	return newLFunctionL(proto, ls.currentEnv(), 0), nil
 }
 
@@ -1827,6 +1919,7 @@ func (ls *LState) PCall(nargs, nret int, errfunc *LFunction) (err error) {
 	err = nil
 	sp := ls.stack.Sp()
 	base := ls.reg.Top() - nargs - 1
+	nested := ls.nestedCalls
 	oldpanic := ls.Panic
 	ls.Panic = panicWithoutTraceback
 	if errfunc != nil {
@@ -1836,13 +1929,19 @@ func (ls *LState) PCall(nargs, nret int, errfunc *LFunction) (err error) {
 		ls.Panic = oldpanic
 		ls.hasErrorFunc = false
 		rcv := recover()
+		if _, ok := rcv.(yieldUnwind); ok {
+			// the coroutine yielded, the protected call is finished by its continuation
+			panic(rcv)
+		}
 		if rcv != nil {
+			ls.nestedCalls = nested
 			if _, ok := rcv.(*ApiError); !ok {
 				err = newApiErrorS(ApiErrorPanic, fmt.Sprint(rcv))
 				if ls.Options.IncludeGoStackTrace {
 					buf := make([]byte, 4096)
 					runtime.Stack(buf, false)
 					err.(*ApiError).StackTrace = strings.Trim(string(buf), "\000") + "\n" + ls.stackTrace(0)
+					err.(*ApiError).Frames = ls.stackFrames()
 				}
 			} else {
 				err = rcv.(*ApiError)
@@ -1861,17 +1960,18 @@ func (ls *LState) PCall(nargs, nret int, errfunc *LFunction) (err error) {
 								buf := make([]byte, 4096)
 								runtime.Stack(buf, false)
 								err.(*ApiError).StackTrace = strings.Trim(string(buf), "\000") + ls.stackTrace(0)
+								err.(*ApiError).Frames = ls.stackFrames()
 							}
 						} else {
 							err = rcv.(*ApiError)
-							err.(*ApiError).StackTrace = ls.stackTrace(0)
+							err.(*ApiError).setTrace(ls)
 						}
 					}
 				}()
 				ls.Call(1, 1)
 				err = newApiError(ApiErrorError, ls.Get(-1))
 			} else if len(err.(*ApiError).StackTrace) == 0 {
-				err.(*ApiError).StackTrace = ls.stackTrace(0)
+				err.(*ApiError).setTrace(ls)
 			}
 			ls.stack.SetSp(sp)
 			ls.currentFrame = ls.stack.Last()
@@ -1924,6 +2024,7 @@ func (ls *LState) SetMetatable(obj LValue, mt LValue) {
 
 	switch v := obj.(type) {
 	case *LTable:
+		ls.checkFrozen(v)
 		v.Metatable = mt
 	case *LUserData:
 		v.Metatable = mt
@@ -2016,6 +2117,16 @@ func (ls *LState) Yield(values ...LValue) int {
 	return -1
 }
 
+// YieldK yields values like Yield, but the thread continues with k when it is resumed, instead
+// of returning the values passed to resume to the caller of the Go function. k may yield again
+// with Yield or YieldK. YieldK must be used as the return value of an LGFunction:
+//
+//	return L.YieldK(k, values...)
+func (ls *LState) YieldK(k ContinuationFunc, values ...LValue) int {
+	ls.yieldK = k
+	return ls.Yield(values...)
+}
+
 func (ls *LState) XMoveTo(other *LState, n int) {
 	if ls == other {
 		return
@@ -2086,8 +2197,10 @@ func (ls *LState) RemoveCallerFrame() *callFrame {
 	parentFrame := cs.At(sp - 2)
 	currentFrame := cs.At(sp - 1)
 	parentsParentFrame := parentFrame.Parent
+	nested := parentFrame.Nested
 	*parentFrame = *currentFrame
 	parentFrame.Parent = parentsParentFrame
+	parentFrame.Nested = nested
 	parentFrame.Idx = sp - 2
 	cs.Pop()
 	return parentFrame
@@ -1,29 +1,54 @@
-package ast
-
-type PositionHolder interface {
-	Line() int
-	SetLine(int)
-	LastLine() int
-	SetLastLine(int)
-}
-
-type Node struct {
-	line     int
-	lastline int
-}
-
-func (self *Node) Line() int {
-	return self.line
-}
-
-func (self *Node) SetLine(line int) {
-	self.line = line
-}
-
-func (self *Node) LastLine() int {
-	return self.lastline
-}
-
-func (self *Node) SetLastLine(line int) {
-	self.lastline = line
-}
+package ast
+
+// PositionHolder is a node spanning the source from (Line, Column) to (LastLine,
+// LastColumn). Columns are 1-based, and the last column is the column of the last
+// character of the node. A zero line or column is unknown.
+type PositionHolder interface {
+	Line() int
+	SetLine(int)
+	LastLine() int
+	SetLastLine(int)
+	Column() int
+	SetColumn(int)
+	LastColumn() int
+	SetLastColumn(int)
+}
+
+type Node struct {
+	line       int
+	lastline   int
+	column     int
+	lastcolumn int
+}
+
+func (self *Node) Line() int {
+	return self.line
+}
+
+func (self *Node) SetLine(line int) {
+	self.line = line
+}
+
+func (self *Node) LastLine() int {
+	return self.lastline
+}
+
+func (self *Node) SetLastLine(line int) {
+	self.lastline = line
+}
+
+func (self *Node) Column() int {
+	return self.column
+}
+
+func (self *Node) SetColumn(column int) {
+	self.column = column
+}
+
+func (self *Node) LastColumn() int {
+	return self.lastcolumn
+}
+
+func (self *Node) SetLastColumn(column int) {
+	self.lastcolumn = column
+}
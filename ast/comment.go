@@ -0,0 +1,25 @@
+package ast
+
+// Comment is a comment of the source, including its leading "--". Line and LastLine are the
+// first and the last line of the comment.
+type Comment struct {
+	Node
+
+	Text string
+	// Inline reports whether the comment follows a token on its first line.
+	Inline bool
+	// EmptyLineBefore reports whether the line before the comment is empty.
+	EmptyLineBefore bool
+}
+
+// Comments holds the comments attached to a statement by a parser that keeps comments.
+type Comments struct {
+	// Leading comments are on the lines before the statement.
+	Leading []*Comment
+	// Trailing comments follow the statement on its first or last line. The comments after the
+	// last statement of a block are trailing comments of that statement, and the comments of
+	// an empty block are trailing comments of the statement that holds the block.
+	Trailing []*Comment
+	// EmptyLineBefore reports whether the line before the statement is empty.
+	EmptyLineBefore bool
+}
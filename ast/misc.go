@@ -1,17 +1,19 @@
-package ast
-
-type Field struct {
-	Key   Expr
-	Value Expr
-}
-
-type ParList struct {
-	HasVargs bool
-	Names    []string
-}
-
-type FuncName struct {
-	Func     Expr
-	Receiver Expr
-	Method   string
-}
+package ast
+
+type Field struct {
+	Key   Expr
+	Value Expr
+}
+
+type ParList struct {
+	HasVargs bool
+	Names    []string
+	// NamePos holds the positions of Names.
+	NamePos []Position
+}
+
+type FuncName struct {
+	Func     Expr
+	Receiver Expr
+	Method   string
+}
@@ -1,95 +1,122 @@
-package ast
-
-type Stmt interface {
-	PositionHolder
-	stmtMarker()
-}
-
-type StmtBase struct {
-	Node
-}
-
-func (stmt *StmtBase) stmtMarker() {}
-
-type AssignStmt struct {
-	StmtBase
-
-	Lhs []Expr
-	Rhs []Expr
-}
-
-type LocalAssignStmt struct {
-	StmtBase
-
-	Names []string
-	Exprs []Expr
-}
-
-type FuncCallStmt struct {
-	StmtBase
-
-	Expr Expr
-}
-
-type DoBlockStmt struct {
-	StmtBase
-
-	Stmts []Stmt
-}
-
-type WhileStmt struct {
-	StmtBase
-
-	Condition Expr
-	Stmts     []Stmt
-}
-
-type RepeatStmt struct {
-	StmtBase
-
-	Condition Expr
-	Stmts     []Stmt
-}
-
-type IfStmt struct {
-	StmtBase
-
-	Condition Expr
-	Then      []Stmt
-	Else      []Stmt
-}
-
-type NumberForStmt struct {
-	StmtBase
-
-	Name  string
-	Init  Expr
-	Limit Expr
-	Step  Expr
-	Stmts []Stmt
-}
-
-type GenericForStmt struct {
-	StmtBase
-
-	Names []string
-	Exprs []Expr
-	Stmts []Stmt
-}
-
-type FuncDefStmt struct {
-	StmtBase
-
-	Name *FuncName
-	Func *FunctionExpr
-}
-
-type ReturnStmt struct {
-	StmtBase
-
-	Exprs []Expr
-}
-
-type BreakStmt struct {
-	StmtBase
-}
+package ast
+
+type Stmt interface {
+	PositionHolder
+	Comments() *Comments
+	stmtMarker()
+}
+
+type StmtBase struct {
+	Node
+
+	comments Comments
+}
+
+func (stmt *StmtBase) stmtMarker() {}
+
+// Comments returns the comments attached to the statement.
+func (stmt *StmtBase) Comments() *Comments { return &stmt.comments }
+
+type AssignStmt struct {
+	StmtBase
+
+	Lhs []Expr
+	Rhs []Expr
+}
+
+type LocalAssignStmt struct {
+	StmtBase
+
+	Names []string
+	// NamePos holds the positions of Names.
+	NamePos []Position
+	Exprs   []Expr
+}
+
+type FuncCallStmt struct {
+	StmtBase
+
+	Expr Expr
+}
+
+type DoBlockStmt struct {
+	StmtBase
+
+	Stmts []Stmt
+}
+
+type WhileStmt struct {
+	StmtBase
+
+	Condition Expr
+	Stmts     []Stmt
+}
+
+type RepeatStmt struct {
+	StmtBase
+
+	Condition Expr
+	Stmts     []Stmt
+}
+
+type IfStmt struct {
+	StmtBase
+
+	Condition Expr
+	Then      []Stmt
+	Else      []Stmt
+	// ElseLine is the line of the else keyword, or 0 if there is no else part.
+	ElseLine int
+}
+
+// ElseIf returns the if statement of the elseif part following the then part of s, or nil if
+// there is none. The parser builds an elseif part as an else part holding a single if
+// statement that ends where s ends.
+func (s *IfStmt) ElseIf() *IfStmt {
+	if len(s.Else) != 1 {
+		return nil
+	}
+	elseif, ok := s.Else[0].(*IfStmt)
+	if !ok || elseif.LastLine() != s.LastLine() || elseif.LastColumn() != s.LastColumn() {
+		return nil
+	}
+	return elseif
+}
+
+type NumberForStmt struct {
+	StmtBase
+
+	Name    string
+	NamePos Position
+	Init    Expr
+	Limit   Expr
+	Step    Expr
+	Stmts   []Stmt
+}
+
+type GenericForStmt struct {
+	StmtBase
+
+	Names []string
+	// NamePos holds the positions of Names.
+	NamePos []Position
+	Exprs   []Expr
+	Stmts   []Stmt
+}
+
+type FuncDefStmt struct {
+	StmtBase
+
+	Name *FuncName
+	Func *FunctionExpr
+}
+
+type ReturnStmt struct {
+	StmtBase
+
+	Exprs []Expr
+}
+
+type BreakStmt struct {
+	StmtBase
+}
@@ -1,22 +1,24 @@
-package ast
-
-import (
-	"fmt"
-)
-
-type Position struct {
-	Source string
-	Line   int
-	Column int
-}
-
-type Token struct {
-	Type int
-	Name string
-	Str  string
-	Pos  Position
-}
-
-func (self *Token) String() string {
-	return fmt.Sprintf("<type:%v, str:%v>", self.Name, self.Str)
-}
+package ast
+
+import (
+	"fmt"
+)
+
+type Position struct {
+	Source string
+	Line   int
+	Column int
+}
+
+type Token struct {
+	Type int
+	Name string
+	Str  string
+	Pos  Position
+	// End is the position of the last character of the token.
+	End Position
+}
+
+func (self *Token) String() string {
+	return fmt.Sprintf("<type:%v, str:%v>", self.Name, self.Str)
+}
@@ -0,0 +1,167 @@
+package ast
+
+// Visitor is called by Walk for each node. A node is a Stmt, an Expr, a *Field, a *FuncName
+// or a *ParList. If Visit returns a non-nil visitor w, Walk visits the children of the node
+// with w, then calls w.Visit(nil).
+type Visitor interface {
+	Visit(node interface{}) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first order. node may be a node or a chunk ([]Stmt), in
+// which case each statement of the chunk is walked in turn.
+func Walk(v Visitor, node interface{}) {
+	if stmts, ok := node.([]Stmt); ok {
+		walkStmts(v, stmts)
+		return
+	}
+	if isNilNode(node) {
+		return
+	}
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	// statements
+	case *AssignStmt:
+		walkExprs(v, n.Lhs)
+		walkExprs(v, n.Rhs)
+	case *LocalAssignStmt:
+		walkExprs(v, n.Exprs)
+	case *FuncCallStmt:
+		Walk(v, n.Expr)
+	case *DoBlockStmt:
+		walkStmts(v, n.Stmts)
+	case *WhileStmt:
+		Walk(v, n.Condition)
+		walkStmts(v, n.Stmts)
+	case *RepeatStmt:
+		walkStmts(v, n.Stmts)
+		Walk(v, n.Condition)
+	case *IfStmt:
+		Walk(v, n.Condition)
+		walkStmts(v, n.Then)
+		walkStmts(v, n.Else)
+	case *NumberForStmt:
+		Walk(v, n.Init)
+		Walk(v, n.Limit)
+		Walk(v, n.Step)
+		walkStmts(v, n.Stmts)
+	case *GenericForStmt:
+		walkExprs(v, n.Exprs)
+		walkStmts(v, n.Stmts)
+	case *FuncDefStmt:
+		Walk(v, n.Name)
+		Walk(v, n.Func)
+	case *ReturnStmt:
+		walkExprs(v, n.Exprs)
+	case *BreakStmt:
+
+	// expressions
+	case *TrueExpr, *FalseExpr, *NilExpr, *NumberExpr, *StringExpr, *Comma3Expr, *IdentExpr:
+	case *AttrGetExpr:
+		Walk(v, n.Object)
+		Walk(v, n.Key)
+	case *TableExpr:
+		for _, field := range n.Fields {
+			Walk(v, field)
+		}
+	case *FuncCallExpr:
+		Walk(v, n.Func)
+		Walk(v, n.Receiver)
+		walkExprs(v, n.Args)
+	case *LogicalOpExpr:
+		Walk(v, n.Lhs)
+		Walk(v, n.Rhs)
+	case *RelationalOpExpr:
+		Walk(v, n.Lhs)
+		Walk(v, n.Rhs)
+	case *StringConcatOpExpr:
+		Walk(v, n.Lhs)
+		Walk(v, n.Rhs)
+	case *ArithmeticOpExpr:
+		Walk(v, n.Lhs)
+		Walk(v, n.Rhs)
+	case *UnaryMinusOpExpr:
+		Walk(v, n.Expr)
+	case *UnaryNotOpExpr:
+		Walk(v, n.Expr)
+	case *UnaryLenOpExpr:
+		Walk(v, n.Expr)
+	case *FunctionExpr:
+		Walk(v, n.ParList)
+		walkStmts(v, n.Stmts)
+
+	// misc
+	case *Field:
+		Walk(v, n.Key)
+		Walk(v, n.Value)
+	case *FuncName:
+		Walk(v, n.Func)
+		Walk(v, n.Receiver)
+	case *ParList:
+	}
+	v.Visit(nil)
+}
+
+func walkStmts(v Visitor, stmts []Stmt) {
+	for _, stmt := range stmts {
+		Walk(v, stmt)
+	}
+}
+
+func walkExprs(v Visitor, exprs []Expr) {
+	for _, expr := range exprs {
+		Walk(v, expr)
+	}
+}
+
+// isNilNode reports whether node is nil, or a nil pointer held by an interface.
+func isNilNode(node interface{}) bool {
+	switch n := node.(type) {
+	case nil:
+		return true
+	case *Field:
+		return n == nil
+	case *FuncName:
+		return n == nil
+	case *ParList:
+		return n == nil
+	case *FunctionExpr:
+		return n == nil
+	}
+	return false
+}
+
+type inspector func(interface{}) bool
+
+func (f inspector) Visit(node interface{}) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order: it calls f(node) and, if f returns true,
+// inspects the children of node, then calls f(nil).
+func Inspect(node interface{}, f func(interface{}) bool) {
+	Walk(inspector(f), node)
+}
+
+// EndLine returns the last line known to be covered by node, that is the greatest Line or
+// LastLine of the node and its children.
+func EndLine(node interface{}) int {
+	line := 0
+	Inspect(node, func(n interface{}) bool {
+		if h, ok := n.(PositionHolder); ok {
+			if h.Line() > line {
+				line = h.Line()
+			}
+			if h.LastLine() > line {
+				line = h.LastLine()
+			}
+		}
+		return true
+	})
+	return line
+}
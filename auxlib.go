@@ -345,6 +345,43 @@ func (ls *LState) FindTable(obj *LTable, n string, size int) LValue {
 	return curobj
 }
 
+// Freeze makes tb read-only: setting a field, rawset, table.insert and setmetatable on
+// it raise an error. If deep is true, the tables reachable from tb through keys, values
+// and metatables are frozen as well.
+func (ls *LState) Freeze(tb *LTable, deep bool) {
+	if !deep {
+		tb.frozen = true
+		return
+	}
+	pending := []*LTable{tb}
+	seen := map[*LTable]bool{}
+	push := func(lv LValue) {
+		if t, ok := lv.(*LTable); ok && !seen[t] {
+			pending = append(pending, t)
+		}
+	}
+	for len(pending) > 0 {
+		t := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		t.frozen = true
+		push(t.Metatable)
+		t.ForEach(func(key, value LValue) {
+			push(key)
+			push(value)
+		})
+	}
+}
+
+func (ls *LState) checkFrozen(tb *LTable) {
+	if tb.frozen {
+		ls.RaiseError(ErrFrozenTable.Error())
+	}
+}
+
 /* }}} */
 
 /* register operations {{{ */
@@ -385,6 +422,7 @@ func (ls *LState) NewTypeMetatable(typ string) *LTable {
 		return tb
 	}
 	mtnew := ls.NewTable()
+	mtnew.RawSetString("__name", LString(typ))
 	ls.SetField(regtable, typ, mtnew)
 	return mtnew
 }
@@ -412,17 +450,19 @@ func (ls *LState) CallMeta(obj LValue, event string) LValue {
 
 /* load and function call operations {{{ */
 
+// LoadFile loads the file path from Options.FS, or from the OS filesystem if FS is nil. An
+// empty path loads the standard input.
 func (ls *LState) LoadFile(path string) (*LFunction, error) {
-	var file *os.File
-	var err error
+	var file io.Reader
 	if len(path) == 0 {
 		file = os.Stdin
 	} else {
-		file, err = os.Open(path)
-		defer file.Close()
+		f, err := ls.openFS(path, os.O_RDONLY, 0)
 		if err != nil {
 			return nil, newApiErrorE(ApiErrorFile, err)
 		}
+		defer f.Close()
+		file = f
 	}
 
 	reader := bufio.NewReader(file)
@@ -500,6 +540,27 @@ func (ls *LState) PreloadModule(name string, loader LGFunction) {
 	ls.SetField(preload, name, ls.NewFunction(loader))
 }
 
+// AddSearcher appends a searcher to package.searchers. require calls each searcher in order
+// with the module name; a searcher returns a loader function and an extra value passed to it,
+// or a string that explains why it did not find the module.
+func (ls *LState) AddSearcher(searcher LGFunction) {
+	ls.InsertSearcher(0, searcher)
+}
+
+// InsertSearcher inserts a searcher at position pos of package.searchers, so that it is
+// called before the searchers that follow. A pos out of range appends the searcher.
+func (ls *LState) InsertSearcher(pos int, searcher LGFunction) {
+	searchers, ok := ls.GetField(ls.Get(RegistryIndex), "_LOADERS").(*LTable)
+	if !ok {
+		ls.RaiseError("package.searchers must be a table")
+	}
+	if pos < 1 || pos > searchers.Len() {
+		searchers.Append(ls.NewFunction(searcher))
+	} else {
+		searchers.Insert(pos, ls.NewFunction(searcher))
+	}
+}
+
 // Checks whether the given index is an LChannel and returns this channel.
 func (ls *LState) CheckChannel(n int) chan LValue {
 	v := ls.Get(n)
@@ -198,19 +198,19 @@ func baseLoad(L *LState) int {
 func baseLoadFile(L *LState) int {
 	var reader io.Reader
 	var chunkname string
-	var err error
 	if L.GetTop() < 1 {
 		reader = os.Stdin
 		chunkname = "<stdin>"
 	} else {
 		chunkname = L.CheckString(1)
-		reader, err = os.Open(chunkname)
+		file, err := L.openFS(chunkname, os.O_RDONLY, 0)
 		if err != nil {
 			L.Push(LNil)
 			L.Push(LString(fmt.Sprintf("can not open file: %v", chunkname)))
 			return 2
 		}
-		defer reader.(*os.File).Close()
+		defer file.Close()
+		reader = file
 	}
 	return loadaux(L, reader, chunkname)
 }
@@ -266,6 +266,7 @@ func basePCall(L *LState) int {
 		return 2
 	}
 	nargs := L.GetTop() - 1
+	L.currentFrame.Cont = pcallCont
 	if err := L.PCall(nargs, MultRet, nil); err != nil {
 		L.Push(LFalse)
 		if aerr, ok := err.(*ApiError); ok {
@@ -275,11 +276,19 @@ func basePCall(L *LState) int {
 		}
 		return 2
 	} else {
-		L.Insert(LTrue, 1)
-		return L.GetTop()
+		return basePCallK(L)
 	}
 }
 
+// pcallCont and xpcallCont finish pcall and xpcall when the protected function yields.
+var pcallCont = &continuation{k: basePCallK, protected: true}
+var xpcallCont = &continuation{k: baseXPCallK, protected: true, errfunc: 2, base: 2}
+
+func basePCallK(L *LState) int {
+	L.Insert(LTrue, 1)
+	return L.GetTop()
+}
+
 func basePrint(L *LState) int {
 	top := L.GetTop()
 	for i := 1; i <= top; i++ {
@@ -456,8 +465,9 @@ func baseXPCall(L *LState) int {
 	fn := L.CheckFunction(1)
 	errfunc := L.CheckFunction(2)
 
-	top := L.GetTop()
+	L.SetTop(2)
 	L.Push(fn)
+	L.currentFrame.Cont = xpcallCont
 	if err := L.PCall(0, MultRet, errfunc); err != nil {
 		L.Push(LFalse)
 		if aerr, ok := err.(*ApiError); ok {
@@ -467,11 +477,15 @@ func baseXPCall(L *LState) int {
 		}
 		return 2
 	} else {
-		L.Insert(LTrue, top+1)
-		return L.GetTop() - top
+		return baseXPCallK(L)
 	}
 }
 
+func baseXPCallK(L *LState) int {
+	L.Insert(LTrue, 3)
+	return L.GetTop() - 2
+}
+
 /* }}} */
 
 /* load lib {{{ */
@@ -518,45 +532,52 @@ func loModule(L *LState) int {
 
 var loopdetection = &LUserData{}
 
-func loRequire(L *LState) int {
-	name := L.CheckString(1)
-	loaded := L.GetField(L.Get(RegistryIndex), "_LOADED")
-	lv := L.GetField(loaded, name)
-	if LVAsBool(lv) {
-		if lv == loopdetection {
-			L.RaiseError("loop or previous error loading module: %s", name)
-		}
-		L.Push(lv)
-		return 1
-	}
+// loFindLoader calls the searchers of package.searchers in order and returns the loader found
+// for the module and the extra value to pass to it. It raises an error that gathers the
+// messages of the searchers if none finds the module.
+func loFindLoader(L *LState, name string) (LValue, LValue) {
 	loaders, ok := L.GetField(L.Get(RegistryIndex), "_LOADERS").(*LTable)
 	if !ok {
 		L.RaiseError("package.loaders must be a table")
 	}
 	messages := []string{}
-	var modasfunc LValue
 	for i := 1; ; i++ {
 		loader := L.RawGetInt(loaders, i)
 		if loader == LNil {
-			L.RaiseError("module %s not found:\n\t%s, ", name, strings.Join(messages, "\n\t"))
+			L.RaiseError("module %s not found:\n\t%s", name, strings.Join(messages, "\n\t"))
 		}
 		L.Push(loader)
 		L.Push(LString(name))
-		L.Call(1, 1)
+		L.Call(1, 2)
+		extra := L.reg.Pop()
 		ret := L.reg.Pop()
 		switch retv := ret.(type) {
 		case *LFunction:
-			modasfunc = retv
-			goto loopbreak
+			return retv, extra
 		case LString:
-			messages = append(messages, string(retv))
+			messages = append(messages, strings.TrimLeft(string(retv), "\n\t"))
 		}
 	}
-loopbreak:
+}
+
+func loRequire(L *LState) int {
+	name := L.CheckString(1)
+	loaded := L.GetField(L.Get(RegistryIndex), "_LOADED")
+	lv := L.GetField(loaded, name)
+	if LVAsBool(lv) {
+		if lv == loopdetection {
+			L.RaiseError("loop or previous error loading module: %s", name)
+		}
+		L.Push(lv)
+		return 1
+	}
+	loader, extra := loFindLoader(L, name)
 	L.SetField(loaded, name, loopdetection)
-	L.Push(modasfunc)
+	L.Push(loader)
 	L.Push(LString(name))
-	L.Call(1, 1)
+	L.Push(extra)
+	L.Call(2, 1)
+	loRecordFile(L, name, extra)
 	ret := L.reg.Pop()
 	modv := L.GetField(loaded, name)
 	if ret != LNil && modv == loopdetection {
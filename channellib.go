@@ -1,184 +1,293 @@
-package lua
-
-import (
-	"reflect"
-)
-
-func checkChannel(L *LState, idx int) reflect.Value {
-	ch := L.CheckChannel(idx)
-	return reflect.ValueOf(ch)
-}
-
-func checkGoroutineSafe(L *LState, idx int) LValue {
-	v := L.CheckAny(2)
-	if !isGoroutineSafe(v) {
-		L.ArgError(2, "can not send a function, userdata, thread or table that has a metatable")
-	}
-	return v
-}
-
-func OpenChannel(L *LState) int {
-	var mod LValue
-	//_, ok := L.G.builtinMts[int(LTChannel)]
-	//	if !ok {
-	mod = L.RegisterModule(ChannelLibName, channelFuncs)
-	mt := L.SetFuncs(L.NewTable(), channelMethods)
-	mt.RawSetString("__index", mt)
-	L.G.builtinMts[int(LTChannel)] = mt
-	//	}
-	L.Push(mod)
-	return 1
-}
-
-var channelFuncs = map[string]LGFunction{
-	"make":   channelMake,
-	"select": channelSelect,
-}
-
-func channelMake(L *LState) int {
-	buffer := L.OptInt(1, 0)
-	L.Push(LChannel(make(chan LValue, buffer)))
-	return 1
-}
-
-func channelSelect(L *LState) int {
-	//TODO check case table size
-	cases := make([]reflect.SelectCase, L.GetTop())
-	top := L.GetTop()
-	for i := 0; i < top; i++ {
-		cas := reflect.SelectCase{
-			Dir:  reflect.SelectSend,
-			Chan: reflect.ValueOf(nil),
-			Send: reflect.ValueOf(nil),
-		}
-		tbl := L.CheckTable(i + 1)
-		dir, ok1 := tbl.RawGetInt(1).(LString)
-		if !ok1 {
-			L.ArgError(i+1, "invalid select case")
-		}
-		switch string(dir) {
-		case "<-|":
-			ch, ok := tbl.RawGetInt(2).(LChannel)
-			if !ok {
-				L.ArgError(i+1, "invalid select case")
-			}
-			cas.Chan = reflect.ValueOf((chan LValue)(ch))
-			v := tbl.RawGetInt(3)
-			if !isGoroutineSafe(v) {
-				L.ArgError(i+1, "can not send a function, userdata, thread or table that has a metatable")
-			}
-			cas.Send = reflect.ValueOf(v)
-		case "|<-":
-			ch, ok := tbl.RawGetInt(2).(LChannel)
-			if !ok {
-				L.ArgError(i+1, "invalid select case")
-			}
-			cas.Chan = reflect.ValueOf((chan LValue)(ch))
-			cas.Dir = reflect.SelectRecv
-		case "default":
-			cas.Dir = reflect.SelectDefault
-		default:
-			L.ArgError(i+1, "invalid channel direction:"+string(dir))
-		}
-		cases[i] = cas
-	}
-
-	if L.ctx != nil {
-		cases = append(cases, reflect.SelectCase{
-			Dir:  reflect.SelectRecv,
-			Chan: reflect.ValueOf(L.ctx.Done()),
-			Send: reflect.ValueOf(nil),
-		})
-	}
-
-	pos, recv, rok := reflect.Select(cases)
-
-	if L.ctx != nil && pos == L.GetTop() {
-		return 0
-	}
-
-	lv := LNil
-	if recv.Kind() != 0 {
-		lv, _ = recv.Interface().(LValue)
-		if lv == nil {
-			lv = LNil
-		}
-	}
-	tbl := L.Get(pos + 1).(*LTable)
-	last := tbl.RawGetInt(tbl.Len())
-	if last.Type() == LTFunction {
-		L.Push(last)
-		switch cases[pos].Dir {
-		case reflect.SelectRecv:
-			if rok {
-				L.Push(LTrue)
-			} else {
-				L.Push(LFalse)
-			}
-			L.Push(lv)
-			L.Call(2, 0)
-		case reflect.SelectSend:
-			L.Push(tbl.RawGetInt(3))
-			L.Call(1, 0)
-		case reflect.SelectDefault:
-			L.Call(0, 0)
-		}
-	}
-	L.Push(LNumber(pos + 1))
-	L.Push(lv)
-	if rok {
-		L.Push(LTrue)
-	} else {
-		L.Push(LFalse)
-	}
-	return 3
-}
-
-var channelMethods = map[string]LGFunction{
-	"receive": channelReceive,
-	"send":    channelSend,
-	"close":   channelClose,
-}
-
-func channelReceive(L *LState) int {
-	rch := checkChannel(L, 1)
-	var v reflect.Value
-	var ok bool
-	if L.ctx != nil {
-		cases := []reflect.SelectCase{{
-			Dir:  reflect.SelectRecv,
-			Chan: reflect.ValueOf(L.ctx.Done()),
-			Send: reflect.ValueOf(nil),
-		}, {
-			Dir:  reflect.SelectRecv,
-			Chan: rch,
-			Send: reflect.ValueOf(nil),
-		}}
-		_, v, ok = reflect.Select(cases)
-	} else {
-		v, ok = rch.Recv()
-	}
-	if ok {
-		L.Push(LTrue)
-		L.Push(v.Interface().(LValue))
-	} else {
-		L.Push(LFalse)
-		L.Push(LNil)
-	}
-	return 2
-}
-
-func channelSend(L *LState) int {
-	rch := checkChannel(L, 1)
-	v := checkGoroutineSafe(L, 2)
-	rch.Send(reflect.ValueOf(v))
-	return 0
-}
-
-func channelClose(L *LState) int {
-	rch := checkChannel(L, 1)
-	rch.Close()
-	return 0
-}
-
-//
+package lua
+
+import (
+	"reflect"
+	"time"
+)
+
+func checkChannel(L *LState, idx int) reflect.Value {
+	ch := L.CheckChannel(idx)
+	return reflect.ValueOf(ch)
+}
+
+func checkGoroutineSafe(L *LState, idx int) LValue {
+	v := L.CheckAny(2)
+	if !isGoroutineSafe(v) {
+		L.ArgError(2, "can not send a function, userdata, thread or table that has a metatable")
+	}
+	return v
+}
+
+func OpenChannel(L *LState) int {
+	var mod LValue
+	//_, ok := L.G.builtinMts[int(LTChannel)]
+	//	if !ok {
+	mod = L.RegisterModule(ChannelLibName, channelFuncs)
+	mt := L.SetFuncs(L.NewTable(), channelMethods)
+	mt.RawSetString("__index", mt)
+	L.G.builtinMts[int(LTChannel)] = mt
+	//	}
+	L.Push(mod)
+	return 1
+}
+
+var channelFuncs = map[string]LGFunction{
+	"make":   channelMake,
+	"select": channelSelect,
+}
+
+func channelMake(L *LState) int {
+	buffer := L.OptInt(1, 0)
+	L.Push(LChannel(make(chan LValue, buffer)))
+	return 1
+}
+
+func channelSelect(L *LState) int {
+	//TODO check case table size
+	cases := make([]reflect.SelectCase, L.GetTop())
+	timeouts := make([]bool, L.GetTop())
+	top := L.GetTop()
+	for i := 0; i < top; i++ {
+		cas := reflect.SelectCase{
+			Dir:  reflect.SelectSend,
+			Chan: reflect.ValueOf(nil),
+			Send: reflect.ValueOf(nil),
+		}
+		tbl := L.CheckTable(i + 1)
+		dir, ok1 := tbl.RawGetInt(1).(LString)
+		if !ok1 {
+			L.ArgError(i+1, "invalid select case")
+		}
+		switch string(dir) {
+		case "<-|":
+			ch, ok := tbl.RawGetInt(2).(LChannel)
+			if !ok {
+				L.ArgError(i+1, "invalid select case")
+			}
+			cas.Chan = reflect.ValueOf((chan LValue)(ch))
+			v := tbl.RawGetInt(3)
+			if !isGoroutineSafe(v) {
+				L.ArgError(i+1, "can not send a function, userdata, thread or table that has a metatable")
+			}
+			cas.Send = reflect.ValueOf(v)
+		case "|<-":
+			ch, ok := tbl.RawGetInt(2).(LChannel)
+			if !ok {
+				L.ArgError(i+1, "invalid select case")
+			}
+			cas.Chan = reflect.ValueOf((chan LValue)(ch))
+			cas.Dir = reflect.SelectRecv
+		case "default":
+			cas.Dir = reflect.SelectDefault
+		case "timeout":
+			sec, ok := tbl.RawGetInt(2).(LNumber)
+			if !ok {
+				L.ArgError(i+1, "invalid select case")
+			}
+			timer := time.NewTimer(time.Duration(float64(sec) * float64(time.Second)))
+			defer timer.Stop()
+			cas.Dir = reflect.SelectRecv
+			cas.Chan = reflect.ValueOf(timer.C)
+			timeouts[i] = true
+		default:
+			L.ArgError(i+1, "invalid channel direction:"+string(dir))
+		}
+		cases[i] = cas
+	}
+
+	pos, recv, rok := channelDoSelect(L, cases, -1)
+	if pos < 0 {
+		return 0
+	}
+
+	lv := LNil
+	if recv.Kind() != 0 {
+		lv, _ = recv.Interface().(LValue)
+		if lv == nil {
+			lv = LNil
+		}
+	}
+	tbl := L.Get(pos + 1).(*LTable)
+	last := tbl.RawGetInt(tbl.Len())
+	if last.Type() == LTFunction {
+		L.Push(last)
+		switch {
+		case timeouts[pos]:
+			L.Call(0, 0)
+		case cases[pos].Dir == reflect.SelectRecv:
+			if rok {
+				L.Push(LTrue)
+			} else {
+				L.Push(LFalse)
+			}
+			L.Push(lv)
+			L.Call(2, 0)
+		case cases[pos].Dir == reflect.SelectSend:
+			L.Push(tbl.RawGetInt(3))
+			L.Call(1, 0)
+		case cases[pos].Dir == reflect.SelectDefault:
+			L.Call(0, 0)
+		}
+	}
+	L.Push(LNumber(pos + 1))
+	L.Push(lv)
+	if rok {
+		L.Push(LTrue)
+	} else {
+		L.Push(LFalse)
+	}
+	return 3
+}
+
+var channelMethods = map[string]LGFunction{
+	"receive":     channelReceive,
+	"send":        channelSend,
+	"try_receive": channelTryReceive,
+	"try_send":    channelTrySend,
+	"close":       channelClose,
+	"len":         channelLen,
+	"cap":         channelCap,
+}
+
+// channelTimeout returns the timeout in seconds at the given index, or a negative
+// duration if there is none.
+func channelTimeout(L *LState, n int) time.Duration {
+	if L.Get(n) == LNil {
+		return -1
+	}
+	sec := float64(L.CheckNumber(n))
+	if sec < 0 {
+		return 0
+	}
+	return time.Duration(sec * float64(time.Second))
+}
+
+// channelDoSelect runs a select on the cases, a timer if timeout is not negative and
+// the context of L. It returns -1 as the chosen case if the timer fires and -2 if the
+// context is done.
+func channelDoSelect(L *LState, cases []reflect.SelectCase, timeout time.Duration) (chosen int, recv reflect.Value, recvOK bool) {
+	n := len(cases)
+	timeoutPos, ctxPos := -1, -1
+	if timeout >= 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutPos = len(cases)
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(timer.C)})
+	}
+	if L.ctx != nil {
+		ctxPos = len(cases)
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(L.ctx.Done())})
+	}
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			L.RaiseError("%v", rcv)
+		}
+	}()
+	chosen, recv, recvOK = reflect.Select(cases)
+	switch {
+	case chosen < n:
+		return chosen, recv, recvOK
+	case chosen == timeoutPos:
+		return -1, reflect.Value{}, false
+	case chosen == ctxPos:
+		return -2, reflect.Value{}, false
+	}
+	return chosen, recv, recvOK
+}
+
+// channelPushFailure pushes false, nil and the reason of a failed receive.
+func channelPushFailure(L *LState, chosen int, nvalues int) int {
+	L.Push(LFalse)
+	if nvalues > 1 {
+		L.Push(LNil)
+	}
+	switch chosen {
+	case -1:
+		L.Push(LString("timeout"))
+	case -2:
+		L.Push(LString(L.ctx.Err().Error()))
+	default:
+		L.Push(LString("closed"))
+	}
+	return nvalues + 1
+}
+
+func channelReceive(L *LState) int {
+	rch := checkChannel(L, 1)
+	timeout := channelTimeout(L, 2)
+	chosen, v, ok := channelDoSelect(L, []reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: rch}}, timeout)
+	if !ok {
+		return channelPushFailure(L, chosen, 2)
+	}
+	L.Push(LTrue)
+	L.Push(v.Interface().(LValue))
+	return 2
+}
+
+func channelTryReceive(L *LState) int {
+	rch := checkChannel(L, 1)
+	v, ok := rch.TryRecv()
+	if !v.IsValid() {
+		L.Push(LFalse)
+		L.Push(LNil)
+		L.Push(LString("empty"))
+		return 3
+	}
+	if !ok {
+		return channelPushFailure(L, 0, 2)
+	}
+	L.Push(LTrue)
+	L.Push(v.Interface().(LValue))
+	return 2
+}
+
+func channelSend(L *LState) int {
+	rch := checkChannel(L, 1)
+	v := checkGoroutineSafe(L, 2)
+	timeout := channelTimeout(L, 3)
+	chosen, _, _ := channelDoSelect(L, []reflect.SelectCase{{Dir: reflect.SelectSend, Chan: rch, Send: reflect.ValueOf(v)}}, timeout)
+	if chosen < 0 {
+		return channelPushFailure(L, chosen, 1)
+	}
+	L.Push(LTrue)
+	return 1
+}
+
+func channelTrySend(L *LState) int {
+	rch := checkChannel(L, 1)
+	v := checkGoroutineSafe(L, 2)
+	chosen, _, _ := channelDoSelect(L, []reflect.SelectCase{
+		{Dir: reflect.SelectSend, Chan: rch, Send: reflect.ValueOf(v)},
+		{Dir: reflect.SelectDefault},
+	}, -1)
+	if chosen != 0 {
+		L.Push(LFalse)
+		L.Push(LString("full"))
+		return 2
+	}
+	L.Push(LTrue)
+	return 1
+}
+
+func channelClose(L *LState) int {
+	rch := checkChannel(L, 1)
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			L.RaiseError("%v", rcv)
+		}
+	}()
+	rch.Close()
+	return 0
+}
+
+func channelLen(L *LState) int {
+	L.Push(LNumber(checkChannel(L, 1).Len()))
+	return 1
+}
+
+func channelCap(L *LState) int {
+	L.Push(LNumber(checkChannel(L, 1).Cap()))
+	return 1
+}
+
+//
@@ -0,0 +1,17 @@
+// Command glua-lsp is a language server for Lua scripts. It speaks JSON-RPC over stdin and
+// stdout, and knows the globals of the standard libraries.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/edunx/lua/lsp"
+)
+
+func main() {
+	if err := lsp.NewServer(nil).Serve(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
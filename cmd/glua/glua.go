@@ -1,178 +1,251 @@
-package main
-
-import (
-	"flag"
-	"fmt"
-	"github.com/chzyer/readline"
-	"github.com/edunx/lua"
-	"github.com/edunx/lua/parse"
-	"os"
-	"runtime/pprof"
-)
-
-func main() {
-	os.Exit(mainAux())
-}
-
-func mainAux() int {
-	var opt_e, opt_l, opt_p string
-	var opt_i, opt_v, opt_dt, opt_dc bool
-	var opt_m int
-	flag.StringVar(&opt_e, "e", "", "")
-	flag.StringVar(&opt_l, "l", "", "")
-	flag.StringVar(&opt_p, "p", "", "")
-	flag.IntVar(&opt_m, "mx", 0, "")
-	flag.BoolVar(&opt_i, "i", false, "")
-	flag.BoolVar(&opt_v, "v", false, "")
-	flag.BoolVar(&opt_dt, "dt", false, "")
-	flag.BoolVar(&opt_dc, "dc", false, "")
-	flag.Usage = func() {
-		fmt.Println(`Usage: glua [options] [script [args]].
-Available options are:
-  -e stat  execute string 'stat'
-  -l name  require library 'name'
-  -mx MB   memory limit(default: unlimited)
-  -dt      dump AST trees
-  -dc      dump VM codes
-  -i       enter interactive mode after executing 'script'
-  -p file  write cpu profiles to the file
-  -v       show version information`)
-	}
-	flag.Parse()
-	if len(opt_p) != 0 {
-		f, err := os.Create(opt_p)
-		if err != nil {
-			fmt.Println(err.Error())
-			os.Exit(1)
-		}
-		pprof.StartCPUProfile(f)
-		defer pprof.StopCPUProfile()
-	}
-	if len(opt_e) == 0 && !opt_i && !opt_v && flag.NArg() == 0 {
-		opt_i = true
-	}
-
-	status := 0
-
-	L := lua.NewState()
-	defer L.Close()
-	if opt_m > 0 {
-		L.SetMx(opt_m)
-	}
-
-	if opt_v || opt_i {
-		fmt.Println(lua.PackageCopyRight)
-	}
-
-	if len(opt_l) > 0 {
-		if err := L.DoFile(opt_l); err != nil {
-			fmt.Println(err.Error())
-		}
-	}
-
-	if nargs := flag.NArg(); nargs > 0 {
-		script := flag.Arg(0)
-		argtb := L.NewTable()
-		for i := 1; i < nargs; i++ {
-			L.RawSet(argtb, lua.LNumber(i), lua.LString(flag.Arg(i)))
-		}
-		L.SetGlobal("arg", argtb)
-		if opt_dt || opt_dc {
-			file, err := os.Open(script)
-			if err != nil {
-				fmt.Println(err.Error())
-				return 1
-			}
-			chunk, err2 := parse.Parse(file, script)
-			if err2 != nil {
-				fmt.Println(err2.Error())
-				return 1
-			}
-			if opt_dt {
-				fmt.Println(parse.Dump(chunk))
-			}
-			if opt_dc {
-				proto, err3 := lua.Compile(chunk, script)
-				if err3 != nil {
-					fmt.Println(err3.Error())
-					return 1
-				}
-				fmt.Println(proto.String())
-			}
-		}
-		if err := L.DoFile(script); err != nil {
-			fmt.Println(err.Error())
-			status = 1
-		}
-	}
-
-	if len(opt_e) > 0 {
-		if err := L.DoString(opt_e); err != nil {
-			fmt.Println(err.Error())
-			status = 1
-		}
-	}
-
-	if opt_i {
-		doREPL(L)
-	}
-	return status
-}
-
-// do read/eval/print/loop
-func doREPL(L *lua.LState) {
-	rl, err := readline.New("> ")
-	if err != nil {
-		panic(err)
-	}
-	defer rl.Close()
-	for {
-		if str, err := loadline(rl, L); err == nil {
-			if err := L.DoString(str); err != nil {
-				fmt.Println(err)
-			}
-		} else { // error on loadline
-			fmt.Println(err)
-			return
-		}
-	}
-}
-
-func incomplete(err error) bool {
-	if lerr, ok := err.(*lua.ApiError); ok {
-		if perr, ok := lerr.Cause.(*parse.Error); ok {
-			return perr.Pos.Line == parse.EOF
-		}
-	}
-	return false
-}
-
-func loadline(rl *readline.Instance, L *lua.LState) (string, error) {
-	rl.SetPrompt("> ")
-	if line, err := rl.Readline(); err == nil {
-		if _, err := L.LoadString("return " + line); err == nil { // try add return <...> then compile
-			return line, nil
-		} else {
-			return multiline(line, rl, L)
-		}
-	} else {
-		return "", err
-	}
-}
-
-func multiline(ml string, rl *readline.Instance, L *lua.LState) (string, error) {
-	for {
-		if _, err := L.LoadString(ml); err == nil { // try compile
-			return ml, nil
-		} else if !incomplete(err) { // syntax error , but not EOF
-			return ml, nil
-		} else {
-			rl.SetPrompt(">> ")
-			if line, err := rl.Readline(); err == nil {
-				ml = ml + "\n" + line
-			} else {
-				return "", err
-			}
-		}
-	}
-}
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/chzyer/readline"
+	"github.com/edunx/lua"
+	"github.com/edunx/lua/format"
+	"github.com/edunx/lua/lint"
+	"github.com/edunx/lua/parse"
+	"io"
+	"os"
+	"runtime/pprof"
+	"strings"
+)
+
+func main() {
+	os.Exit(mainAux())
+}
+
+func mainAux() int {
+	var opt_e, opt_l, opt_p, opt_globals string
+	var opt_i, opt_v, opt_dt, opt_dc, opt_O, opt_fmt, opt_lint, opt_json bool
+	var opt_m int
+	flag.StringVar(&opt_e, "e", "", "")
+	flag.StringVar(&opt_l, "l", "", "")
+	flag.StringVar(&opt_p, "p", "", "")
+	flag.IntVar(&opt_m, "mx", 0, "")
+	flag.BoolVar(&opt_i, "i", false, "")
+	flag.BoolVar(&opt_v, "v", false, "")
+	flag.BoolVar(&opt_dt, "dt", false, "")
+	flag.BoolVar(&opt_dc, "dc", false, "")
+	flag.BoolVar(&opt_O, "O", false, "")
+	flag.BoolVar(&opt_fmt, "fmt", false, "")
+	flag.BoolVar(&opt_lint, "lint", false, "")
+	flag.BoolVar(&opt_json, "json", false, "")
+	flag.StringVar(&opt_globals, "globals", "", "")
+	flag.Usage = func() {
+		fmt.Println(`Usage: glua [options] [script [args]].
+Available options are:
+  -e stat  execute string 'stat'
+  -l name  require library 'name'
+  -mx MB   memory limit(default: unlimited)
+  -dt      dump AST trees
+  -dc      dump VM codes(with -O, before and after the optimization)
+  -O       optimize the VM codes
+  -fmt     print the formatted script(default: stdin) and exit
+  -lint    check the scripts given as arguments and exit
+  -json    print the -lint diagnostics as JSON
+  -globals names  comma separated globals allowed by -lint
+  -i       enter interactive mode after executing 'script'
+  -p file  write cpu profiles to the file
+  -v       show version information`)
+	}
+	flag.Parse()
+	if len(opt_p) != 0 {
+		f, err := os.Create(opt_p)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		pprof.StartCPUProfile(f)
+		defer pprof.StopCPUProfile()
+	}
+	if opt_fmt {
+		return formatScript(flag.Arg(0))
+	}
+	if opt_lint {
+		return lintScripts(flag.Args(), opt_globals, opt_json)
+	}
+	if len(opt_e) == 0 && !opt_i && !opt_v && flag.NArg() == 0 {
+		opt_i = true
+	}
+
+	status := 0
+
+	L := lua.NewState(lua.Options{Optimize: opt_O})
+	defer L.Close()
+	if opt_m > 0 {
+		L.SetMx(opt_m)
+	}
+
+	if opt_v || opt_i {
+		fmt.Println(lua.PackageCopyRight)
+	}
+
+	if len(opt_l) > 0 {
+		if err := L.DoFile(opt_l); err != nil {
+			fmt.Println(err.Error())
+		}
+	}
+
+	if nargs := flag.NArg(); nargs > 0 {
+		script := flag.Arg(0)
+		argtb := L.NewTable()
+		for i := 1; i < nargs; i++ {
+			L.RawSet(argtb, lua.LNumber(i), lua.LString(flag.Arg(i)))
+		}
+		L.SetGlobal("arg", argtb)
+		if opt_dt || opt_dc {
+			file, err := os.Open(script)
+			if err != nil {
+				fmt.Println(err.Error())
+				return 1
+			}
+			chunk, err2 := parse.Parse(file, script)
+			if err2 != nil {
+				fmt.Println(err2.Error())
+				return 1
+			}
+			if opt_dt {
+				fmt.Println(parse.Dump(chunk))
+			}
+			if opt_dc {
+				proto, err3 := lua.Compile(chunk, script)
+				if err3 != nil {
+					fmt.Println(err3.Error())
+					return 1
+				}
+				fmt.Println(proto.String())
+				if opt_O {
+					lua.Optimize(proto)
+					fmt.Println("; optimized")
+					fmt.Println(proto.String())
+				}
+			}
+		}
+		if err := L.DoFile(script); err != nil {
+			fmt.Println(err.Error())
+			status = 1
+		}
+	}
+
+	if len(opt_e) > 0 {
+		if err := L.DoString(opt_e); err != nil {
+			fmt.Println(err.Error())
+			status = 1
+		}
+	}
+
+	if opt_i {
+		doREPL(L)
+	}
+	return status
+}
+
+func formatScript(script string) int {
+	var src []byte
+	var err error
+	if len(script) == 0 {
+		script = "<stdin>"
+		src, err = io.ReadAll(os.Stdin)
+	} else {
+		src, err = os.ReadFile(script)
+	}
+	if err == nil {
+		src, err = format.Source(src, script)
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+		return 1
+	}
+	os.Stdout.Write(src)
+	return 0
+}
+
+func lintScripts(scripts []string, globals string, json bool) int {
+	L := lua.NewState()
+	defer L.Close()
+	config := &lint.Config{Globals: append(lint.Globals(L), "arg")}
+	if len(globals) > 0 {
+		config.Globals = append(config.Globals, strings.Split(globals, ",")...)
+	}
+
+	var diags []lint.Diagnostic
+	for _, script := range scripts {
+		d, err := lint.File(script, config)
+		if err != nil {
+			fmt.Println(err.Error())
+			return 1
+		}
+		diags = append(diags, d...)
+	}
+	if json {
+		lint.WriteJSON(os.Stdout, diags)
+	} else {
+		lint.WriteText(os.Stdout, diags)
+	}
+	if len(diags) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// do read/eval/print/loop
+func doREPL(L *lua.LState) {
+	rl, err := readline.New("> ")
+	if err != nil {
+		panic(err)
+	}
+	defer rl.Close()
+	for {
+		if str, err := loadline(rl, L); err == nil {
+			if err := L.DoString(str); err != nil {
+				fmt.Println(err)
+			}
+		} else { // error on loadline
+			fmt.Println(err)
+			return
+		}
+	}
+}
+
+func incomplete(err error) bool {
+	if lerr, ok := err.(*lua.ApiError); ok {
+		if perr, ok := lerr.Cause.(*parse.Error); ok {
+			return perr.Pos.Line == parse.EOF
+		}
+	}
+	return false
+}
+
+func loadline(rl *readline.Instance, L *lua.LState) (string, error) {
+	rl.SetPrompt("> ")
+	if line, err := rl.Readline(); err == nil {
+		if _, err := L.LoadString("return " + line); err == nil { // try add return <...> then compile
+			return line, nil
+		} else {
+			return multiline(line, rl, L)
+		}
+	} else {
+		return "", err
+	}
+}
+
+func multiline(ml string, rl *readline.Instance, L *lua.LState) (string, error) {
+	for {
+		if _, err := L.LoadString(ml); err == nil { // try compile
+			return ml, nil
+		} else if !incomplete(err) { // syntax error , but not EOF
+			return ml, nil
+		} else {
+			rl.SetPrompt(">> ")
+			if line, err := rl.Readline(); err == nil {
+				ml = ml + "\n" + line
+			} else {
+				return "", err
+			}
+		}
+	}
+}
@@ -97,6 +97,29 @@ func eline(pos ast.PositionHolder) int {
 	return pos.LastLine()
 }
 
+func scol(pos ast.PositionHolder) int {
+	return pos.Column()
+}
+
+func ecol(pos ast.PositionHolder) int {
+	return pos.LastColumn()
+}
+
+// opNode returns the node whose position is recorded for the instruction performing expr:
+// the key of a field access and the function of a call, so that an error in a chain of
+// accesses points at the failing one.
+func opNode(expr ast.Expr) ast.Expr {
+	switch ex := expr.(type) {
+	case *ast.AttrGetExpr:
+		return ex.Key
+	case *ast.FuncCallExpr:
+		if ex.Func != nil {
+			return opNode(ex.Func)
+		}
+	}
+	return expr
+}
+
 func savereg(ec *expcontext, reg int) int {
 	if ec.ctype != ecLocal || ec.reg == regNotDefined {
 		return reg
@@ -145,32 +168,35 @@ func (e *CompileError) Error() string {
 } // }}}
 
 type codeStore struct { // {{{
-	codes []uint32
-	lines []int
-	pc    int
+	codes   []uint32
+	lines   []int
+	columns []int
+	pc      int
 }
 
-func (cd *codeStore) Add(inst uint32, line int) {
+func (cd *codeStore) Add(inst uint32, line, column int) {
 	if l := len(cd.codes); l <= 0 || cd.pc == l {
 		cd.codes = append(cd.codes, inst)
 		cd.lines = append(cd.lines, line)
+		cd.columns = append(cd.columns, column)
 	} else {
 		cd.codes[cd.pc] = inst
 		cd.lines[cd.pc] = line
+		cd.columns[cd.pc] = column
 	}
 	cd.pc++
 }
 
-func (cd *codeStore) AddABC(op int, a int, b int, c int, line int) {
-	cd.Add(opCreateABC(op, a, b, c), line)
+func (cd *codeStore) AddABC(op int, a int, b int, c int, line, column int) {
+	cd.Add(opCreateABC(op, a, b, c), line, column)
 }
 
-func (cd *codeStore) AddABx(op int, a int, bx int, line int) {
-	cd.Add(opCreateABx(op, a, bx), line)
+func (cd *codeStore) AddABx(op int, a int, bx int, line, column int) {
+	cd.Add(opCreateABx(op, a, bx), line, column)
 }
 
-func (cd *codeStore) AddASbx(op int, a int, sbx int, line int) {
-	cd.Add(opCreateASbx(op, a, sbx), line)
+func (cd *codeStore) AddASbx(op int, a int, sbx int, line, column int) {
+	cd.Add(opCreateASbx(op, a, sbx), line, column)
 }
 
 func (cd *codeStore) PropagateKMV(top int, save *int, reg *int, inc int) {
@@ -208,12 +234,12 @@ func (cd *codeStore) PropagateMV(top int, save *int, reg *int, inc int) {
 	*reg = *reg + inc
 }
 
-func (cd *codeStore) AddLoadNil(a, b, line int) {
+func (cd *codeStore) AddLoadNil(a, b, line, column int) {
 	last := cd.Last()
 	if opGetOpCode(last) == OP_LOADNIL && (opGetArgA(last)+opGetArgB(last)) == a {
 		cd.SetB(cd.LastPC(), b)
 	} else {
-		cd.AddABC(OP_LOADNIL, a, b, 0, line)
+		cd.AddABC(OP_LOADNIL, a, b, 0, line, column)
 	}
 }
 
@@ -253,6 +279,10 @@ func (cd *codeStore) PosList() []int {
 	return cd.lines[:cd.pc]
 }
 
+func (cd *codeStore) ColumnList() []int {
+	return cd.columns[:cd.pc]
+}
+
 func (cd *codeStore) LastPC() int {
 	return cd.pc - 1
 }
@@ -334,13 +364,15 @@ type codeBlock struct {
 	RefUpvalue bool
 	LineStart  int
 	LastLine   int
+	LastColumn int
 }
 
 func newCodeBlock(localvars *varNamePool, blabel int, parent *codeBlock, pos ast.PositionHolder) *codeBlock {
-	bl := &codeBlock{localvars, blabel, parent, false, 0, 0}
+	bl := &codeBlock{localvars, blabel, parent, false, 0, 0, 0}
 	if pos != nil {
 		bl.LineStart = pos.Line()
 		bl.LastLine = pos.LastLine()
+		bl.LastColumn = pos.LastColumn()
 	}
 	return bl
 }
@@ -360,7 +392,7 @@ type funcContext struct {
 func newFuncContext(sourcename string, parent *funcContext) *funcContext {
 	fc := &funcContext{
 		Proto:    newFunctionProto(sourcename),
-		Code:     &codeStore{make([]uint32, 0, 1024), make([]int, 0, 1024), 0},
+		Code:     &codeStore{make([]uint32, 0, 1024), make([]int, 0, 1024), make([]int, 0, 1024), 0},
 		Parent:   parent,
 		Upvalues: newVarNamePool(0),
 		Block:    newCodeBlock(newVarNamePool(0), labelNoJump, nil, nil),
@@ -439,7 +471,7 @@ func (fc *funcContext) CloseUpvalues() int {
 	n := -1
 	if fc.Block.RefUpvalue {
 		n = fc.Block.Parent.LocalVars.LastIndex()
-		fc.Code.AddABC(OP_CLOSE, n, 0, 0, fc.Block.LastLine)
+		fc.Code.AddABC(OP_CLOSE, n, 0, 0, fc.Block.LastLine, fc.Block.LastColumn)
 	}
 	return n
 }
@@ -483,7 +515,9 @@ func compileBlock(context *funcContext, chunk []ast.Stmt) { // {{{
 	}
 	ph := &ast.Node{}
 	ph.SetLine(sline(chunk[0]))
+	ph.SetColumn(scol(chunk[0]))
 	ph.SetLastLine(eline(chunk[len(chunk)-1]))
+	ph.SetLastColumn(ecol(chunk[len(chunk)-1]))
 	context.EnterBlock(labelNoJump, ph)
 	for _, stmt := range chunk {
 		compileStmt(context, stmt)
@@ -571,7 +605,9 @@ func compileAssignStmtRight(context *funcContext, stmt *ast.AssignStmt, reg int,
 		if namesassigned >= lenexprs {
 			expr = &ast.NilExpr{}
 			expr.SetLine(sline(stmt.Lhs[namesassigned]))
+			expr.SetColumn(scol(stmt.Lhs[namesassigned]))
 			expr.SetLastLine(eline(stmt.Lhs[namesassigned]))
+			expr.SetLastColumn(ecol(stmt.Lhs[namesassigned]))
 		} else if isVarArgReturnExpr(stmt.Rhs[namesassigned]) && (lenexprs-namesassigned-1) <= 0 {
 			varargopt := lennames - namesassigned - 1
 			regstart := reg
@@ -630,21 +666,21 @@ func compileAssignStmt(context *funcContext, stmt *ast.AssignStmt) { // {{{
 		switch acs[i].ec.ctype {
 		case ecLocal:
 			if acs[i].needmove {
-				code.AddABC(OP_MOVE, context.FindLocalVar(ex.(*ast.IdentExpr).Value), reg, 0, sline(ex))
+				code.AddABC(OP_MOVE, context.FindLocalVar(ex.(*ast.IdentExpr).Value), reg, 0, sline(ex), scol(ex))
 				reg -= 1
 			}
 		case ecGlobal:
-			code.AddABx(OP_SETGLOBAL, reg, context.ConstIndex(LString(ex.(*ast.IdentExpr).Value)), sline(ex))
+			code.AddABx(OP_SETGLOBAL, reg, context.ConstIndex(LString(ex.(*ast.IdentExpr).Value)), sline(ex), scol(ex))
 			reg -= 1
 		case ecUpvalue:
-			code.AddABC(OP_SETUPVAL, reg, context.Upvalues.RegisterUnique(ex.(*ast.IdentExpr).Value), 0, sline(ex))
+			code.AddABC(OP_SETUPVAL, reg, context.Upvalues.RegisterUnique(ex.(*ast.IdentExpr).Value), 0, sline(ex), scol(ex))
 			reg -= 1
 		case ecTable:
 			opcode := OP_SETTABLE
 			if acs[i].keyks {
 				opcode = OP_SETTABLEKS
 			}
-			code.AddABC(opcode, acs[i].ec.reg, acs[i].keyrk, acs[i].valuerk, sline(ex))
+			code.AddABC(opcode, acs[i].ec.reg, acs[i].keyrk, acs[i].valuerk, sline(opNode(ex)), scol(opNode(ex)))
 			if !opIsK(acs[i].valuerk) {
 				reg -= 1
 			}
@@ -652,7 +688,7 @@ func compileAssignStmt(context *funcContext, stmt *ast.AssignStmt) { // {{{
 	}
 } // }}}
 
-func compileRegAssignment(context *funcContext, names []string, exprs []ast.Expr, reg int, nvars int, line int) { // {{{
+func compileRegAssignment(context *funcContext, names []string, exprs []ast.Expr, reg int, nvars int, line, column int) { // {{{
 	lennames := len(names)
 	lenexprs := len(exprs)
 	namesassigned := 0
@@ -677,7 +713,7 @@ func compileRegAssignment(context *funcContext, names []string, exprs []ast.Expr
 	// extra left names
 	if lennames > namesassigned {
 		restleft := lennames - namesassigned - 1
-		context.Code.AddLoadNil(reg, reg+restleft, line)
+		context.Code.AddLoadNil(reg, reg+restleft, line, column)
 		reg += restleft
 	}
 
@@ -697,12 +733,12 @@ func compileLocalAssignStmt(context *funcContext, stmt *ast.LocalAssignStmt) { /
 	if len(stmt.Names) == 1 && len(stmt.Exprs) == 1 {
 		if _, ok := stmt.Exprs[0].(*ast.FunctionExpr); ok {
 			context.RegisterLocalVar(stmt.Names[0])
-			compileRegAssignment(context, stmt.Names, stmt.Exprs, reg, len(stmt.Names), sline(stmt))
+			compileRegAssignment(context, stmt.Names, stmt.Exprs, reg, len(stmt.Names), sline(stmt), scol(stmt))
 			return
 		}
 	}
 
-	compileRegAssignment(context, stmt.Names, stmt.Exprs, reg, len(stmt.Names), sline(stmt))
+	compileRegAssignment(context, stmt.Names, stmt.Exprs, reg, len(stmt.Names), sline(stmt), scol(stmt))
 	for _, name := range stmt.Names {
 		context.RegisterLocalVar(name)
 	}
@@ -719,13 +755,13 @@ func compileReturnStmt(context *funcContext, stmt *ast.ReturnStmt) { // {{{
 		switch ex := stmt.Exprs[0].(type) {
 		case *ast.IdentExpr:
 			if idx := context.FindLocalVar(ex.Value); idx > -1 {
-				code.AddABC(OP_RETURN, idx, 2, 0, sline(stmt))
+				code.AddABC(OP_RETURN, idx, 2, 0, sline(stmt), scol(stmt))
 				return
 			}
 		case *ast.FuncCallExpr:
 			reg += compileExpr(context, reg, ex, ecnone(-2))
 			code.SetOpCode(code.LastPC(), OP_TAILCALL)
-			code.AddABC(OP_RETURN, a, 0, 0, sline(stmt))
+			code.AddABC(OP_RETURN, a, 0, 0, sline(stmt), scol(stmt))
 			return
 		}
 	}
@@ -742,7 +778,7 @@ func compileReturnStmt(context *funcContext, stmt *ast.ReturnStmt) { // {{{
 	if lastisvaarg {
 		count = 0
 	}
-	context.Code.AddABC(OP_RETURN, a, count, 0, sline(stmt))
+	context.Code.AddABC(OP_RETURN, a, count, 0, sline(stmt), scol(stmt))
 } // }}}
 
 func compileIfStmt(context *funcContext, stmt *ast.IfStmt) { // {{{
@@ -754,7 +790,7 @@ func compileIfStmt(context *funcContext, stmt *ast.IfStmt) { // {{{
 	context.SetLabelPc(thenlabel, context.Code.LastPC())
 	compileBlock(context, stmt.Then)
 	if len(stmt.Else) > 0 {
-		context.Code.AddASbx(OP_JMP, 0, endlabel, sline(stmt))
+		context.Code.AddASbx(OP_JMP, 0, endlabel, sline(stmt), scol(stmt))
 	}
 	context.SetLabelPc(elselabel, context.Code.LastPC())
 	if len(stmt.Else) > 0 {
@@ -777,7 +813,7 @@ func compileBranchCondition(context *funcContext, reg int, expr ast.Expr, thenla
 	switch ex := expr.(type) {
 	case *ast.FalseExpr, *ast.NilExpr:
 		if !hasnextcond {
-			code.AddASbx(OP_JMP, 0, elselabel, sline(expr))
+			code.AddASbx(OP_JMP, 0, elselabel, sline(expr), scol(expr))
 			return
 		}
 	case *ast.TrueExpr, *ast.NumberExpr, *ast.StringExpr:
@@ -808,8 +844,8 @@ func compileBranchCondition(context *funcContext, reg int, expr ast.Expr, thenla
 
 	a := reg
 	compileExprWithMVPropagation(context, expr, &reg, &a)
-	code.AddABC(OP_TEST, a, 0, 0^flip, sline(expr))
-	code.AddASbx(OP_JMP, 0, jumplabel, sline(expr))
+	code.AddABC(OP_TEST, a, 0, 0^flip, sline(expr), scol(expr))
+	code.AddASbx(OP_JMP, 0, jumplabel, sline(expr), scol(expr))
 } // }}}
 
 func compileWhileStmt(context *funcContext, stmt *ast.WhileStmt) { // {{{
@@ -823,7 +859,7 @@ func compileWhileStmt(context *funcContext, stmt *ast.WhileStmt) { // {{{
 	context.EnterBlock(elselabel, stmt)
 	compileChunk(context, stmt.Stmts)
 	context.CloseUpvalues()
-	context.Code.AddASbx(OP_JMP, 0, condlabel, eline(stmt))
+	context.Code.AddASbx(OP_JMP, 0, condlabel, eline(stmt), ecol(stmt))
 	context.LeaveBlock()
 	context.SetLabelPc(elselabel, context.Code.LastPC())
 } // }}}
@@ -844,10 +880,10 @@ func compileRepeatStmt(context *funcContext, stmt *ast.RepeatStmt) { // {{{
 
 	if n > -1 {
 		label := context.NewLabel()
-		context.Code.AddASbx(OP_JMP, 0, label, eline(stmt))
+		context.Code.AddASbx(OP_JMP, 0, label, eline(stmt), ecol(stmt))
 		context.SetLabelPc(elselabel, context.Code.LastPC())
-		context.Code.AddABC(OP_CLOSE, n, 0, 0, eline(stmt))
-		context.Code.AddASbx(OP_JMP, 0, initlabel, eline(stmt))
+		context.Code.AddABC(OP_CLOSE, n, 0, 0, eline(stmt), ecol(stmt))
+		context.Code.AddASbx(OP_JMP, 0, initlabel, eline(stmt), ecol(stmt))
 		context.SetLabelPc(label, context.Code.LastPC())
 	}
 
@@ -857,9 +893,9 @@ func compileBreakStmt(context *funcContext, stmt *ast.BreakStmt) { // {{{
 	for block := context.Block; block != nil; block = block.Parent {
 		if label := block.BreakLabel; label != labelNoJump {
 			if block.RefUpvalue {
-				context.Code.AddABC(OP_CLOSE, block.Parent.LocalVars.LastIndex(), 0, 0, sline(stmt))
+				context.Code.AddABC(OP_CLOSE, block.Parent.LocalVars.LastIndex(), 0, 0, sline(stmt), scol(stmt))
 			}
-			context.Code.AddASbx(OP_JMP, 0, label, sline(stmt))
+			context.Code.AddASbx(OP_JMP, 0, label, sline(stmt), scol(stmt))
 			return
 		}
 	}
@@ -873,11 +909,13 @@ func compileFuncDefStmt(context *funcContext, stmt *ast.FuncDefStmt) { // {{{
 		compileExprWithKMVPropagation(context, stmt.Name.Receiver, &reg, &treg)
 		kreg = loadRk(context, &reg, stmt.Func, LString(stmt.Name.Method))
 		compileExpr(context, reg, stmt.Func, ecfuncdef)
-		context.Code.AddABC(OP_SETTABLE, treg, kreg, reg, sline(stmt.Name.Receiver))
+		context.Code.AddABC(OP_SETTABLE, treg, kreg, reg, sline(stmt.Name.Receiver), scol(stmt.Name.Receiver))
 	} else {
 		astmt := &ast.AssignStmt{Lhs: []ast.Expr{stmt.Name.Func}, Rhs: []ast.Expr{stmt.Func}}
 		astmt.SetLine(sline(stmt.Func))
+		astmt.SetColumn(scol(stmt.Func))
 		astmt.SetLastLine(eline(stmt.Func))
+		astmt.SetLastColumn(ecol(stmt.Func))
 		compileAssignStmt(context, astmt)
 	}
 } // }}}
@@ -903,11 +941,12 @@ func compileNumberForStmt(context *funcContext, stmt *ast.NumberForStmt) { // {{
 	if stmt.Step == nil {
 		stmt.Step = &ast.NumberExpr{Value: "1"}
 		stmt.Step.SetLine(sline(stmt.Init))
+		stmt.Step.SetColumn(scol(stmt.Init))
 	}
 	ecupdate(ec, ecLocal, rstep, 0)
 	compileExpr(context, reg, stmt.Step, ec)
 
-	code.AddASbx(OP_FORPREP, rindex, 0, sline(stmt))
+	code.AddASbx(OP_FORPREP, rindex, 0, sline(stmt), scol(stmt))
 
 	context.RegisterLocalVar(stmt.Name)
 
@@ -917,7 +956,7 @@ func compileNumberForStmt(context *funcContext, stmt *ast.NumberForStmt) { // {{
 	context.LeaveBlock()
 
 	flpc := code.LastPC()
-	code.AddASbx(OP_FORLOOP, rindex, bodypc-(flpc+1), sline(stmt))
+	code.AddASbx(OP_FORLOOP, rindex, bodypc-(flpc+1), sline(stmt), scol(stmt))
 
 	context.SetLabelPc(endlabel, code.LastPC())
 	code.SetSbx(bodypc, flpc-bodypc)
@@ -936,9 +975,9 @@ func compileGenericForStmt(context *funcContext, stmt *ast.GenericForStmt) { //
 	context.RegisterLocalVar("(for state)")
 	context.RegisterLocalVar("(for control)")
 
-	compileRegAssignment(context, stmt.Names, stmt.Exprs, context.RegTop()-3, 3, sline(stmt))
+	compileRegAssignment(context, stmt.Names, stmt.Exprs, context.RegTop()-3, 3, sline(stmt), scol(stmt))
 
-	code.AddASbx(OP_JMP, 0, fllabel, sline(stmt))
+	code.AddASbx(OP_JMP, 0, fllabel, sline(stmt), scol(stmt))
 
 	for _, name := range stmt.Names {
 		context.RegisterLocalVar(name)
@@ -950,8 +989,8 @@ func compileGenericForStmt(context *funcContext, stmt *ast.GenericForStmt) { //
 	context.LeaveBlock()
 
 	context.SetLabelPc(fllabel, code.LastPC())
-	code.AddABC(OP_TFORLOOP, rgen, 0, nnames, sline(stmt))
-	code.AddASbx(OP_JMP, 0, bodylabel, sline(stmt))
+	code.AddABC(OP_TFORLOOP, rgen, 0, nnames, sline(stmt), scol(stmt))
+	code.AddASbx(OP_JMP, 0, bodylabel, sline(stmt), scol(stmt))
 
 	context.SetLabelPc(endlabel, code.LastPC())
 } // }}}
@@ -966,36 +1005,36 @@ func compileExpr(context *funcContext, reg int, expr ast.Expr, ec *expcontext) i
 
 	switch ex := expr.(type) {
 	case *ast.StringExpr:
-		code.AddABx(OP_LOADK, sreg, context.ConstIndex(LString(ex.Value)), sline(ex))
+		code.AddABx(OP_LOADK, sreg, context.ConstIndex(LString(ex.Value)), sline(ex), scol(ex))
 		return sused
 	case *ast.NumberExpr:
 		num, err := parseNumber(ex.Value)
 		if err != nil {
 			num = LNumber(math.NaN())
 		}
-		code.AddABx(OP_LOADK, sreg, context.ConstIndex(num), sline(ex))
+		code.AddABx(OP_LOADK, sreg, context.ConstIndex(num), sline(ex), scol(ex))
 		return sused
 	case *constLValueExpr:
-		code.AddABx(OP_LOADK, sreg, context.ConstIndex(ex.Value), sline(ex))
+		code.AddABx(OP_LOADK, sreg, context.ConstIndex(ex.Value), sline(ex), scol(ex))
 		return sused
 	case *ast.NilExpr:
-		code.AddLoadNil(sreg, sreg, sline(ex))
+		code.AddLoadNil(sreg, sreg, sline(ex), scol(ex))
 		return sused
 	case *ast.FalseExpr:
-		code.AddABC(OP_LOADBOOL, sreg, 0, 0, sline(ex))
+		code.AddABC(OP_LOADBOOL, sreg, 0, 0, sline(ex), scol(ex))
 		return sused
 	case *ast.TrueExpr:
-		code.AddABC(OP_LOADBOOL, sreg, 1, 0, sline(ex))
+		code.AddABC(OP_LOADBOOL, sreg, 1, 0, sline(ex), scol(ex))
 		return sused
 	case *ast.IdentExpr:
 		switch getIdentRefType(context, context, ex) {
 		case ecGlobal:
-			code.AddABx(OP_GETGLOBAL, sreg, context.ConstIndex(LString(ex.Value)), sline(ex))
+			code.AddABx(OP_GETGLOBAL, sreg, context.ConstIndex(LString(ex.Value)), sline(ex), scol(ex))
 		case ecUpvalue:
-			code.AddABC(OP_GETUPVAL, sreg, context.Upvalues.RegisterUnique(ex.Value), 0, sline(ex))
+			code.AddABC(OP_GETUPVAL, sreg, context.Upvalues.RegisterUnique(ex.Value), 0, sline(ex), scol(ex))
 		case ecLocal:
 			b := context.FindLocalVar(ex.Value)
-			code.AddABC(OP_MOVE, sreg, b, 0, sline(ex))
+			code.AddABC(OP_MOVE, sreg, b, 0, sline(ex), scol(ex))
 		}
 		return sused
 	case *ast.Comma3Expr:
@@ -1003,7 +1042,7 @@ func compileExpr(context *funcContext, reg int, expr ast.Expr, ec *expcontext) i
 			raiseCompileError(context, sline(ex), "cannot use '...' outside a vararg function")
 		}
 		context.Proto.IsVarArg &= ^VarArgNeedsArg
-		code.AddABC(OP_VARARG, sreg, 2+ec.varargopt, 0, sline(ex))
+		code.AddABC(OP_VARARG, sreg, 2+ec.varargopt, 0, sline(ex), scol(ex))
 		if context.RegTop() > (sreg+2+ec.varargopt) || ec.varargopt < -1 {
 			return 0
 		}
@@ -1018,7 +1057,7 @@ func compileExpr(context *funcContext, reg int, expr ast.Expr, ec *expcontext) i
 		if _, ok := ex.Key.(*ast.StringExpr); ok {
 			opcode = OP_GETTABLEKS
 		}
-		code.AddABC(opcode, a, b, c, sline(ex))
+		code.AddABC(opcode, a, b, c, sline(ex.Key), scol(ex.Key))
 		return sused
 	case *ast.TableExpr:
 		compileTableExpr(context, reg, ex, ec)
@@ -1045,18 +1084,18 @@ func compileExpr(context *funcContext, reg int, expr ast.Expr, ec *expcontext) i
 		compileFunctionExpr(childcontext, ex, ec)
 		protono := len(context.Proto.FunctionPrototypes)
 		context.Proto.FunctionPrototypes = append(context.Proto.FunctionPrototypes, childcontext.Proto)
-		code.AddABx(OP_CLOSURE, sreg, protono, sline(ex))
+		code.AddABx(OP_CLOSURE, sreg, protono, sline(ex), scol(ex))
 		for _, upvalue := range childcontext.Upvalues.List() {
 			localidx, block := context.FindLocalVarAndBlock(upvalue.Name)
 			if localidx > -1 {
-				code.AddABC(OP_MOVE, 0, localidx, 0, sline(ex))
+				code.AddABC(OP_MOVE, 0, localidx, 0, sline(ex), scol(ex))
 				block.RefUpvalue = true
 			} else {
 				upvalueidx := context.Upvalues.Find(upvalue.Name)
 				if upvalueidx < 0 {
 					upvalueidx = context.Upvalues.RegisterUnique(upvalue.Name)
 				}
-				code.AddABC(OP_GETUPVAL, 0, upvalueidx, 0, sline(ex))
+				code.AddABC(OP_GETUPVAL, 0, upvalueidx, 0, sline(ex), scol(ex))
 			}
 		}
 		return sused
@@ -1147,10 +1186,11 @@ func compileFunctionExpr(context *funcContext, funcexpr *ast.FunctionExpr, ec *e
 
 	compileChunk(context, funcexpr.Stmts)
 
-	context.Code.AddABC(OP_RETURN, 0, 1, 0, eline(funcexpr))
+	context.Code.AddABC(OP_RETURN, 0, 1, 0, eline(funcexpr), ecol(funcexpr))
 	context.EndScope()
 	context.Proto.Code = context.Code.List()
 	context.Proto.DbgSourcePositions = context.Code.PosList()
+	context.Proto.DbgSourceColumns = context.Code.ColumnList()
 	context.Proto.DbgUpvalues = context.Upvalues.Names()
 	context.Proto.NumUpvalues = uint8(len(context.Proto.DbgUpvalues))
 	for _, clv := range context.Proto.Constants {
@@ -1173,7 +1213,7 @@ func compileTableExpr(context *funcContext, reg int, ex *ast.TableExpr, ec *expc
 	*/
 	tablereg := reg
 	reg++
-	code.AddABC(OP_NEWTABLE, tablereg, 0, 0, sline(ex))
+	code.AddABC(OP_NEWTABLE, tablereg, 0, 0, sline(ex), scol(ex))
 	tablepc := code.LastPC()
 	regbase := reg
 
@@ -1199,7 +1239,7 @@ func compileTableExpr(context *funcContext, reg int, ex *ast.TableExpr, ec *expc
 			if _, ok := field.Key.(*ast.StringExpr); ok {
 				opcode = OP_SETTABLEKS
 			}
-			code.AddABC(opcode, tablereg, b, c, sline(ex))
+			code.AddABC(opcode, tablereg, b, c, sline(ex), scol(ex))
 			reg = regorg
 		}
 		flush := arraycount % FieldsPerFlush
@@ -1221,16 +1261,16 @@ func compileTableExpr(context *funcContext, reg int, ex *ast.TableExpr, ec *expc
 			if c > 511 {
 				c = 0
 			}
-			code.AddABC(OP_SETLIST, tablereg, b, c, sline(line))
+			code.AddABC(OP_SETLIST, tablereg, b, c, sline(line), scol(line))
 			if c == 0 {
-				code.Add(uint32(c), sline(line))
+				code.Add(uint32(c), sline(line), scol(line))
 			}
 		}
 	}
 	code.SetB(tablepc, int2Fb(arraycount))
 	code.SetC(tablepc, int2Fb(len(ex.Fields)-arraycount))
 	if shouldmove(ec, tablereg) {
-		code.AddABC(OP_MOVE, ec.reg, tablereg, 0, sline(ex))
+		code.AddABC(OP_MOVE, ec.reg, tablereg, 0, sline(ex), scol(ex))
 	}
 } // }}}
 
@@ -1238,6 +1278,7 @@ func compileArithmeticOpExpr(context *funcContext, reg int, expr *ast.Arithmetic
 	exp := constFold(expr)
 	if ex, ok := exp.(*constLValueExpr); ok {
 		exp.SetLine(sline(expr))
+		exp.SetColumn(scol(expr))
 		compileExpr(context, reg, ex, ec)
 		return
 	}
@@ -1263,7 +1304,7 @@ func compileArithmeticOpExpr(context *funcContext, reg int, expr *ast.Arithmetic
 	case "^":
 		op = OP_POW
 	}
-	context.Code.AddABC(op, a, b, c, sline(expr))
+	context.Code.AddABC(op, a, b, c, sline(expr), scol(expr))
 } // }}}
 
 func compileStringConcatOpExpr(context *funcContext, reg int, expr *ast.StringConcatOpExpr, ec *expcontext) { // {{{
@@ -1284,7 +1325,7 @@ func compileStringConcatOpExpr(context *funcContext, reg int, expr *ast.StringCo
 	for pc := code.LastPC(); pc != 0 && opGetOpCode(code.At(pc)) == OP_CONCAT; pc-- {
 		code.Pop()
 	}
-	code.AddABC(OP_CONCAT, a, basereg, basereg+crange, sline(expr))
+	code.AddABC(OP_CONCAT, a, basereg, basereg+crange, sline(expr), scol(expr))
 } // }}}
 
 func compileUnaryOpExpr(context *funcContext, reg int, expr ast.Expr, ec *expcontext) { // {{{
@@ -1296,6 +1337,7 @@ func compileUnaryOpExpr(context *funcContext, reg int, expr ast.Expr, ec *expcon
 		exp := constFold(ex)
 		if lvexpr, ok := exp.(*constLValueExpr); ok {
 			exp.SetLine(sline(expr))
+			exp.SetColumn(scol(expr))
 			compileExpr(context, reg, lvexpr, ec)
 			return
 		}
@@ -1305,10 +1347,10 @@ func compileUnaryOpExpr(context *funcContext, reg int, expr ast.Expr, ec *expcon
 	case *ast.UnaryNotOpExpr:
 		switch ex.Expr.(type) {
 		case *ast.TrueExpr:
-			code.AddABC(OP_LOADBOOL, savereg(ec, reg), 0, 0, sline(expr))
+			code.AddABC(OP_LOADBOOL, savereg(ec, reg), 0, 0, sline(expr), scol(expr))
 			return
 		case *ast.FalseExpr, *ast.NilExpr:
-			code.AddABC(OP_LOADBOOL, savereg(ec, reg), 1, 0, sline(expr))
+			code.AddABC(OP_LOADBOOL, savereg(ec, reg), 1, 0, sline(expr), scol(expr))
 			return
 		default:
 			opcode = OP_NOT
@@ -1322,7 +1364,7 @@ func compileUnaryOpExpr(context *funcContext, reg int, expr ast.Expr, ec *expcon
 	a := savereg(ec, reg)
 	b := reg
 	compileExprWithMVPropagation(context, operandexpr, &reg, &b)
-	code.AddABC(opcode, a, b, 0, sline(expr))
+	code.AddABC(opcode, a, b, 0, sline(expr), scol(expr))
 } // }}}
 
 func compileRelationalOpExprAux(context *funcContext, reg int, expr *ast.RelationalOpExpr, flip int, label int) { // {{{
@@ -1333,19 +1375,19 @@ func compileRelationalOpExprAux(context *funcContext, reg int, expr *ast.Relatio
 	compileExprWithKMVPropagation(context, expr.Rhs, &reg, &c)
 	switch expr.Operator {
 	case "<":
-		code.AddABC(OP_LT, 0^flip, b, c, sline(expr))
+		code.AddABC(OP_LT, 0^flip, b, c, sline(expr), scol(expr))
 	case ">":
-		code.AddABC(OP_LT, 0^flip, c, b, sline(expr))
+		code.AddABC(OP_LT, 0^flip, c, b, sline(expr), scol(expr))
 	case "<=":
-		code.AddABC(OP_LE, 0^flip, b, c, sline(expr))
+		code.AddABC(OP_LE, 0^flip, b, c, sline(expr), scol(expr))
 	case ">=":
-		code.AddABC(OP_LE, 0^flip, c, b, sline(expr))
+		code.AddABC(OP_LE, 0^flip, c, b, sline(expr), scol(expr))
 	case "==":
-		code.AddABC(OP_EQ, 0^flip, b, c, sline(expr))
+		code.AddABC(OP_EQ, 0^flip, b, c, sline(expr), scol(expr))
 	case "~=":
-		code.AddABC(OP_EQ, 1^flip, b, c, sline(expr))
+		code.AddABC(OP_EQ, 1^flip, b, c, sline(expr), scol(expr))
 	}
-	code.AddASbx(OP_JMP, 0, label, sline(expr))
+	code.AddASbx(OP_JMP, 0, label, sline(expr), scol(expr))
 } // }}}
 
 func compileRelationalOpExpr(context *funcContext, reg int, expr *ast.RelationalOpExpr, ec *expcontext) { // {{{
@@ -1353,9 +1395,9 @@ func compileRelationalOpExpr(context *funcContext, reg int, expr *ast.Relational
 	code := context.Code
 	jumplabel := context.NewLabel()
 	compileRelationalOpExprAux(context, reg, expr, 1, jumplabel)
-	code.AddABC(OP_LOADBOOL, a, 0, 1, sline(expr))
+	code.AddABC(OP_LOADBOOL, a, 0, 1, sline(expr), scol(expr))
 	context.SetLabelPc(jumplabel, code.LastPC())
-	code.AddABC(OP_LOADBOOL, a, 1, 0, sline(expr))
+	code.AddABC(OP_LOADBOOL, a, 1, 0, sline(expr), scol(expr))
 } // }}}
 
 func compileLogicalOpExpr(context *funcContext, reg int, expr *ast.LogicalOpExpr, ec *expcontext) { // {{{
@@ -1376,9 +1418,9 @@ func compileLogicalOpExpr(context *funcContext, reg int, expr *ast.LogicalOpExpr
 
 	if lb.b {
 		context.SetLabelPc(lb.f, code.LastPC())
-		code.AddABC(OP_LOADBOOL, a, 0, 1, sline(expr))
+		code.AddABC(OP_LOADBOOL, a, 0, 1, sline(expr), scol(expr))
 		context.SetLabelPc(lb.t, code.LastPC())
-		code.AddABC(OP_LOADBOOL, a, 1, 0, sline(expr))
+		code.AddABC(OP_LOADBOOL, a, 1, 0, sline(expr), scol(expr))
 	}
 
 	lastinst := code.Last()
@@ -1402,34 +1444,34 @@ func compileLogicalOpExprAux(context *funcContext, reg int, expr ast.Expr, ec *e
 	switch ex := expr.(type) {
 	case *ast.FalseExpr:
 		if elselabel == lb.e {
-			code.AddASbx(OP_JMP, 0, lb.f, sline(expr))
+			code.AddASbx(OP_JMP, 0, lb.f, sline(expr), scol(expr))
 			lb.b = true
 		} else {
-			code.AddASbx(OP_JMP, 0, elselabel, sline(expr))
+			code.AddASbx(OP_JMP, 0, elselabel, sline(expr), scol(expr))
 		}
 		return
 	case *ast.NilExpr:
 		if elselabel == lb.e {
 			compileExpr(context, reg, expr, ec)
-			code.AddASbx(OP_JMP, 0, lb.e, sline(expr))
+			code.AddASbx(OP_JMP, 0, lb.e, sline(expr), scol(expr))
 		} else {
-			code.AddASbx(OP_JMP, 0, elselabel, sline(expr))
+			code.AddASbx(OP_JMP, 0, elselabel, sline(expr), scol(expr))
 		}
 		return
 	case *ast.TrueExpr:
 		if thenlabel == lb.e {
-			code.AddASbx(OP_JMP, 0, lb.t, sline(expr))
+			code.AddASbx(OP_JMP, 0, lb.t, sline(expr), scol(expr))
 			lb.b = true
 		} else {
-			code.AddASbx(OP_JMP, 0, thenlabel, sline(expr))
+			code.AddASbx(OP_JMP, 0, thenlabel, sline(expr), scol(expr))
 		}
 		return
 	case *ast.NumberExpr, *ast.StringExpr:
 		if thenlabel == lb.e {
 			compileExpr(context, reg, expr, ec)
-			code.AddASbx(OP_JMP, 0, lb.e, sline(expr))
+			code.AddASbx(OP_JMP, 0, lb.e, sline(expr), scol(expr))
 		} else {
-			code.AddASbx(OP_JMP, 0, thenlabel, sline(expr))
+			code.AddASbx(OP_JMP, 0, thenlabel, sline(expr), scol(expr))
 		}
 		return
 	case *ast.LogicalOpExpr:
@@ -1470,17 +1512,17 @@ func compileLogicalOpExprAux(context *funcContext, reg int, expr ast.Expr, ec *e
 		if opGetOpCode(last) == OP_MOVE && opGetArgA(last) == a {
 			context.Code.SetA(context.Code.LastPC(), sreg)
 		} else {
-			context.Code.AddABC(OP_MOVE, sreg, a, 0, sline(expr))
+			context.Code.AddABC(OP_MOVE, sreg, a, 0, sline(expr), scol(expr))
 		}
 	} else {
 		reg += compileExpr(context, reg, expr, ecnone(0))
 		if sreg == a {
-			code.AddABC(OP_TEST, a, 0, 0^flip, sline(expr))
+			code.AddABC(OP_TEST, a, 0, 0^flip, sline(expr), scol(expr))
 		} else {
-			code.AddABC(OP_TESTSET, sreg, a, 0^flip, sline(expr))
+			code.AddABC(OP_TESTSET, sreg, a, 0^flip, sline(expr), scol(expr))
 		}
 	}
-	code.AddASbx(OP_JMP, 0, jumplabel, sline(expr))
+	code.AddASbx(OP_JMP, 0, jumplabel, sline(expr), scol(expr))
 } // }}}
 
 func compileFuncCallExpr(context *funcContext, reg int, expr *ast.FuncCallExpr, ec *expcontext) int { // {{{
@@ -1492,6 +1534,7 @@ func compileFuncCallExpr(context *funcContext, reg int, expr *ast.FuncCallExpr,
 	argc := len(expr.Args)
 	islastvararg := false
 	name := "(anonymous)"
+	op := opNode(expr)
 
 	if expr.Func != nil { // hoge.func()
 		reg += compileExpr(context, reg, expr.Func, ecnone(0))
@@ -1500,7 +1543,7 @@ func compileFuncCallExpr(context *funcContext, reg int, expr *ast.FuncCallExpr,
 		b := reg
 		compileExprWithMVPropagation(context, expr.Receiver, &reg, &b)
 		c := loadRk(context, &reg, expr, LString(expr.Method))
-		context.Code.AddABC(OP_SELF, funcreg, b, c, sline(expr))
+		context.Code.AddABC(OP_SELF, funcreg, b, c, sline(op), scol(op))
 		// increments a register for an implicit "self"
 		reg = b + 1
 		reg2 := funcreg + 2
@@ -1523,11 +1566,11 @@ func compileFuncCallExpr(context *funcContext, reg int, expr *ast.FuncCallExpr,
 	if islastvararg {
 		b = 0
 	}
-	context.Code.AddABC(OP_CALL, funcreg, b, ec.varargopt+2, sline(expr))
+	context.Code.AddABC(OP_CALL, funcreg, b, ec.varargopt+2, sline(op), scol(op))
 	context.Proto.DbgCalls = append(context.Proto.DbgCalls, DbgCall{Pc: context.Code.LastPC(), Name: name})
 
 	if ec.varargopt == 0 && shouldmove(ec, funcreg) {
-		context.Code.AddABC(OP_MOVE, ec.reg, funcreg, 0, sline(expr))
+		context.Code.AddABC(OP_MOVE, ec.reg, funcreg, 0, sline(op), scol(op))
 		return 1
 	}
 	if context.RegTop() > (funcreg+2+ec.varargopt) || ec.varargopt < -1 {
@@ -1543,7 +1586,7 @@ func loadRk(context *funcContext, reg *int, expr ast.Expr, cnst LValue) int { //
 	} else {
 		ret := *reg
 		*reg++
-		context.Code.AddABx(OP_LOADK, ret, cindex, sline(expr))
+		context.Code.AddABx(OP_LOADK, ret, cindex, sline(expr), scol(expr))
 		return ret
 	}
 } // }}}
@@ -0,0 +1,180 @@
+package lua
+
+import (
+	"fmt"
+)
+
+// Shareable is implemented by rocks that may be used by several states at the same time.
+// LightUserData holding such a rock is copied by reference between states.
+type Shareable interface {
+	Shareable() bool
+}
+
+// CopyValue copies v into dst so that it can be used there independently of the state it
+// was created in.
+//
+// Tables are copied deeply, and cyclic or shared tables are copied once. The metatable of a
+// table is replaced by the metatable registered under the same name in dst by
+// NewTypeMetatable. Lua functions without upvalues are re-instantiated from their prototype
+// in dst; Go functions without upvalues are shared. LightUserData are passed by reference
+// when their rock implements Shareable and reports true. Strings, numbers, booleans and
+// channels are immutable or safe to share and are returned as they are. Any other value,
+// such as userdata, threads or functions with upvalues, results in an error.
+func CopyValue(dst *LState, v LValue) (LValue, error) {
+	return newValueCopier(nil, dst).copy(v)
+}
+
+// valueCopier copies values from one state into another as CopyValue does. When upvalues is
+// true, the upvalues of functions are copied as well. When the source state is known, the
+// globals table and the tables in package.loaded are mapped to their counterparts in the
+// destination state instead of being copied.
+type valueCopier struct {
+	dst         *LState
+	withUpvalue bool
+	seen        map[LValue]LValue
+	upvalues    map[*Upvalue]*Upvalue
+}
+
+func newValueCopier(src, dst *LState) *valueCopier {
+	c := &valueCopier{
+		dst:      dst,
+		seen:     map[LValue]LValue{},
+		upvalues: map[*Upvalue]*Upvalue{},
+	}
+	if src == nil || src.G == dst.G {
+		return c
+	}
+	c.withUpvalue = true
+	c.seen[src.G.Global] = dst.G.Global
+	c.seen[src.G.Registry] = dst.G.Registry
+	srcLoaded, ok1 := src.G.Registry.RawGetString("_LOADED").(*LTable)
+	dstLoaded, ok2 := dst.G.Registry.RawGetString("_LOADED").(*LTable)
+	if ok1 && ok2 {
+		c.seen[srcLoaded] = dstLoaded
+		srcLoaded.ForEach(func(key, value LValue) {
+			if mod := dstLoaded.RawGet(key); mod != LNil && value.Type() == mod.Type() {
+				c.seen[value] = mod
+			}
+		})
+	}
+	return c
+}
+
+func (c *valueCopier) copy(lv LValue) (LValue, error) {
+	switch v := lv.(type) {
+	case *LTable:
+		return c.copyTable(v)
+	case *LFunction:
+		return c.copyFunction(v)
+	case *UserKV:
+		ukv := &UserKV{}
+		for _, kv := range *v {
+			if kv.key == "" {
+				continue
+			}
+			val, err := c.copy(kv.val)
+			if err != nil {
+				return nil, err
+			}
+			ukv.Set(kv.key, val)
+		}
+		return ukv, nil
+	case *LightUserData:
+		if s, ok := v.Value.(Shareable); ok && s.Shareable() {
+			return v, nil
+		}
+		return nil, fmt.Errorf("can not copy a userdata that is not shareable")
+	case *LUserData:
+		return nil, fmt.Errorf("can not copy a userdata")
+	case *LState:
+		return nil, fmt.Errorf("can not copy a thread")
+	case nil:
+		return LNil, nil
+	default:
+		return lv, nil
+	}
+}
+
+func (c *valueCopier) copyTable(v *LTable) (LValue, error) {
+	if cv, ok := c.seen[v]; ok {
+		return cv, nil
+	}
+	tb := c.dst.CreateTable(len(v.array), len(v.dict)+len(v.strdict))
+	c.seen[v] = tb
+	if mt, ok := v.Metatable.(*LTable); ok {
+		cmt, ok := c.seen[mt]
+		if !ok {
+			name, isstr := mt.RawGetString("__name").(LString)
+			if !isstr {
+				return nil, fmt.Errorf("can not copy a table that has an unregistered metatable")
+			}
+			if cmt, ok = c.dst.GetTypeMetatable(string(name)).(*LTable); !ok {
+				return nil, fmt.Errorf("can not copy a table that has a metatable: %s is not registered", string(name))
+			}
+		}
+		tb.Metatable = cmt
+	}
+
+	var err error
+	v.ForEach(func(key, value LValue) {
+		if err != nil {
+			return
+		}
+		var ckey, cvalue LValue
+		if ckey, err = c.copy(key); err != nil {
+			return
+		}
+		if cvalue, err = c.copy(value); err != nil {
+			return
+		}
+		tb.RawSet(ckey, cvalue)
+	})
+	if err != nil {
+		return nil, err
+	}
+	tb.frozen = v.frozen
+	return tb, nil
+}
+
+func (c *valueCopier) copyFunction(v *LFunction) (LValue, error) {
+	if cv, ok := c.seen[v]; ok {
+		return cv, nil
+	}
+	if !c.withUpvalue && len(v.Upvalues) > 0 {
+		return nil, fmt.Errorf("can not copy a function that has upvalues")
+	}
+	var fn *LFunction
+	if v.IsG {
+		fn = newLFunctionG(v.GFunction, c.dst.Env, len(v.Upvalues))
+	} else {
+		fn = newLFunctionL(v.Proto, c.dst.Env, len(v.Upvalues))
+	}
+	c.seen[v] = fn
+	if !c.withUpvalue {
+		return fn, nil
+	}
+
+	env, err := c.copy(v.Env)
+	if err != nil {
+		return nil, err
+	}
+	if tb, ok := env.(*LTable); ok {
+		fn.Env = tb
+	}
+	for i, uv := range v.Upvalues {
+		if uv == nil {
+			continue
+		}
+		if cuv, ok := c.upvalues[uv]; ok {
+			fn.Upvalues[i] = cuv
+			continue
+		}
+		cuv := &Upvalue{closed: true, value: LNil}
+		c.upvalues[uv] = cuv
+		if cuv.value, err = c.copy(uv.Value()); err != nil {
+			return nil, err
+		}
+		fn.Upvalues[i] = cuv
+	}
+	return fn, nil
+}
@@ -0,0 +1,90 @@
+package lua
+
+import (
+	"testing"
+)
+
+type shareableRock struct {
+	Super
+	shared bool
+}
+
+func (r *shareableRock) Shareable() bool { return r.shared }
+
+func TestCopyValue(t *testing.T) {
+	src := NewState()
+	defer src.Close()
+	dst := NewState()
+	defer dst.Close()
+	for _, L := range []*LState{src, dst} {
+		mt := L.NewTypeMetatable("point")
+		L.SetField(mt, "__index", mt)
+		L.SetField(mt, "sum", L.NewFunction(func(L *LState) int {
+			tb := L.CheckTable(1)
+			L.Push(tb.RawGetString("x").(LNumber) + tb.RawGetString("y").(LNumber))
+			return 1
+		}))
+	}
+	errorIfScriptFail(t, src, `
+    value = {name = "v", list = {1, 2, 3}, nested = {deep = {true}}}
+    value.self = value
+    value.shared = value.list
+    value.double = function(x) return x * 2 end
+    value.print = print
+    `)
+	value := src.GetGlobal("value").(*LTable)
+	point := src.NewTable()
+	point.RawSetString("x", LNumber(1))
+	point.RawSetString("y", LNumber(2))
+	point.Metatable = src.GetTypeMetatable("point")
+	value.RawSetString("point", point)
+	ch := make(chan LValue)
+	value.RawSetString("ch", LChannel(ch))
+	value.RawSetString("rock", src.NewLightUserData(&shareableRock{shared: true}))
+
+	cv, err := CopyValue(dst, value)
+	errorIfNotNil(t, err)
+	errorIfFalse(t, cv != LValue(value), "copy expected")
+	dst.SetGlobal("value", cv)
+	errorIfScriptFail(t, dst, `
+    assert(value.name == "v")
+    assert(value.self == value)
+    assert(value.shared == value.list and #value.list == 3)
+    assert(value.nested.deep[1] == true)
+    assert(value.double(21) == 42)
+    assert(value.print ~= print and type(value.print) == "function")
+    assert(value.point:sum() == 3)
+    `)
+	errorIfNotEqual(t, dst.GetTypeMetatable("point"), cv.(*LTable).RawGetString("point").(*LTable).Metatable)
+	errorIfNotEqual(t, LChannel(ch), cv.(*LTable).RawGetString("ch"))
+	errorIfNotEqual(t, value.RawGetString("rock"), cv.(*LTable).RawGetString("rock"))
+
+	dst2 := NewState()
+	defer dst2.Close()
+	_, err = CopyValue(dst2, value)
+	errorIfNotEqual(t, "can not copy a table that has a metatable: point is not registered", err.Error())
+}
+
+func TestCopyValueErrors(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	errorIfScriptFail(t, L, `
+    local up = 1
+    closure = {function() return up end}
+    plain = setmetatable({}, {})
+    `)
+	for _, test := range []struct {
+		value LValue
+		msg   string
+	}{
+		{L.GetGlobal("closure"), "can not copy a function that has upvalues"},
+		{L.GetGlobal("plain"), "can not copy a table that has an unregistered metatable"},
+		{L.NewUserData(), "can not copy a userdata"},
+		{L.NewLightUserData(&shareableRock{}), "can not copy a userdata that is not shareable"},
+		{L, "can not copy a thread"},
+	} {
+		_, err := CopyValue(L, test.value)
+		errorIfNil(t, err)
+		errorIfNotEqual(t, test.msg, err.Error())
+	}
+}
@@ -0,0 +1,65 @@
+package lua
+
+const lErrorClass = "ERROR*"
+
+// goError is the value of an error object, a userdata that wraps a Go error.
+type goError struct {
+	err   error
+	where string
+}
+
+func (e *goError) String() string {
+	if len(e.where) > 0 {
+		return e.where + " " + e.err.Error()
+	}
+	return e.err.Error()
+}
+
+// NewError returns an error object that wraps err. Raised with Error, it keeps err as the
+// Cause of the ApiError; tostring converts it to the message of err.
+func (ls *LState) NewError(err error) *LUserData {
+	return ls.newGoError(err, "")
+}
+
+func (ls *LState) newGoError(err error, where string) *LUserData {
+	mt := ls.NewTypeMetatable(lErrorClass)
+	if mt.RawGetString("__tostring") == LNil {
+		mt.RawSetString("__tostring", ls.NewFunction(errorToString))
+		mt.RawSetString("__concat", ls.NewFunction(errorConcat))
+	}
+	ud := ls.NewUserData()
+	ud.Value = &goError{err: err, where: where}
+	ud.Metatable = mt
+	return ud
+}
+
+// goErrorCause returns the Go error wrapped by an error object, or nil.
+func goErrorCause(lv LValue) error {
+	if ud, ok := lv.(*LUserData); ok {
+		if e, ok := ud.Value.(*goError); ok {
+			return e.err
+		}
+	}
+	return nil
+}
+
+// errorObjectString returns the message of an error value.
+func errorObjectString(lv LValue) string {
+	if ud, ok := lv.(*LUserData); ok {
+		if e, ok := ud.Value.(*goError); ok {
+			return e.String()
+		}
+	}
+	return lv.String()
+}
+
+func errorToString(L *LState) int {
+	L.Push(LString(errorObjectString(L.CheckUserData(1))))
+	return 1
+}
+
+func errorConcat(L *LState) int {
+	a, b := L.Get(1), L.Get(2)
+	L.Push(LString(L.ToStringMeta(a).String() + L.ToStringMeta(b).String()))
+	return 1
+}
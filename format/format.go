@@ -0,0 +1,576 @@
+// Package format prints Lua syntax trees as Lua source in a canonical style.
+//
+// The output is indented with two spaces, has one statement per line and uses the minimal
+// parentheses. Table constructors are kept on one line when they fit in 80 columns. The
+// comments attached by parse.ParseWithComments are printed along the statements, and a
+// single empty line is kept where the source had one or more.
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/edunx/lua/ast"
+	"github.com/edunx/lua/parse"
+)
+
+const (
+	indentString = "  "
+	maxWidth     = 80
+)
+
+// Source parses and formats a Lua chunk. name is used in the parse errors.
+func Source(src []byte, name string) ([]byte, error) {
+	chunk, err := parse.ParseWithComments(bytes.NewReader(src), name)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := Fprint(&buf, chunk); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Fprint formats a chunk and writes the result to w.
+func Fprint(w io.Writer, chunk []ast.Stmt) error {
+	p := &printer{}
+	p.block(chunk)
+	_, err := w.Write(p.buf.Bytes())
+	return err
+}
+
+type printer struct {
+	buf    bytes.Buffer
+	indent int
+	// inner holds the comments of the current statement that go into its first empty block.
+	inner []*ast.Comment
+	// flat is set when trying to print an expression on a single line, failed is set when
+	// it can not be.
+	flat   bool
+	failed bool
+}
+
+func (p *printer) print(args ...string) {
+	for _, s := range args {
+		p.buf.WriteString(s)
+	}
+}
+
+func (p *printer) writeIndent() {
+	for i := 0; i < p.indent; i++ {
+		p.buf.WriteString(indentString)
+	}
+}
+
+// insert inserts s at the offset pos of the output.
+func (p *printer) insert(pos int, s string) {
+	tail := append([]byte(nil), p.buf.Bytes()[pos:]...)
+	p.buf.Truncate(pos)
+	p.buf.WriteString(s)
+	p.buf.Write(tail)
+}
+
+func (p *printer) column() int {
+	b := p.buf.Bytes()
+	return len(b) - bytes.LastIndexByte(b, '\n') - 1
+}
+
+func (p *printer) comment(c *ast.Comment, blank bool) {
+	if blank && c.EmptyLineBefore {
+		p.print("\n")
+	}
+	p.writeIndent()
+	p.print(c.Text, "\n")
+}
+
+func (p *printer) block(stmts []ast.Stmt) {
+	if len(stmts) == 0 {
+		for i, c := range p.inner {
+			p.comment(c, i > 0)
+		}
+		p.inner = nil
+		return
+	}
+	for i, stmt := range stmts {
+		p.stmt(stmt, i)
+	}
+}
+
+// body prints a block followed by the indentation of the closing keyword. An empty block
+// is printed as a single space if compact is set.
+func (p *printer) body(stmts []ast.Stmt, compact bool) {
+	if p.flat {
+		if len(stmts) > 0 || len(p.inner) > 0 {
+			p.failed = true
+		}
+		p.print(" ")
+		return
+	}
+	if compact && len(stmts) == 0 && len(p.inner) == 0 {
+		p.print(" ")
+		return
+	}
+	p.print("\n")
+	p.indent++
+	p.block(stmts)
+	p.indent--
+	p.writeIndent()
+}
+
+func (p *printer) stmt(stmt ast.Stmt, index int) {
+	comments := stmt.Comments()
+	for i, c := range comments.Leading {
+		p.comment(c, index > 0 || i > 0)
+	}
+	if comments.EmptyLineBefore && (index > 0 || len(comments.Leading) > 0) {
+		p.print("\n")
+	}
+
+	var inner, eol, after []*ast.Comment
+	end := ast.EndLine(stmt)
+	for _, c := range comments.Trailing {
+		switch {
+		case c.Line() < end:
+			inner = append(inner, c)
+		case c.Inline:
+			eol = append(eol, c)
+		default:
+			after = append(after, c)
+		}
+	}
+
+	saved := p.inner
+	p.inner = inner
+	p.writeIndent()
+	pos := p.buf.Len()
+	p.stmtBody(stmt)
+	if index > 0 && p.buf.Bytes()[pos] == '(' {
+		// avoid the ambiguity with a call of the previous statement.
+		p.insert(pos, ";")
+	}
+	eol = append(p.inner, eol...)
+	p.inner = saved
+
+	if len(eol) > 0 {
+		p.print(" ", eol[0].Text)
+		after = append(eol[1:], after...)
+	}
+	p.print("\n")
+	for _, c := range after {
+		p.comment(c, true)
+	}
+}
+
+func (p *printer) stmtBody(stmt ast.Stmt) {
+	switch s := stmt.(type) {
+	case *ast.AssignStmt:
+		p.exprs(s.Lhs)
+		p.print(" = ")
+		p.exprs(s.Rhs)
+	case *ast.LocalAssignStmt:
+		if len(s.Names) == 1 && len(s.Exprs) == 1 {
+			if fn, ok := s.Exprs[0].(*ast.FunctionExpr); ok {
+				p.print("local function ", s.Names[0])
+				p.funcBody(fn)
+				return
+			}
+		}
+		p.print("local ", strings.Join(s.Names, ", "))
+		if len(s.Exprs) > 0 {
+			p.print(" = ")
+			p.exprs(s.Exprs)
+		}
+	case *ast.FuncCallStmt:
+		p.expr(s.Expr)
+	case *ast.DoBlockStmt:
+		p.print("do")
+		p.body(s.Stmts, true)
+		p.print("end")
+	case *ast.WhileStmt:
+		p.print("while ")
+		p.expr(s.Condition)
+		p.print(" do")
+		p.body(s.Stmts, true)
+		p.print("end")
+	case *ast.RepeatStmt:
+		p.print("repeat")
+		p.body(s.Stmts, true)
+		p.print("until ")
+		p.expr(s.Condition)
+	case *ast.IfStmt:
+		p.ifStmt(s)
+	case *ast.NumberForStmt:
+		p.print("for ", s.Name, " = ")
+		p.expr(s.Init)
+		p.print(", ")
+		p.expr(s.Limit)
+		if s.Step != nil {
+			p.print(", ")
+			p.expr(s.Step)
+		}
+		p.print(" do")
+		p.body(s.Stmts, true)
+		p.print("end")
+	case *ast.GenericForStmt:
+		p.print("for ", strings.Join(s.Names, ", "), " in ")
+		p.exprs(s.Exprs)
+		p.print(" do")
+		p.body(s.Stmts, true)
+		p.print("end")
+	case *ast.FuncDefStmt:
+		p.print("function ")
+		if s.Name.Func != nil {
+			p.expr(s.Name.Func)
+		} else {
+			p.expr(s.Name.Receiver)
+			p.print(":", s.Name.Method)
+		}
+		p.funcBody(s.Func)
+	case *ast.ReturnStmt:
+		p.print("return")
+		if len(s.Exprs) > 0 {
+			p.print(" ")
+			p.exprs(s.Exprs)
+		}
+	case *ast.BreakStmt:
+		p.print("break")
+	default:
+		panic(fmt.Sprintf("format: unknown statement %T", stmt))
+	}
+}
+
+func (p *printer) ifStmt(s *ast.IfStmt) {
+	compact := len(s.Else) == 0 && s.ElseLine == 0
+	p.print("if ")
+	for cur := s; ; {
+		p.expr(cur.Condition)
+		p.print(" then")
+		// the comments from the else keyword on go into the else part.
+		var rest []*ast.Comment
+		if cur.ElseLine > 0 {
+			for i, c := range p.inner {
+				if c.Line() >= cur.ElseLine {
+					p.inner, rest = p.inner[:i:i], p.inner[i:]
+					break
+				}
+			}
+		}
+		p.body(cur.Then, compact)
+		p.inner = append(p.inner, rest...)
+		if len(cur.Else) == 0 && cur.ElseLine == 0 {
+			break
+		}
+		if elseif := cur.ElseIf(); elseif != nil {
+			// the comments of an elseif are the comments of its empty block.
+			p.inner = append(p.inner, elseif.Comments().Trailing...)
+			p.print("elseif ")
+			cur = elseif
+			continue
+		}
+		p.print("else")
+		p.body(cur.Else, false)
+		break
+	}
+	p.print("end")
+}
+
+func (p *printer) funcBody(fn *ast.FunctionExpr) {
+	names := fn.ParList.Names
+	if fn.ParList.HasVargs {
+		names = append(append([]string{}, names...), "...")
+	}
+	p.print("(", strings.Join(names, ", "), ")")
+	p.body(fn.Stmts, true)
+	p.print("end")
+}
+
+func (p *printer) exprs(exprs []ast.Expr) {
+	for i, expr := range exprs {
+		if i > 0 {
+			p.print(", ")
+		}
+		p.expr(expr)
+	}
+}
+
+// precedence returns the binding power of an operator expression, or maxPrecedence for
+// the other expressions.
+func precedence(expr ast.Expr) int {
+	switch e := expr.(type) {
+	case *ast.LogicalOpExpr:
+		if e.Operator == "or" {
+			return 1
+		}
+		return 2
+	case *ast.RelationalOpExpr:
+		return 3
+	case *ast.StringConcatOpExpr:
+		return 4
+	case *ast.ArithmeticOpExpr:
+		switch e.Operator {
+		case "+", "-":
+			return 5
+		case "^":
+			return 8
+		}
+		return 6
+	case *ast.UnaryMinusOpExpr, *ast.UnaryNotOpExpr, *ast.UnaryLenOpExpr:
+		return unaryPrecedence
+	}
+	return maxPrecedence
+}
+
+const (
+	unaryPrecedence = 7
+	maxPrecedence   = 9
+)
+
+func (p *printer) operand(expr ast.Expr, paren bool) {
+	if paren {
+		p.print("(")
+		p.expr(expr)
+		p.print(")")
+		return
+	}
+	p.expr(expr)
+}
+
+func (p *printer) binary(expr ast.Expr, op string, lhs, rhs ast.Expr) {
+	prec := precedence(expr)
+	right := prec == 4 || prec == 8
+	lp, rp := precedence(lhs), precedence(rhs)
+	p.operand(lhs, lp < prec || lp == prec && right)
+	p.print(" ", op, " ")
+	if prec == 8 && rp == unaryPrecedence {
+		// 2 ^ -x
+		p.expr(rhs)
+		return
+	}
+	p.operand(rhs, rp < prec || rp == prec && !right)
+}
+
+func (p *printer) unary(op string, operand ast.Expr) {
+	p.print(op)
+	pos := p.buf.Len()
+	p.operand(operand, precedence(operand) < unaryPrecedence)
+	if op == "-" && p.buf.Bytes()[pos] == '-' {
+		p.insert(pos, " ")
+	}
+}
+
+// prefix prints the expression before an index or a call.
+func (p *printer) prefix(expr ast.Expr) {
+	switch expr.(type) {
+	case *ast.IdentExpr, *ast.AttrGetExpr, *ast.FuncCallExpr:
+		p.expr(expr)
+	default:
+		p.operand(expr, true)
+	}
+}
+
+func (p *printer) expr(expr ast.Expr) {
+	switch e := expr.(type) {
+	case *ast.TrueExpr:
+		p.print("true")
+	case *ast.FalseExpr:
+		p.print("false")
+	case *ast.NilExpr:
+		p.print("nil")
+	case *ast.NumberExpr:
+		p.print(e.Value)
+	case *ast.StringExpr:
+		p.str(e.Value)
+	case *ast.Comma3Expr:
+		p.print("...")
+	case *ast.IdentExpr:
+		p.print(e.Value)
+	case *ast.AttrGetExpr:
+		p.prefix(e.Object)
+		if key, ok := e.Key.(*ast.StringExpr); ok && isName(key.Value) {
+			p.print(".", key.Value)
+		} else {
+			p.print("[")
+			p.expr(e.Key)
+			p.print("]")
+		}
+	case *ast.TableExpr:
+		p.table(e)
+	case *ast.FuncCallExpr:
+		if e.AdjustRet {
+			p.print("(")
+		}
+		if e.Func != nil {
+			p.prefix(e.Func)
+		} else {
+			p.prefix(e.Receiver)
+			p.print(":", e.Method)
+		}
+		p.print("(")
+		p.exprs(e.Args)
+		p.print(")")
+		if e.AdjustRet {
+			p.print(")")
+		}
+	case *ast.LogicalOpExpr:
+		p.binary(e, e.Operator, e.Lhs, e.Rhs)
+	case *ast.RelationalOpExpr:
+		p.binary(e, e.Operator, e.Lhs, e.Rhs)
+	case *ast.StringConcatOpExpr:
+		p.binary(e, "..", e.Lhs, e.Rhs)
+	case *ast.ArithmeticOpExpr:
+		p.binary(e, e.Operator, e.Lhs, e.Rhs)
+	case *ast.UnaryMinusOpExpr:
+		p.unary("-", e.Expr)
+	case *ast.UnaryNotOpExpr:
+		p.unary("not ", e.Expr)
+	case *ast.UnaryLenOpExpr:
+		p.unary("#", e.Expr)
+	case *ast.FunctionExpr:
+		p.print("function")
+		p.funcBody(e)
+	default:
+		panic(fmt.Sprintf("format: unknown expression %T", expr))
+	}
+}
+
+func (p *printer) table(t *ast.TableExpr) {
+	if len(t.Fields) == 0 {
+		p.print("{}")
+		return
+	}
+	if !p.flat {
+		line := &printer{indent: p.indent, flat: true}
+		line.fields(t.Fields)
+		if !line.failed && p.column()+line.buf.Len() <= maxWidth {
+			p.buf.Write(line.buf.Bytes())
+			return
+		}
+	}
+	if p.flat {
+		p.fields(t.Fields)
+		return
+	}
+	p.print("{\n")
+	p.indent++
+	for _, field := range t.Fields {
+		p.writeIndent()
+		p.field(field)
+		p.print(",\n")
+	}
+	p.indent--
+	p.writeIndent()
+	p.print("}")
+}
+
+func (p *printer) fields(fields []*ast.Field) {
+	p.print("{")
+	for i, field := range fields {
+		if i > 0 {
+			p.print(", ")
+		}
+		p.field(field)
+	}
+	p.print("}")
+}
+
+func (p *printer) field(field *ast.Field) {
+	if field.Key != nil {
+		if key, ok := field.Key.(*ast.StringExpr); ok && isName(key.Value) {
+			p.print(key.Value)
+		} else {
+			p.print("[")
+			p.expr(field.Key)
+			p.print("]")
+		}
+		p.print(" = ")
+	}
+	p.expr(field.Value)
+}
+
+var reservedWords = map[string]bool{
+	"and": true, "break": true, "do": true, "else": true, "elseif": true, "end": true,
+	"false": true, "for": true, "function": true, "if": true, "in": true, "local": true,
+	"nil": true, "not": true, "or": true, "repeat": true, "return": true, "then": true,
+	"true": true, "until": true, "while": true,
+}
+
+// isName reports whether s can be written as an identifier.
+func isName(s string) bool {
+	if s == "" || reservedWords[s] {
+		return false
+	}
+	for i, c := range []byte(s) {
+		if !(c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || i > 0 && '0' <= c && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *printer) str(s string) {
+	if strings.Contains(s, "\n") && isLongString(s) {
+		if p.flat {
+			p.failed = true
+		}
+		level := ""
+		for strings.Contains(s, "]"+level+"]") || strings.HasSuffix(s, "]"+level) {
+			level += "="
+		}
+		// the newline following the opening bracket is not part of the string.
+		p.print("[", level, "[\n", s, "]", level, "]")
+		return
+	}
+	p.print(quote(s))
+}
+
+// isLongString reports whether s can be written as a long string: it does not contain
+// control characters other than tabs and newlines.
+func isLongString(s string) bool {
+	for _, c := range []byte(s) {
+		if c < ' ' && c != '\t' && c != '\n' || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+func quote(s string) string {
+	q := byte('"')
+	if strings.IndexByte(s, '"') >= 0 && strings.IndexByte(s, '\'') < 0 {
+		q = '\''
+	}
+	var buf bytes.Buffer
+	buf.WriteByte(q)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case q, '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\a':
+			buf.WriteString(`\a`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\v':
+			buf.WriteString(`\v`)
+		default:
+			if c < ' ' || c == 0x7f {
+				fmt.Fprintf(&buf, `\%03d`, c)
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+	}
+	buf.WriteByte(q)
+	return buf.String()
+}
@@ -0,0 +1,109 @@
+package format
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/edunx/lua"
+	"github.com/edunx/lua/parse"
+)
+
+func formatFile(t *testing.T, name string) []byte {
+	src, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := Source(src, name)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	again, err := Source(out, name)
+	if err != nil {
+		t.Fatalf("%s: formatted source does not parse: %v", name, err)
+	}
+	if !bytes.Equal(out, again) {
+		t.Errorf("%s: formatting is not idempotent", name)
+	}
+	return out
+}
+
+func TestFormatScripts(t *testing.T) {
+	files, _ := filepath.Glob("../_lua5.1-tests/*.lua")
+	for _, file := range files {
+		if src, _ := os.ReadFile(file); bytes.HasPrefix(src, []byte("#")) {
+			continue
+		}
+		formatFile(t, file)
+	}
+
+	formatFile(t, "../_glua-tests/issues.lua")
+	// issues.lua and db.lua check line numbers, os.lua runs in the directory of the tests.
+	for _, name := range []string{"base.lua", "coroutine.lua", "table.lua", "vm.lua", "math.lua", "strings.lua", "re.lua"} {
+		out := formatFile(t, filepath.Join("../_glua-tests", name))
+		L := lua.NewState()
+		if err := L.DoString(string(out)); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		L.Close()
+	}
+}
+
+func TestFormat(t *testing.T) {
+	cases := []struct{ src, expected string }{
+		{"local   a=1+2*3", "local a = 1 + 2 * 3\n"},
+		{"x = (1+2)*3 y = 2^(-3) z = (-2)^2 w = - -x", "x = (1 + 2) * 3\ny = 2 ^ -3\nz = (-2) ^ 2\nw = - -x\n"},
+		{"x = a..(b..c) y = (a..b)..c z = a-(b-c) v = not (a==b)", "x = a .. b .. c\ny = (a .. b) .. c\nz = a - (b - c)\nv = not (a == b)\n"},
+		{"local t = {1,2;a=1,['b c']=2,[3]=4}", "local t = {1, 2, a = 1, [\"b c\"] = 2, [3] = 4}\n"},
+		{"local f = function(a, ...) return (g(...)) end", "local function f(a, ...)\n  return (g(...))\nend\n"},
+		{"if a then b() elseif c then else d() end", "if a then\n  b()\nelseif c then\nelse\n  d()\nend\n"},
+		{"a = 1;(f or g)()", "a = 1\n;(f or g)()\n"},
+		{"s = ('x'):rep(3) t = a['end'] u = \"it's\"", "s = (\"x\"):rep(3)\nt = a[\"end\"]\nu = \"it's\"\n"},
+		{"s = 'a\\n\"b\\0'", "s = 'a\\n\"b\\000'\n"},
+		{"s = [[\nline1\nline2]]", "s = [[\nline1\nline2]]\n"},
+		{"while true do end repeat x() until y", "while true do end\nrepeat\n  x()\nuntil y\n"},
+		{
+			"-- header\n\nlocal a = 1 -- one\n\n\n-- lead\nlocal function f() -- inside\nend\nreturn a\n-- tail",
+			"-- header\n\nlocal a = 1 -- one\n\n-- lead\nlocal function f()\n  -- inside\nend\nreturn a\n-- tail\n",
+		},
+		{
+			"for i=1,2 do\n  -- first\n  x()\n  -- last\nend",
+			"for i = 1, 2 do\n  -- first\n  x()\n  -- last\nend\n",
+		},
+		{"if a then -- c1\nelse -- c2\nend", "if a then\n  -- c1\nelse\n  -- c2\nend\n"},
+		{"if a then\n  x()\nelse\n  -- c\nend", "if a then\n  x()\nelse\n  -- c\nend\n"},
+		{"if a then\nelseif b then -- c1\nelse\n  -- c2\nend", "if a then\nelseif b then\n  -- c1\nelse\n  -- c2\nend\n"},
+	}
+	for _, c := range cases {
+		out, err := Source([]byte(c.src), "<string>")
+		if err != nil {
+			t.Fatalf("%q: %v", c.src, err)
+		}
+		if string(out) != c.expected {
+			t.Errorf("%q:\nexpected:\n%s\nbut got:\n%s", c.src, c.expected, out)
+		}
+	}
+
+	long := "local t = {" + strings.Repeat("\"aaaaaaaaaa\", ", 8) + "}"
+	out, _ := Source([]byte(long), "<string>")
+	if !strings.HasPrefix(string(out), "local t = {\n  \"aaaaaaaaaa\",\n") {
+		t.Errorf("long table is not split: %s", out)
+	}
+}
+
+func TestFprint(t *testing.T) {
+	chunk, err := parse.Parse(strings.NewReader("local x = {a = function() return 1 end}"), "<string>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := Fprint(&buf, chunk); err != nil {
+		t.Fatal(err)
+	}
+	expected := "local x = {\n  a = function()\n    return 1\n  end,\n}\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, but got %q", expected, buf.String())
+	}
+}
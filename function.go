@@ -35,9 +35,11 @@ type FunctionProto struct {
 	FunctionPrototypes []*FunctionProto
 
 	DbgSourcePositions []int
-	DbgLocals          []*DbgLocalInfo
-	DbgCalls           []DbgCall
-	DbgUpvalues        []string
+	// DbgSourceColumns holds the column of each instruction, or 0 if it is unknown.
+	DbgSourceColumns []int
+	DbgLocals        []*DbgLocalInfo
+	DbgCalls         []DbgCall
+	DbgUpvalues      []string
 
 	stringConstants []string
 }
@@ -101,6 +103,7 @@ func newFunctionProto(name string) *FunctionProto {
 		FunctionPrototypes: make([]*FunctionProto, 0, 16),
 
 		DbgSourcePositions: make([]int, 0, 128),
+		DbgSourceColumns:   make([]int, 0, 128),
 		DbgLocals:          make([]*DbgLocalInfo, 0, 16),
 		DbgCalls:           make([]DbgCall, 0, 128),
 		DbgUpvalues:        make([]string, 0, 16),
@@ -109,6 +112,14 @@ func newFunctionProto(name string) *FunctionProto {
 	}
 }
 
+// column returns the column of the instruction at pc, or 0 if it is unknown.
+func (fp *FunctionProto) column(pc int) int {
+	if pc < 0 || pc >= len(fp.DbgSourceColumns) {
+		return 0
+	}
+	return fp.DbgSourceColumns[pc]
+}
+
 func (fp *FunctionProto) String() string {
 	return fp.str(1, 0)
 }
@@ -0,0 +1,114 @@
+package lua
+
+import (
+	"fmt"
+	"reflect"
+)
+
+var (
+	lstateType = reflect.TypeOf((*LState)(nil))
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+type goFuncBinding struct {
+	fn        reflect.Value
+	withState bool
+	params    []reflect.Type
+	variadic  reflect.Type
+	nresults  int
+	retErr    bool
+}
+
+// NewGoFunc returns a Lua function that calls fn, which may be a Go function of any signature.
+// See GoFunc for the conversion rules.
+func (ls *LState) NewGoFunc(fn interface{}) *LFunction {
+	return ls.NewFunction(GoFunc(fn))
+}
+
+// GoFunc wraps a Go function of any signature into an LGFunction.
+//
+// If the first parameter of fn is an *LState, the calling state is passed to it. The other
+// parameters are converted from the Lua arguments as Unmarshal does, and a conversion failure
+// raises a "bad argument" error. Extra arguments are passed to the variadic parameter if fn has
+// one and are ignored otherwise. The results are converted as Marshal does. If the last result is
+// an error, the function returns nil and the error message when it is not nil, and the remaining
+// results (or true if there are none) otherwise.
+//
+// GoFunc panics if fn is not a function.
+func GoFunc(fn interface{}) LGFunction {
+	switch f := fn.(type) {
+	case LGFunction:
+		return f
+	case func(*LState) int:
+		return f
+	}
+	rv := reflect.ValueOf(fn)
+	if rv.Kind() != reflect.Func || rv.IsNil() {
+		panic(fmt.Sprintf("lua: function expected, got %T", fn))
+	}
+	return newGoFuncBinding(rv).call
+}
+
+func newGoFuncBinding(fn reflect.Value) *goFuncBinding {
+	ft := fn.Type()
+	b := &goFuncBinding{fn: fn, nresults: ft.NumOut()}
+	nin := ft.NumIn()
+	if ft.IsVariadic() {
+		nin--
+		b.variadic = ft.In(nin).Elem()
+	}
+	for i := 0; i < nin; i++ {
+		if i == 0 && ft.In(i) == lstateType {
+			b.withState = true
+			continue
+		}
+		b.params = append(b.params, ft.In(i))
+	}
+	if b.nresults > 0 && ft.Out(b.nresults-1) == errorType {
+		b.retErr = true
+		b.nresults--
+	}
+	return b
+}
+
+func (b *goFuncBinding) arg(L *LState, n int, t reflect.Type) reflect.Value {
+	rv := reflect.New(t).Elem()
+	u := &unmarshaler{}
+	if err := u.unmarshal(L.Get(n), rv); err != nil {
+		L.ArgError(n, err.Error())
+	}
+	return rv
+}
+
+func (b *goFuncBinding) call(L *LState) int {
+	args := make([]reflect.Value, 0, len(b.params)+1)
+	if b.withState {
+		args = append(args, reflect.ValueOf(L))
+	}
+	for i, t := range b.params {
+		args = append(args, b.arg(L, i+1, t))
+	}
+	if b.variadic != nil {
+		for n := len(b.params) + 1; n <= L.GetTop(); n++ {
+			args = append(args, b.arg(L, n, b.variadic))
+		}
+	}
+
+	results := b.fn.Call(args)
+	if b.retErr {
+		if err := results[b.nresults]; !err.IsNil() {
+			L.Push(LNil)
+			L.Push(LString(err.Interface().(error).Error()))
+			return 2
+		}
+		if b.nresults == 0 {
+			L.Push(LTrue)
+			return 1
+		}
+	}
+	m := &marshaler{L: L, seen: map[seenKey]*LTable{}}
+	for _, result := range results[:b.nresults] {
+		L.Push(m.marshal(result))
+	}
+	return b.nresults
+}
@@ -0,0 +1,71 @@
+package lua
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNewGoFunc(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	L.SetGlobal("add", L.NewGoFunc(func(a, b int) int { return a + b }))
+	L.SetGlobal("join", L.NewGoFunc(func(sep string, parts ...string) string {
+		return strings.Join(parts, sep)
+	}))
+	L.SetGlobal("div", L.NewGoFunc(func(a, b float64) (float64, error) {
+		if b == 0 {
+			return 0, errors.New("division by zero")
+		}
+		return a / b, nil
+	}))
+	L.SetGlobal("check", L.NewGoFunc(func(ok bool) error {
+		if !ok {
+			return errors.New("not ok")
+		}
+		return nil
+	}))
+	L.SetGlobal("top", L.NewGoFunc(func(L *LState, tb map[string]int) (int, int) {
+		return L.GetTop(), tb["a"]
+	}))
+	L.SetGlobal("server", L.NewGoFunc(func(s testServer) *testServer {
+		s.Port++
+		return &s
+	}))
+	L.SetGlobal("apply", L.NewGoFunc(func(L *LState, fn *LFunction, v LValue) LValue {
+		L.Push(fn)
+		L.Push(v)
+		L.Call(1, 1)
+		return L.Get(-1)
+	}))
+	errorIfScriptFail(t, L, `
+	assert(add(1, 2) == 3)
+	assert(add("1", 2) == 3)
+	assert(join(",") == "")
+	assert(join(",", "a", "b", 1) == "a,b,1")
+	assert(div(1, 2) == 0.5)
+	local v, msg = div(1, 0)
+	assert(v == nil and msg == "division by zero")
+	assert(check(true) == true)
+	local ok, msg = check(false)
+	assert(ok == nil and msg == "not ok")
+	local n, a = top({a = 7}, "ignored")
+	assert(n == 2 and a == 7)
+	local s = server({host = "h", port = 80})
+	assert(s.host == "h" and s.port == 81)
+	assert(apply(function(x) return x * 2 end, 21) == 42)
+	`)
+	errorIfScriptNotFail(t, L, `add(1)`, `bad argument #2 to add \(number expected, got nil\)`)
+	errorIfScriptNotFail(t, L, `add(1.5, 1)`, `bad argument #1 to add \(number has no integer representation: 1.5\)`)
+	errorIfScriptNotFail(t, L, `join(",", "a", {})`, `bad argument #3 to join \(string expected, got table\)`)
+	L.SetGlobal("keys", L.NewGoFunc(func(v interface{}) int { return len(v.(map[string]interface{})) }))
+	errorIfScriptNotFail(t, L, `local t = {}; t.t = t; keys(t)`, `bad argument #1 to keys \(t: cyclic table\)`)
+	errorIfScriptNotFail(t, L, `server({port = "x"})`, `bad argument #1 to server \(port: number expected, got string\)`)
+}
+
+func TestGoFuncNotFunction(t *testing.T) {
+	defer func() {
+		errorIfNil(t, recover())
+	}()
+	GoFunc(1)
+}
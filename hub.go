@@ -0,0 +1,267 @@
+package lua
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// HubPolicy tells a Hub what to do when the channel of a subscriber is full.
+type HubPolicy int
+
+const (
+	// HubDropOldest drops the oldest message in the channel of a slow subscriber.
+	HubDropOldest HubPolicy = iota
+	// HubBlock waits until a slow subscriber has room for the message.
+	HubBlock
+)
+
+// TopicStats holds the counters of a topic. A hub keeps the counters of a topic while a
+// subscription matches it, so that topics with dynamic names do not pile up.
+type TopicStats struct {
+	// Published is the number of messages published to the topic.
+	Published uint64
+	// Delivered is the number of messages delivered to subscribers.
+	Delivered uint64
+	// Dropped is the number of messages dropped because a subscriber was too slow.
+	Dropped uint64
+}
+
+// Subscription is a channel that receives the messages published to the topics matching its pattern.
+type Subscription struct {
+	C       LChannel
+	pattern []string
+	hub     *Hub
+	mu      sync.RWMutex
+	done    chan struct{}
+	closed  bool
+}
+
+// Hub delivers messages published to a topic to every subscription whose pattern matches
+// it. Topics are dot-separated names such as "log.error". In patterns, "*" matches a single
+// segment and a trailing "#" matches any number of remaining segments.
+type Hub struct {
+	policy HubPolicy
+	mu     sync.RWMutex
+	subs   map[LChannel]*Subscription
+	stats  map[string]*TopicStats
+}
+
+func NewHub(policy HubPolicy) *Hub {
+	return &Hub{
+		policy: policy,
+		subs:   make(map[LChannel]*Subscription),
+		stats:  make(map[string]*TopicStats),
+	}
+}
+
+// Hub returns the hub used by the hub library: Options.Hub, or a hub created on first use.
+// Coroutines of a state share its hub.
+func (ls *LState) Hub() *Hub {
+	if ls.G.hub == nil {
+		ls.G.hub = ls.Options.Hub
+		if ls.G.hub == nil {
+			ls.G.hub = NewHub(HubDropOldest)
+		}
+	}
+	return ls.G.hub
+}
+
+// Subscribe creates a subscription to the topics matching pattern, with a channel of the given buffer size.
+func (h *Hub) Subscribe(pattern string, bufsize int) *Subscription {
+	sub := &Subscription{
+		C:       LChannel(make(chan LValue, bufsize)),
+		pattern: strings.Split(pattern, "."),
+		hub:     h,
+		done:    make(chan struct{}),
+	}
+	h.mu.Lock()
+	h.subs[sub.C] = sub
+	h.mu.Unlock()
+	return sub
+}
+
+// Unsubscribe removes the subscription that owns the channel ch. It returns false if there is none.
+func (h *Hub) Unsubscribe(ch LChannel) bool {
+	h.mu.Lock()
+	sub, ok := h.subs[ch]
+	if ok {
+		delete(h.subs, ch)
+		h.dropStats(sub)
+	}
+	h.mu.Unlock()
+	if ok {
+		sub.close()
+	}
+	return ok
+}
+
+// dropStats removes the counters of the topics matched by sub and by no other subscription.
+// h.mu must be held.
+func (h *Hub) dropStats(sub *Subscription) {
+	for topic := range h.stats {
+		segs := strings.Split(topic, ".")
+		if sub.match(segs) && len(h.match(segs)) == 0 {
+			delete(h.stats, topic)
+		}
+	}
+}
+
+// Unsubscribe removes the subscription from its hub and closes its channel.
+func (s *Subscription) Unsubscribe() {
+	s.hub.Unsubscribe(s.C)
+}
+
+func (s *Subscription) close() {
+	close(s.done)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	// a script may have closed the channel already
+	defer func() { recover() }()
+	close(s.C)
+}
+
+func (s *Subscription) match(topic []string) bool {
+	for i, seg := range s.pattern {
+		if seg == "#" && i == len(s.pattern)-1 {
+			return true
+		}
+		if i >= len(topic) || (seg != "*" && seg != topic[i]) {
+			return false
+		}
+	}
+	return len(topic) == len(s.pattern)
+}
+
+// deliver sends msg to the subscription according to policy. It reports whether the message
+// was delivered and whether an older message was dropped for it.
+func (s *Subscription) deliver(ctx context.Context, policy HubPolicy, msg LValue) (delivered, dropped bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return false, false
+	}
+	defer func() {
+		// a script closed the channel, the subscription gets nothing until it is removed
+		if rcv := recover(); rcv != nil {
+			if err, ok := rcv.(error); !ok || err.Error() != "send on closed channel" {
+				panic(rcv)
+			}
+			delivered, dropped = false, false
+		}
+	}()
+	if policy == HubBlock {
+		select {
+		case s.C <- msg:
+			return true, false
+		case <-s.done:
+		case <-ctx.Done():
+		}
+		return false, false
+	}
+	for {
+		select {
+		case s.C <- msg:
+			return true, dropped
+		default:
+		}
+		if cap(s.C) == 0 {
+			// there is no buffer to drop from, so the message itself is dropped
+			return false, true
+		}
+		select {
+		case <-s.C:
+			dropped = true
+		default:
+		}
+	}
+}
+
+// match returns the subscriptions matching topic. h.mu must be held.
+func (h *Hub) match(topic []string) []*Subscription {
+	var subs []*Subscription
+	for _, sub := range h.subs {
+		if sub.match(topic) {
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
+
+// Publish sends msg to every subscription matching topic and returns the number of
+// subscriptions it was delivered to. msg must be safe to use from other goroutines.
+func (h *Hub) Publish(topic string, msg LValue) int {
+	return h.PublishContext(context.Background(), topic, msg)
+}
+
+// PublishMessage publishes the bytes of a Message as a string.
+func (h *Hub) PublishMessage(topic string, msg Message) int {
+	return h.PublishContext(context.Background(), topic, LString(msg.Byte()))
+}
+
+// PublishContext is like Publish, but stops waiting for blocked subscribers when ctx is done.
+func (h *Hub) PublishContext(ctx context.Context, topic string, msg LValue) int {
+	segs := strings.Split(topic, ".")
+	h.mu.RLock()
+	subs, st := h.match(segs), h.stats[topic]
+	h.mu.RUnlock()
+	if len(subs) > 0 && st == nil {
+		h.mu.Lock()
+		// the subscriptions may have changed while the lock was released
+		if subs = h.match(segs); len(subs) > 0 {
+			if st = h.stats[topic]; st == nil {
+				st = &TopicStats{}
+				h.stats[topic] = st
+			}
+		}
+		h.mu.Unlock()
+	}
+	if len(subs) == 0 {
+		return 0
+	}
+
+	atomic.AddUint64(&st.Published, 1)
+	n := 0
+	for _, sub := range subs {
+		delivered, dropped := sub.deliver(ctx, h.policy, msg)
+		if dropped {
+			atomic.AddUint64(&st.Dropped, 1)
+		}
+		if delivered {
+			atomic.AddUint64(&st.Delivered, 1)
+			n++
+		}
+	}
+	return n
+}
+
+// Stats returns the counters of a topic, or zero counters if no subscription matches it.
+func (h *Hub) Stats(topic string) TopicStats {
+	h.mu.RLock()
+	st, ok := h.stats[topic]
+	h.mu.RUnlock()
+	if !ok {
+		return TopicStats{}
+	}
+	return TopicStats{
+		Published: atomic.LoadUint64(&st.Published),
+		Delivered: atomic.LoadUint64(&st.Delivered),
+		Dropped:   atomic.LoadUint64(&st.Dropped),
+	}
+}
+
+// Topics returns the sorted names of the topics that have been published to and are
+// matched by a subscription.
+func (h *Hub) Topics() []string {
+	h.mu.RLock()
+	topics := make([]string, 0, len(h.stats))
+	for topic := range h.stats {
+		topics = append(topics, topic)
+	}
+	h.mu.RUnlock()
+	sort.Strings(topics)
+	return topics
+}
@@ -0,0 +1,151 @@
+package lua
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testMessage string
+
+func (m testMessage) Byte() []byte { return []byte(m) }
+
+func TestHubMatch(t *testing.T) {
+	h := NewHub(HubDropOldest)
+	for _, test := range []struct {
+		pattern string
+		topic   string
+		match   bool
+	}{
+		{"log.error", "log.error", true},
+		{"log.error", "log.warn", false},
+		{"log.*", "log.warn", true},
+		{"log.*", "log.warn.disk", false},
+		{"log.#", "log.warn.disk", true},
+		{"log.#", "log", true},
+		{"*.error", "log.error", true},
+		{"#", "any.topic", true},
+		{"log", "log.error", false},
+	} {
+		sub := h.Subscribe(test.pattern, 1)
+		errorIfFalse(t, sub.match(strings.Split(test.topic, ".")) == test.match, "%s on %s: expected %v", test.pattern, test.topic, test.match)
+		sub.Unsubscribe()
+	}
+}
+
+func TestHubPolicies(t *testing.T) {
+	h := NewHub(HubDropOldest)
+	sub := h.Subscribe("t", 2)
+	errorIfNotEqual(t, 1, h.Publish("t", LNumber(1)))
+	h.Publish("t", LNumber(2))
+	h.PublishMessage("t", testMessage("3"))
+	errorIfNotEqual(t, LValue(LNumber(2)), <-sub.C)
+	errorIfNotEqual(t, LValue(LString("3")), <-sub.C)
+	errorIfNotEqual(t, TopicStats{Published: 3, Delivered: 3, Dropped: 1}, h.Stats("t"))
+	errorIfNotEqual(t, "t", strings.Join(h.Topics(), ","))
+	sub.Unsubscribe()
+	_, ok := <-sub.C
+	errorIfFalse(t, !ok, "closed channel expected")
+	errorIfNotEqual(t, 0, h.Publish("t", LNumber(4)))
+	errorIfNotEqual(t, TopicStats{}, h.Stats("t"))
+	errorIfNotEqual(t, 0, len(h.Topics()))
+
+	h = NewHub(HubBlock)
+	sub = h.Subscribe("t", 0)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-sub.C
+	}()
+	errorIfNotEqual(t, 1, h.Publish("t", LTrue))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	errorIfNotEqual(t, 0, h.PublishContext(ctx, "t", LTrue))
+	go sub.Unsubscribe()
+	errorIfNotEqual(t, 0, h.Publish("t", LTrue))
+}
+
+func TestHubStatsDropped(t *testing.T) {
+	h := NewHub(HubDropOldest)
+	for i := 0; i < 100; i++ {
+		h.Publish(fmt.Sprintf("user.%d", i), LTrue)
+	}
+	errorIfNotEqual(t, 0, len(h.Topics()))
+
+	users, one := h.Subscribe("user.*", 100), h.Subscribe("user.1", 1)
+	for i := 0; i < 100; i++ {
+		h.Publish(fmt.Sprintf("user.%d", i), LTrue)
+	}
+	errorIfNotEqual(t, 100, len(h.Topics()))
+	users.Unsubscribe()
+	errorIfNotEqual(t, "user.1", strings.Join(h.Topics(), ","))
+	errorIfNotEqual(t, uint64(1), h.Stats("user.1").Published)
+	one.Unsubscribe()
+	errorIfNotEqual(t, 0, len(h.Topics()))
+}
+
+func TestHubLib(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	errorIfScriptFail(t, L, `
+    local h = hub.new()
+    local all = h:subscribe("app.#", 4)
+    local errs = h:subscribe("app.*.error")
+    assert(h:publish("app.db.error", {code = 1}) == 2)
+    assert(h:publish("app.db.info", "ok") == 1)
+    local ok, v = errs:receive()
+    assert(ok and v.code == 1)
+    assert(select(2, all:receive()).code == 1)
+    assert(select(2, all:receive()) == "ok")
+    local st = h:stats("app.db.error")
+    assert(st.published == 1 and st.delivered == 2 and st.dropped == 0)
+    assert(h:stats()["app.db.info"].published == 1)
+    assert(h:unsubscribe(errs) == true)
+    assert(h:unsubscribe(errs) == false)
+    assert(errs:receive() == false)
+
+    local ch = hub.subscribe("lib.test", 1)
+    hub.publish("lib.test", 1)
+    hub.publish("lib.test", 2)
+    assert(select(2, ch:receive()) == 2)
+    assert(hub.stats("lib.test").dropped == 1)
+    hub.unsubscribe(ch)
+    `)
+	errorIfScriptNotFail(t, L, `hub.publish("t", function() end)`, "can not publish a function")
+	errorIfScriptNotFail(t, L, `hub.new("fast")`, "invalid policy: fast")
+
+	// the hub library of another state has a hub of its own
+	L2 := NewState()
+	defer L2.Close()
+	errorIfScriptFail(t, L2, `assert(next(hub.stats()) == nil)`)
+	shared := NewHub(HubDropOldest)
+	L3, L4 := NewState(Options{Hub: shared}), NewState(Options{Hub: shared})
+	defer L3.Close()
+	defer L4.Close()
+	errorIfScriptFail(t, L3, `ch = hub.subscribe("shared")`)
+	errorIfScriptFail(t, L4, `assert(hub.publish("shared", 1) == 1)`)
+	errorIfScriptFail(t, L3, `assert(select(2, ch:receive()) == 1)`)
+}
+
+func TestHubClosedByScript(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	errorIfScriptFail(t, L, `
+    local ch = hub.subscribe("t")
+    ch:close()
+    assert(hub.publish("t", 1) == 0)
+    assert(hub.unsubscribe(ch) == true)
+    assert(not pcall(ch.close, ch))
+
+    ch = hub.subscribe("t")
+    hub.unsubscribe(ch)
+    assert(not pcall(ch.send, ch, 1))
+    assert(not pcall(ch.close, ch))
+    `)
+	h := NewHub(HubBlock)
+	sub := h.Subscribe("t", 0)
+	close(sub.C)
+	errorIfNotEqual(t, 0, h.Publish("t", LTrue))
+	sub.Unsubscribe()
+}
@@ -0,0 +1,131 @@
+package lua
+
+import (
+	"context"
+)
+
+const lHubClass = "HUB*"
+
+func OpenHub(L *LState) int {
+	mod := L.RegisterModule(HubLibName, hubFuncs)
+	mt := L.NewTypeMetatable(lHubClass)
+	mt.RawSetString("__index", mt)
+	L.SetFuncs(mt, hubMethods)
+	L.Push(mod)
+	return 1
+}
+
+var hubFuncs = map[string]LGFunction{
+	"new":         hubNew,
+	"subscribe":   hubSubscribe,
+	"unsubscribe": hubUnsubscribe,
+	"publish":     hubPublish,
+	"stats":       hubStats,
+}
+
+var hubMethods = map[string]LGFunction{
+	"subscribe":   hubSubscribe,
+	"unsubscribe": hubUnsubscribe,
+	"publish":     hubPublish,
+	"stats":       hubStats,
+}
+
+// checkHub returns the hub a function operates on and the index of its first argument.
+// The hub is either the userdata at index 1 or the hub of the state.
+func checkHub(L *LState) (*Hub, int) {
+	if ud, ok := L.Get(1).(*LUserData); ok {
+		if h, ok := ud.Value.(*Hub); ok {
+			return h, 2
+		}
+	}
+	return L.Hub(), 1
+}
+
+// hubMessage converts a published value: values holding a Message are published as
+// the bytes of the message, other values must be goroutine safe.
+func hubMessage(L *LState, n int) LValue {
+	switch v := L.CheckAny(n).(type) {
+	case *LightUserData:
+		if msg, ok := v.Value.(Message); ok {
+			return LString(msg.Byte())
+		}
+		return v
+	case *LUserData:
+		if msg, ok := v.Value.(Message); ok {
+			return LString(msg.Byte())
+		}
+	}
+	v := L.Get(n)
+	if !isGoroutineSafe(v) {
+		L.ArgError(n, "can not publish a function, userdata, thread or table that has a metatable")
+	}
+	return v
+}
+
+func hubNew(L *LState) int {
+	policy := HubDropOldest
+	switch opt := L.OptString(1, "drop_oldest"); opt {
+	case "drop_oldest":
+	case "block":
+		policy = HubBlock
+	default:
+		L.ArgError(1, "invalid policy: "+opt)
+	}
+	ud := L.NewUserData()
+	ud.Value = NewHub(policy)
+	L.SetMetatable(ud, L.GetTypeMetatable(lHubClass))
+	L.Push(ud)
+	return 1
+}
+
+func hubSubscribe(L *LState) int {
+	h, n := checkHub(L)
+	pattern := L.CheckString(n)
+	bufsize := L.OptInt(n+1, 16)
+	if bufsize < 0 {
+		L.ArgError(n+1, "buffer size must not be negative")
+	}
+	L.Push(h.Subscribe(pattern, bufsize).C)
+	return 1
+}
+
+func hubUnsubscribe(L *LState) int {
+	h, n := checkHub(L)
+	L.Push(LBool(h.Unsubscribe(LChannel(L.CheckChannel(n)))))
+	return 1
+}
+
+func hubPublish(L *LState) int {
+	h, n := checkHub(L)
+	topic := L.CheckString(n)
+	msg := hubMessage(L, n+1)
+	ctx := L.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	L.Push(LNumber(h.PublishContext(ctx, topic, msg)))
+	return 1
+}
+
+func newTopicStatsTable(L *LState, st TopicStats) *LTable {
+	tb := L.CreateTable(0, 3)
+	tb.RawSetString("published", LNumber(st.Published))
+	tb.RawSetString("delivered", LNumber(st.Delivered))
+	tb.RawSetString("dropped", LNumber(st.Dropped))
+	return tb
+}
+
+func hubStats(L *LState) int {
+	h, n := checkHub(L)
+	if L.Get(n) != LNil {
+		L.Push(newTopicStatsTable(L, h.Stats(L.CheckString(n))))
+		return 1
+	}
+	topics := h.Topics()
+	tb := L.CreateTable(0, len(topics))
+	for _, topic := range topics {
+		tb.RawSetString(topic, newTopicStatsTable(L, h.Stats(topic)))
+	}
+	L.Push(tb)
+	return 1
+}
@@ -0,0 +1,405 @@
+package lint
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/edunx/lua/ast"
+)
+
+type varKind int
+
+const (
+	localVar varKind = iota
+	loopVar
+	paramVar
+	// implicitVar is the self parameter of methods.
+	implicitVar
+)
+
+type variable struct {
+	name string
+	pos  ast.Position
+	kind varKind
+	used bool
+}
+
+type scope struct {
+	parent *scope
+	vars   []*variable
+}
+
+type checker struct {
+	file       string
+	globals    map[string]bool
+	signatures map[string]Signature
+	disabled   map[string]bool
+	diags      []Diagnostic
+
+	scope *scope
+	// written holds the globals assigned by the chunk, reads holds the reads of globals
+	// that are not in the allowlist.
+	written map[string]bool
+	reads   []*ast.IdentExpr
+}
+
+func newChecker(file string, config *Config) *checker {
+	c := &checker{
+		file:       file,
+		globals:    map[string]bool{},
+		signatures: map[string]Signature{},
+		disabled:   map[string]bool{},
+		written:    map[string]bool{},
+	}
+	for _, name := range config.globals() {
+		c.globals[name] = true
+	}
+	for name, sig := range librarySignatures {
+		c.signatures[name] = sig
+	}
+	if config != nil {
+		for name, sig := range config.Signatures {
+			c.signatures[name] = sig
+		}
+		for _, code := range config.Disabled {
+			c.disabled[code] = true
+		}
+	}
+	return c
+}
+
+func (c *checker) report(node ast.PositionHolder, code, format string, args ...interface{}) {
+	c.reportAt(startOf(node), code, format, args...)
+}
+
+func (c *checker) reportAt(pos ast.Position, code, format string, args ...interface{}) {
+	c.diags = append(c.diags, Diagnostic{
+		File:    c.file,
+		Line:    pos.Line,
+		Column:  pos.Column,
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (c *checker) chunk(chunk []ast.Stmt) {
+	c.openScope()
+	c.block(chunk)
+	c.closeScope()
+	for _, ident := range c.reads {
+		if !c.written[ident.Value] {
+			c.report(ident, CodeUndefinedGlobal, "accessing undefined variable '%s'", ident.Value)
+		}
+	}
+}
+
+// ignored reports whether name is not checked for unused or shadowed variables.
+func ignored(name string) bool {
+	return strings.HasPrefix(name, "_")
+}
+
+func (c *checker) openScope() {
+	c.scope = &scope{parent: c.scope}
+}
+
+func (c *checker) closeScope() {
+	for _, v := range c.scope.vars {
+		if v.used || ignored(v.name) {
+			continue
+		}
+		switch v.kind {
+		case localVar:
+			c.reportAt(v.pos, CodeUnusedLocal, "unused local variable '%s'", v.name)
+		case loopVar:
+			c.reportAt(v.pos, CodeUnusedLocal, "unused loop variable '%s'", v.name)
+		case paramVar:
+			c.reportAt(v.pos, CodeUnusedParam, "unused parameter '%s'", v.name)
+		}
+	}
+	c.scope = c.scope.parent
+}
+
+func (c *checker) lookup(name string) *variable {
+	for s := c.scope; s != nil; s = s.parent {
+		for i := len(s.vars) - 1; i >= 0; i-- {
+			if s.vars[i].name == name {
+				return s.vars[i]
+			}
+		}
+	}
+	return nil
+}
+
+func (c *checker) declare(name string, pos ast.Position, kind varKind) {
+	if v := c.lookup(name); v != nil && !ignored(name) && kind != implicitVar && v.kind != implicitVar {
+		c.reportAt(pos, CodeShadow, "variable '%s' shadows a variable declared on line %d", name, v.pos.Line)
+	}
+	c.scope.vars = append(c.scope.vars, &variable{name: name, pos: pos, kind: kind, used: kind == implicitVar})
+}
+
+// startOf returns the first position of node.
+func startOf(node ast.PositionHolder) ast.Position {
+	return ast.Position{Line: node.Line(), Column: node.Column()}
+}
+
+// namePos returns the position of the i-th name declared by node, or the first position
+// of node if the syntax tree does not hold the positions of the names.
+func namePos(node ast.PositionHolder, positions []ast.Position, i int) ast.Position {
+	if i < len(positions) {
+		return positions[i]
+	}
+	return startOf(node)
+}
+
+func (c *checker) read(ident *ast.IdentExpr) {
+	if v := c.lookup(ident.Value); v != nil {
+		v.used = true
+	} else if !c.globals[ident.Value] {
+		c.reads = append(c.reads, ident)
+	}
+}
+
+func (c *checker) assign(ident *ast.IdentExpr) {
+	if c.lookup(ident.Value) != nil {
+		return
+	}
+	if !c.globals[ident.Value] {
+		c.report(ident, CodeGlobalWrite, "setting non-standard global variable '%s'", ident.Value)
+	}
+	c.written[ident.Value] = true
+}
+
+// terminates reports whether the statements following stmt in its block are unreachable.
+func terminates(stmt ast.Stmt) bool {
+	switch s := stmt.(type) {
+	case *ast.ReturnStmt, *ast.BreakStmt:
+		return true
+	case *ast.DoBlockStmt:
+		return blockTerminates(s.Stmts)
+	case *ast.IfStmt:
+		return len(s.Else) > 0 && blockTerminates(s.Then) && blockTerminates(s.Else)
+	}
+	return false
+}
+
+func blockTerminates(stmts []ast.Stmt) bool {
+	for _, stmt := range stmts {
+		if terminates(stmt) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *checker) block(stmts []ast.Stmt) {
+	terminated, reported := false, false
+	for _, stmt := range stmts {
+		if terminated && !reported {
+			c.report(stmt, CodeUnreachable, "unreachable code")
+			reported = true
+		}
+		c.stmt(stmt)
+		terminated = terminated || terminates(stmt)
+	}
+}
+
+func (c *checker) scopedBlock(stmts []ast.Stmt) {
+	c.openScope()
+	c.block(stmts)
+	c.closeScope()
+}
+
+func (c *checker) stmt(stmt ast.Stmt) {
+	switch s := stmt.(type) {
+	case *ast.AssignStmt:
+		c.exprs(s.Rhs)
+		for _, lhs := range s.Lhs {
+			switch e := lhs.(type) {
+			case *ast.IdentExpr:
+				c.assign(e)
+			default:
+				c.expr(e)
+			}
+		}
+	case *ast.LocalAssignStmt:
+		if len(s.Names) == 1 && len(s.Exprs) == 1 {
+			if fn, ok := s.Exprs[0].(*ast.FunctionExpr); ok {
+				// local function: the name is visible in the body.
+				c.declare(s.Names[0], namePos(s, s.NamePos, 0), localVar)
+				c.function(fn, false)
+				return
+			}
+		}
+		c.exprs(s.Exprs)
+		for i, name := range s.Names {
+			c.declare(name, namePos(s, s.NamePos, i), localVar)
+		}
+	case *ast.FuncCallStmt:
+		c.expr(s.Expr)
+	case *ast.DoBlockStmt:
+		c.scopedBlock(s.Stmts)
+	case *ast.WhileStmt:
+		c.expr(s.Condition)
+		c.scopedBlock(s.Stmts)
+	case *ast.RepeatStmt:
+		// the condition sees the locals of the body.
+		c.openScope()
+		c.block(s.Stmts)
+		c.expr(s.Condition)
+		c.closeScope()
+	case *ast.IfStmt:
+		c.expr(s.Condition)
+		c.scopedBlock(s.Then)
+		c.scopedBlock(s.Else)
+	case *ast.NumberForStmt:
+		c.expr(s.Init)
+		c.expr(s.Limit)
+		if s.Step != nil {
+			c.expr(s.Step)
+		}
+		c.openScope()
+		pos := s.NamePos
+		if pos.Line == 0 {
+			pos = startOf(s)
+		}
+		c.declare(s.Name, pos, loopVar)
+		c.block(s.Stmts)
+		c.closeScope()
+	case *ast.GenericForStmt:
+		c.exprs(s.Exprs)
+		c.openScope()
+		for i, name := range s.Names {
+			c.declare(name, namePos(s, s.NamePos, i), loopVar)
+		}
+		c.block(s.Stmts)
+		c.closeScope()
+	case *ast.FuncDefStmt:
+		if s.Name.Func != nil {
+			if ident, ok := s.Name.Func.(*ast.IdentExpr); ok {
+				c.assign(ident)
+			} else {
+				c.expr(s.Name.Func)
+			}
+		} else {
+			c.expr(s.Name.Receiver)
+		}
+		c.function(s.Func, s.Name.Func == nil)
+	case *ast.ReturnStmt:
+		c.exprs(s.Exprs)
+	case *ast.BreakStmt:
+	}
+}
+
+func (c *checker) function(fn *ast.FunctionExpr, method bool) {
+	c.openScope()
+	if method {
+		c.declare("self", startOf(fn), implicitVar)
+	}
+	for i, name := range fn.ParList.Names {
+		c.declare(name, namePos(fn, fn.ParList.NamePos, i), paramVar)
+	}
+	c.block(fn.Stmts)
+	c.closeScope()
+}
+
+func (c *checker) exprs(exprs []ast.Expr) {
+	for _, expr := range exprs {
+		c.expr(expr)
+	}
+}
+
+func (c *checker) expr(expr ast.Expr) {
+	switch e := expr.(type) {
+	case *ast.IdentExpr:
+		c.read(e)
+	case *ast.AttrGetExpr:
+		c.expr(e.Object)
+		c.expr(e.Key)
+	case *ast.TableExpr:
+		for _, field := range e.Fields {
+			if field.Key != nil {
+				c.expr(field.Key)
+			}
+			c.expr(field.Value)
+		}
+	case *ast.FuncCallExpr:
+		c.call(e)
+		if e.Func != nil {
+			c.expr(e.Func)
+		} else {
+			c.expr(e.Receiver)
+		}
+		c.exprs(e.Args)
+	case *ast.LogicalOpExpr:
+		c.expr(e.Lhs)
+		c.expr(e.Rhs)
+	case *ast.RelationalOpExpr:
+		c.expr(e.Lhs)
+		c.expr(e.Rhs)
+	case *ast.StringConcatOpExpr:
+		c.expr(e.Lhs)
+		c.expr(e.Rhs)
+	case *ast.ArithmeticOpExpr:
+		c.expr(e.Lhs)
+		c.expr(e.Rhs)
+	case *ast.UnaryMinusOpExpr:
+		c.expr(e.Expr)
+	case *ast.UnaryNotOpExpr:
+		c.expr(e.Expr)
+	case *ast.UnaryLenOpExpr:
+		c.expr(e.Expr)
+	case *ast.FunctionExpr:
+		c.function(e, false)
+	}
+}
+
+// globalName returns the name of a global function, as "name" or "lib.name", or "" if expr
+// is not a global or a field of a global.
+func (c *checker) globalName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.IdentExpr:
+		if c.lookup(e.Value) == nil {
+			return e.Value
+		}
+	case *ast.AttrGetExpr:
+		obj, ok := e.Object.(*ast.IdentExpr)
+		key, ok2 := e.Key.(*ast.StringExpr)
+		if ok && ok2 && c.lookup(obj.Value) == nil {
+			return obj.Value + "." + key.Value
+		}
+	}
+	return ""
+}
+
+func (c *checker) call(call *ast.FuncCallExpr) {
+	if call.Func == nil {
+		return
+	}
+	name := c.globalName(call.Func)
+	sig, ok := c.signatures[name]
+	if !ok || c.written[name] {
+		return
+	}
+	if i := strings.IndexByte(name, '.'); i >= 0 && c.written[name[:i]] {
+		// the library table is replaced by the chunk.
+		return
+	}
+	n := len(call.Args)
+	multi := false
+	if n > 0 {
+		switch last := call.Args[n-1].(type) {
+		case *ast.Comma3Expr:
+			multi = true
+		case *ast.FuncCallExpr:
+			multi = !last.AdjustRet
+		}
+	}
+	switch {
+	case multi && sig.Max >= 0 && n-1 > sig.Max:
+		c.report(call, CodeArgCount, "too many arguments to '%s': expects %s, got at least %d", name, sig, n-1)
+	case !multi && n < sig.Min:
+		c.report(call, CodeArgCount, "too few arguments to '%s': expects %s, got %d", name, sig, n)
+	case !multi && sig.Max >= 0 && n > sig.Max:
+		c.report(call, CodeArgCount, "too many arguments to '%s': expects %s, got %d", name, sig, n)
+	}
+}
@@ -0,0 +1,184 @@
+// Package lint reports suspicious constructs in Lua chunks: undefined and implicit global
+// variables, unused locals and parameters, shadowed locals, unreachable code and wrong
+// argument counts in calls of known library functions.
+package lint
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/edunx/lua"
+	"github.com/edunx/lua/ast"
+	"github.com/edunx/lua/parse"
+)
+
+// Codes of the diagnostics.
+const (
+	CodeSyntax          = "syntax-error"
+	CodeUndefinedGlobal = "undefined-global"
+	CodeGlobalWrite     = "global-write"
+	CodeUnusedLocal     = "unused-local"
+	CodeUnusedParam     = "unused-param"
+	CodeShadow          = "shadow"
+	CodeUnreachable     = "unreachable"
+	CodeArgCount        = "arg-count"
+)
+
+// Diagnostic is a problem found in a chunk. Column is 0 when it is unknown.
+type Diagnostic struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// String returns the diagnostic in the file:line:col form.
+func (d Diagnostic) String() string {
+	if d.Column > 0 {
+		return fmt.Sprintf("%s:%d:%d: %s (%s)", d.File, d.Line, d.Column, d.Message, d.Code)
+	}
+	return fmt.Sprintf("%s:%d: %s (%s)", d.File, d.Line, d.Message, d.Code)
+}
+
+// Signature is the number of arguments a function accepts. Max is negative for variadic
+// functions.
+type Signature struct {
+	Min, Max int
+}
+
+func (s Signature) String() string {
+	switch {
+	case s.Max < 0:
+		return fmt.Sprintf("at least %d", s.Min)
+	case s.Min == s.Max:
+		return fmt.Sprint(s.Min)
+	}
+	return fmt.Sprintf("%d to %d", s.Min, s.Max)
+}
+
+// Config configures the checks.
+type Config struct {
+	// Globals are the global variables the chunks may read and write. If nil, the globals
+	// of a state with the default libraries are used (see Globals).
+	Globals []string
+	// Signatures maps global functions, as "name" or "lib.name", to their arguments. It
+	// completes the signatures of the standard library.
+	Signatures map[string]Signature
+	// Disabled lists the codes that are not reported.
+	Disabled []string
+}
+
+var (
+	defaultGlobalsOnce sync.Once
+	defaultGlobals     []string
+)
+
+// Globals returns the names of the globals and of the modules, loaded or preloaded, of L.
+// The rocks and modules registered by the host are therefore part of the result.
+func Globals(L *lua.LState) []string {
+	var names []string
+	addKeys := func(lv lua.LValue) {
+		if tb, ok := lv.(*lua.LTable); ok {
+			tb.ForEach(func(key, _ lua.LValue) {
+				if name, ok := key.(lua.LString); ok {
+					names = append(names, string(name))
+				}
+			})
+		}
+	}
+	addKeys(L.G.Global)
+	if pkg, ok := L.GetGlobal(lua.LoadLibName).(*lua.LTable); ok {
+		addKeys(pkg.RawGetString("loaded"))
+		addKeys(pkg.RawGetString("preload"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (config *Config) globals() []string {
+	if config != nil && config.Globals != nil {
+		return config.Globals
+	}
+	defaultGlobalsOnce.Do(func() {
+		L := lua.NewState()
+		defaultGlobals = Globals(L)
+		L.Close()
+	})
+	return defaultGlobals
+}
+
+// Check checks a parsed chunk. name is the file name of the diagnostics.
+func Check(chunk []ast.Stmt, name string, config *Config) []Diagnostic {
+	c := newChecker(name, config)
+	c.chunk(chunk)
+	diags := c.diags[:0]
+	for _, d := range c.diags {
+		if !c.disabled[d.Code] {
+			diags = append(diags, d)
+		}
+	}
+	sort.SliceStable(diags, func(i, j int) bool {
+		if diags[i].Line != diags[j].Line {
+			return diags[i].Line < diags[j].Line
+		}
+		return diags[i].Column < diags[j].Column
+	})
+	return diags
+}
+
+// Source parses and checks a chunk. The syntax errors are reported as diagnostics, and the
+// chunk is not checked further if there are any.
+func Source(src []byte, name string, config *Config) []Diagnostic {
+	chunk, errs := parse.ParseRecover(bytes.NewReader(src), name)
+	if len(errs) == 0 {
+		return Check(chunk, name, config)
+	}
+	diags := make([]Diagnostic, 0, len(errs))
+	for _, err := range errs {
+		d := Diagnostic{File: name, Line: err.Start.Line, Column: err.Start.Column, Code: CodeSyntax, Message: err.Message}
+		if d.Line == parse.EOF {
+			d.Line, d.Column = bytes.Count(src, []byte("\n"))+1, 0
+		}
+		if len(err.Expected) > 0 {
+			d.Message += fmt.Sprintf(", expected '%s'", strings.Join(err.Expected, "', '"))
+		}
+		diags = append(diags, d)
+	}
+	return diags
+}
+
+// File reads and checks a file.
+func File(path string, config *Config) ([]Diagnostic, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Source(src, path, config), nil
+}
+
+// WriteText writes the diagnostics to w, one per line.
+func WriteText(w io.Writer, diags []Diagnostic) error {
+	for _, d := range diags {
+		if _, err := fmt.Fprintln(w, d.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the diagnostics to w as a JSON array.
+func WriteJSON(w io.Writer, diags []Diagnostic) error {
+	if diags == nil {
+		diags = []Diagnostic{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(diags)
+}
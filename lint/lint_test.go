@@ -0,0 +1,93 @@
+package lint
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func codes(diags []Diagnostic) string {
+	var list []string
+	for _, d := range diags {
+		list = append(list, fmt.Sprintf("%d:%s", d.Line, d.Code))
+	}
+	return strings.Join(list, " ")
+}
+
+func TestCheck(t *testing.T) {
+	cases := []struct{ src, expected string }{
+		{"print(prnt)", "1:undefined-global"},
+		{"counter = 1\nprint(counter)", "1:global-write"},
+		{"local a = 1\nlocal b = a", "2:unused-local"},
+		{"local _a = 1", ""},
+		{"local function f(a, b)\n  return a\nend\nf(1)", "1:unused-param"},
+		{"local t = {}\nfunction t:m(x) return self, x end\nreturn t", ""},
+		{"for i, v in ipairs({}) do print(v) end", "1:unused-local"},
+		{"local x = 1\ndo\n  local x = 2\n  print(x)\nend\nprint(x)", "3:shadow"},
+		{"local function f()\n  do return 1 end\n  print(1)\n  print(2)\nend\nf()", "3:unreachable"},
+		{"local function f(x)\n  if x then return 1 else return 2 end\n  print(x)\nend\nf()", "3:unreachable"},
+		{"print(string.rep('a'))\nprint(string.rep('a', 2, 3))\nprint(string.format('%s', f()))", "1:arg-count 2:arg-count 3:undefined-global"},
+		{"print(type(...))\nlocal string = {rep = print}\nstring.rep()", ""},
+		{"local x\nrepeat local y = 1 until y\nreturn x", ""},
+		{"string = {}\nstring.rep()", ""},
+	}
+	config := &Config{}
+	for _, c := range cases {
+		diags := Source([]byte(c.src), "test.lua", config)
+		if got := codes(diags); got != c.expected {
+			t.Errorf("%q: expected %q, but got %q (%v)", c.src, c.expected, got, diags)
+		}
+	}
+}
+
+func TestCheckColumns(t *testing.T) {
+	cases := []struct{ src, expected string }{
+		{"local a, b = 1, 2\nprint(a)", "1:10"},
+		{"for i, v in ipairs({}) do print(v) end", "1:5"},
+		{"for i = 1, 2 do end", "1:5"},
+		{"local function f(a, b)\n  return a\nend\nf(1)", "1:21"},
+		{"local x = 1\ndo\n  local y, x = 2, 3\n  print(x, y)\nend\nprint(x)", "3:12"},
+	}
+	for _, c := range cases {
+		diags := Source([]byte(c.src), "test.lua", &Config{})
+		if len(diags) != 1 || fmt.Sprintf("%d:%d", diags[0].Line, diags[0].Column) != c.expected {
+			t.Errorf("%q: expected a diagnostic at %s, but got %v", c.src, c.expected, diags)
+		}
+	}
+}
+
+func TestConfig(t *testing.T) {
+	config := &Config{
+		Globals:    []string{"print", "rule"},
+		Signatures: map[string]Signature{"rule": {1, 1}},
+		Disabled:   []string{CodeUnusedLocal},
+	}
+	diags := Source([]byte("local x = 1\nrule()\nlog(x)"), "test.lua", config)
+	if got := codes(diags); got != "2:arg-count 3:undefined-global" {
+		t.Errorf("unexpected diagnostics: %v", diags)
+	}
+	if got := diags[1].String(); got != "test.lua:3:1: accessing undefined variable 'log' (undefined-global)" {
+		t.Errorf("unexpected diagnostic %q", got)
+	}
+}
+
+func TestOutput(t *testing.T) {
+	diags := Source([]byte("local x = = 1\nlocal y = )"), "bad.lua", nil)
+	var buf bytes.Buffer
+	WriteText(&buf, diags)
+	if !strings.HasPrefix(buf.String(), "bad.lua:1:11: syntax error near '=', expected '#', '('") || len(diags) != 2 || diags[1].Line != 2 {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+
+	buf.Reset()
+	WriteJSON(&buf, Source([]byte("print(x)"), "a.lua", nil))
+	var decoded []Diagnostic
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 1 || decoded[0].Code != CodeUndefinedGlobal || decoded[0].File != "a.lua" || decoded[0].Line != 1 {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+}
@@ -0,0 +1,89 @@
+package lint
+
+const variadic = -1
+
+// librarySignatures are the arguments of the standard library functions.
+var librarySignatures = map[string]Signature{
+	// base
+	"assert":         {1, variadic},
+	"collectgarbage": {0, 2},
+	"dofile":         {0, 1},
+	"error":          {0, 2},
+	"getfenv":        {0, 1},
+	"getmetatable":   {1, 1},
+	"ipairs":         {1, 1},
+	"load":           {1, 2},
+	"loadfile":       {0, 1},
+	"loadstring":     {1, 2},
+	"next":           {1, 2},
+	"pairs":          {1, 1},
+	"pcall":          {1, variadic},
+	"print":          {0, variadic},
+	"rawequal":       {2, 2},
+	"rawget":         {2, 2},
+	"rawset":         {3, 3},
+	"require":        {1, 1},
+	"select":         {1, variadic},
+	"setfenv":        {2, 2},
+	"setmetatable":   {2, 2},
+	"tonumber":       {1, 2},
+	"tostring":       {1, 1},
+	"type":           {1, 1},
+	"unpack":         {1, 3},
+	"xpcall":         {2, variadic},
+
+	// string
+	"string.byte":    {1, 3},
+	"string.char":    {0, variadic},
+	"string.find":    {2, 4},
+	"string.format":  {1, variadic},
+	"string.gmatch":  {2, 2},
+	"string.gsub":    {3, 4},
+	"string.len":     {1, 1},
+	"string.lower":   {1, 1},
+	"string.match":   {2, 3},
+	"string.rep":     {2, 2},
+	"string.reverse": {1, 1},
+	"string.sub":     {2, 3},
+	"string.upper":   {1, 1},
+
+	// table
+	"table.concat": {1, 4},
+	"table.getn":   {1, 1},
+	"table.insert": {2, 3},
+	"table.maxn":   {1, 1},
+	"table.remove": {1, 2},
+	"table.sort":   {1, 2},
+
+	// math
+	"math.abs":        {1, 1},
+	"math.ceil":       {1, 1},
+	"math.floor":      {1, 1},
+	"math.fmod":       {2, 2},
+	"math.max":        {1, variadic},
+	"math.min":        {1, variadic},
+	"math.pow":        {2, 2},
+	"math.random":     {0, 2},
+	"math.randomseed": {1, 1},
+	"math.sqrt":       {1, 1},
+
+	// os
+	"os.clock":  {0, 0},
+	"os.date":   {0, 2},
+	"os.getenv": {1, 1},
+	"os.remove": {1, 1},
+	"os.rename": {2, 2},
+	"os.time":   {0, 1},
+
+	// io
+	"io.open":  {1, 2},
+	"io.lines": {0, 1},
+	"io.write": {0, variadic},
+
+	// coroutine
+	"coroutine.create": {1, 1},
+	"coroutine.resume": {1, variadic},
+	"coroutine.status": {1, 1},
+	"coroutine.wrap":   {1, 1},
+	"coroutine.yield":  {0, variadic},
+}
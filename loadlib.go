@@ -1,125 +1,196 @@
-package lua
-
-import (
-	"fmt"
-	"os"
-	"path/filepath"
-	"strings"
-)
-
-/* load lib {{{ */
-
-var loLoaders = []LGFunction{loLoaderPreload, loLoaderLua}
-
-func loGetPath(env string, defpath string) string {
-	path := os.Getenv(env)
-	if len(path) == 0 {
-		path = defpath
-	}
-	path = strings.Replace(path, ";;", ";"+defpath+";", -1)
-	if os.PathSeparator != '/' {
-		dir, err := filepath.Abs(filepath.Dir(os.Args[0]))
-		if err != nil {
-			panic(err)
-		}
-		path = strings.Replace(path, "!", dir, -1)
-	}
-	return path
-}
-
-func loFindFile(L *LState, name, pname string) (string, string) {
-	name = strings.Replace(name, ".", string(os.PathSeparator), -1)
-	lv := L.GetField(L.GetField(L.Get(EnvironIndex), "package"), pname)
-	path, ok := lv.(LString)
-	if !ok {
-		L.RaiseError("package.%s must be a string", pname)
-	}
-	messages := []string{}
-	for _, pattern := range strings.Split(string(path), ";") {
-		luapath := strings.Replace(pattern, "?", name, -1)
-		if _, err := os.Stat(luapath); err == nil {
-			return luapath, ""
-		} else {
-			messages = append(messages, err.Error())
-		}
-	}
-	return "", strings.Join(messages, "\n\t")
-}
-
-func OpenPackage(L *LState) int {
-	packagemod := L.RegisterModule(LoadLibName, loFuncs)
-
-	L.SetField(packagemod, "preload", L.NewTable())
-
-	loaders := L.CreateTable(len(loLoaders), 0)
-	for i, loader := range loLoaders {
-		L.RawSetInt(loaders, i+1, L.NewFunction(loader))
-	}
-	L.SetField(packagemod, "loaders", loaders)
-	L.SetField(L.Get(RegistryIndex), "_LOADERS", loaders)
-
-	loaded := L.NewTable()
-	L.SetField(packagemod, "loaded", loaded)
-	L.SetField(L.Get(RegistryIndex), "_LOADED", loaded)
-
-	L.SetField(packagemod, "path", LString(loGetPath(LuaPath, LuaPathDefault)))
-	L.SetField(packagemod, "cpath", emptyLString)
-
-	L.Push(packagemod)
-	return 1
-}
-
-var loFuncs = map[string]LGFunction{
-	"loadlib": loLoadLib,
-	"seeall":  loSeeAll,
-}
-
-func loLoaderPreload(L *LState) int {
-	name := L.CheckString(1)
-	preload := L.GetField(L.GetField(L.Get(EnvironIndex), "package"), "preload")
-	if _, ok := preload.(*LTable); !ok {
-		L.RaiseError("package.preload must be a table")
-	}
-	lv := L.GetField(preload, name)
-	if lv == LNil {
-		L.Push(LString(fmt.Sprintf("no field package.preload['%s']", name)))
-		return 1
-	}
-	L.Push(lv)
-	return 1
-}
-
-func loLoaderLua(L *LState) int {
-	name := L.CheckString(1)
-	path, msg := loFindFile(L, name, "path")
-	if len(path) == 0 {
-		L.Push(LString(msg))
-		return 1
-	}
-	fn, err1 := L.LoadFile(path)
-	if err1 != nil {
-		L.RaiseError(err1.Error())
-	}
-	L.Push(fn)
-	return 1
-}
-
-func loLoadLib(L *LState) int {
-	L.RaiseError("loadlib is not supported")
-	return 0
-}
-
-func loSeeAll(L *LState) int {
-	mod := L.CheckTable(1)
-	mt := L.GetMetatable(mod)
-	if mt == LNil {
-		mt = L.CreateTable(0, 1)
-		L.SetMetatable(mod, mt)
-	}
-	L.SetField(mt, "__index", L.Get(GlobalsIndex))
-	return 0
-}
-
-/* }}} */
-
-//
+package lua
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/* load lib {{{ */
+
+var loLoaders = []LGFunction{loLoaderPreload, loLoaderLua}
+
+func loGetPath(env string, defpath string) string {
+	path := os.Getenv(env)
+	if len(path) == 0 {
+		path = defpath
+	}
+	path = strings.Replace(path, ";;", ";"+defpath+";", -1)
+	if os.PathSeparator != '/' {
+		dir, err := filepath.Abs(filepath.Dir(os.Args[0]))
+		if err != nil {
+			panic(err)
+		}
+		path = strings.Replace(path, "!", dir, -1)
+	}
+	return path
+}
+
+func loFindFile(L *LState, name, pname string) (string, string) {
+	lv := L.GetField(L.GetField(L.Get(EnvironIndex), "package"), pname)
+	path, ok := lv.(LString)
+	if !ok {
+		L.RaiseError("package.%s must be a string", pname)
+	}
+	sep := string(os.PathSeparator)
+	if L.Options.FS != nil {
+		sep = "/"
+	}
+	return loSearchPath(L, name, string(path), ".", sep)
+}
+
+// loSearchPath looks for name in the templates of path, after replacing each occurrence of
+// sep in name by rep. It returns the first file that exists, or the reasons of the failure.
+func loSearchPath(L *LState, name, path, sep, rep string) (string, string) {
+	if len(sep) > 0 {
+		name = strings.Replace(name, sep, rep, -1)
+	}
+	messages := []string{}
+	for _, pattern := range strings.Split(path, ";") {
+		luapath := strings.Replace(pattern, "?", name, -1)
+		if _, err := L.statFS(luapath); err == nil {
+			return luapath, ""
+		}
+		messages = append(messages, fmt.Sprintf("no file '%s'", luapath))
+	}
+	return "", strings.Join(messages, "\n\t")
+}
+
+func OpenPackage(L *LState) int {
+	packagemod := L.RegisterModule(LoadLibName, loFuncs)
+
+	L.SetField(packagemod, "preload", L.NewTable())
+
+	loaders := L.CreateTable(len(loLoaders), 0)
+	for i, loader := range loLoaders {
+		L.RawSetInt(loaders, i+1, L.NewFunction(loader))
+	}
+	L.SetField(packagemod, "loaders", loaders)
+	L.SetField(packagemod, "searchers", loaders)
+	L.SetField(L.Get(RegistryIndex), "_LOADERS", loaders)
+
+	loaded := L.NewTable()
+	L.SetField(packagemod, "loaded", loaded)
+	L.SetField(L.Get(RegistryIndex), "_LOADED", loaded)
+
+	L.SetField(packagemod, "path", LString(loGetPath(LuaPath, LuaPathDefault)))
+	L.SetField(packagemod, "cpath", emptyLString)
+
+	L.Push(packagemod)
+	return 1
+}
+
+var loFuncs = map[string]LGFunction{
+	"loadlib":    loLoadLib,
+	"reload":     loReload,
+	"searchpath": loSearchPathFn,
+	"seeall":     loSeeAll,
+}
+
+func loLoaderPreload(L *LState) int {
+	name := L.CheckString(1)
+	preload := L.GetField(L.GetField(L.Get(EnvironIndex), "package"), "preload")
+	if _, ok := preload.(*LTable); !ok {
+		L.RaiseError("package.preload must be a table")
+	}
+	lv := L.GetField(preload, name)
+	if lv == LNil {
+		L.Push(LString(fmt.Sprintf("no field package.preload['%s']", name)))
+		return 1
+	}
+	L.Push(lv)
+	return 1
+}
+
+func loLoaderLua(L *LState) int {
+	name := L.CheckString(1)
+	path, msg := loFindFile(L, name, "path")
+	if len(path) == 0 {
+		L.Push(LString(msg))
+		return 1
+	}
+	fn, err1 := L.LoadFile(path)
+	if err1 != nil {
+		L.RaiseError(err1.Error())
+	}
+	L.Push(fn)
+	L.Push(LString(path))
+	return 2
+}
+
+// SourceSearcher returns a searcher for package.searchers that loads modules from the source
+// returned by find, for example from a database or a module store. find returns an error when
+// it has no such module; the message of the error is reported by require if no other
+// searcher finds the module.
+func SourceSearcher(find func(name string) (source []byte, chunkname string, err error)) LGFunction {
+	return func(L *LState) int {
+		name := L.CheckString(1)
+		source, chunkname, err := find(name)
+		if err != nil {
+			L.Push(LString(err.Error()))
+			return 1
+		}
+		fn, err := L.Load(bytes.NewReader(source), chunkname)
+		if err != nil {
+			L.RaiseError("error loading module '%s' from %s:\n\t%s", name, chunkname, err.Error())
+		}
+		L.Push(fn)
+		L.Push(LString(chunkname))
+		return 2
+	}
+}
+
+func loSearchPathFn(L *LState) int {
+	name := L.CheckString(1)
+	path := L.CheckString(2)
+	sep := L.OptString(3, ".")
+	rep := L.OptString(4, string(os.PathSeparator))
+	if found, msg := loSearchPath(L, name, path, sep, rep); len(found) > 0 {
+		L.Push(LString(found))
+		return 1
+	} else {
+		L.Push(LNil)
+		L.Push(LString("\n\t" + msg))
+		return 2
+	}
+}
+
+func loReload(L *LState) int {
+	if err := L.ReloadModule(L.CheckString(1)); err != nil {
+		L.Push(LFalse)
+		if aerr, ok := err.(*ApiError); ok {
+			L.Push(aerr.Object)
+		} else {
+			L.Push(LString(err.Error()))
+		}
+		return 2
+	}
+	L.Push(LTrue)
+	return 1
+}
+
+func loLoadLib(L *LState) int {
+	L.CheckString(1)
+	L.CheckString(2)
+	L.Push(LNil)
+	L.Push(LString("dynamic libraries not enabled; use LState.AddSearcher to load modules from Go"))
+	L.Push(LString("absent"))
+	return 3
+}
+
+func loSeeAll(L *LState) int {
+	mod := L.CheckTable(1)
+	mt := L.GetMetatable(mod)
+	if mt == LNil {
+		mt = L.CreateTable(0, 1)
+		L.SetMetatable(mod, mt)
+	}
+	L.SetField(mt, "__index", L.Get(GlobalsIndex))
+	return 0
+}
+
+/* }}} */
+
+//
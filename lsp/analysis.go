@@ -0,0 +1,459 @@
+package lsp
+
+import (
+	"github.com/edunx/lua/ast"
+	"github.com/edunx/lua/parse"
+)
+
+type declKind int
+
+const (
+	declLocal declKind = iota
+	declFunction
+	declParam
+	declLoop
+	declSelf
+)
+
+// decl is the declaration of a local variable.
+type decl struct {
+	name string
+	kind declKind
+	// pos is the position of the name, and visible the position from which the variable
+	// can be used.
+	pos     ast.Position
+	visible ast.Position
+	// value is the expression assigned by the declaration, or nil.
+	value ast.Expr
+}
+
+// scope is a block of the chunk.
+type scope struct {
+	start, end ast.Position
+	decls      []*decl
+}
+
+// field is a field of a table defined by the chunk, as in "function M.f()" or
+// "M = {f = 1}". decl is the local holding the table, or nil for a global named object.
+type field struct {
+	object string
+	decl   *decl
+	name   string
+	pos    ast.Position
+	method bool
+	value  ast.Expr
+}
+
+// member is a field or a method of an object accessed at a position.
+type member struct {
+	object ast.Expr
+	name   string
+	method bool
+}
+
+// analysis holds the variables of a chunk and their references.
+type analysis struct {
+	doc    *document
+	scopes []*scope
+	decls  []*decl
+	// refs maps the position of each reference to a local variable to its declaration.
+	refs map[ast.Position]*decl
+	// globals maps each global assigned by the chunk to its first assignment.
+	globals map[string]*global
+	fields  []*field
+	members map[ast.Position]*member
+
+	stack []*scope
+}
+
+type global struct {
+	pos   ast.Position
+	value ast.Expr
+}
+
+func analyze(doc *document) *analysis {
+	a := &analysis{
+		doc:     doc,
+		refs:    map[ast.Position]*decl{},
+		globals: map[string]*global{},
+		members: map[ast.Position]*member{},
+	}
+	end := ast.Position{Line: len(doc.lines) + 1}
+	a.openScope(ast.Position{Line: 1, Column: 1}, end)
+	a.block(doc.chunk)
+	a.closeScope()
+	return a
+}
+
+func startOf(node ast.PositionHolder) ast.Position {
+	return ast.Position{Line: node.Line(), Column: node.Column()}
+}
+
+func endOf(node ast.PositionHolder) ast.Position {
+	return ast.Position{Line: node.LastLine(), Column: node.LastColumn() + 1}
+}
+
+func (a *analysis) openScope(start, end ast.Position) {
+	s := &scope{start: start, end: end}
+	a.scopes = append(a.scopes, s)
+	a.stack = append(a.stack, s)
+}
+
+func (a *analysis) closeScope() {
+	a.stack = a.stack[:len(a.stack)-1]
+}
+
+func (a *analysis) declare(name string, kind declKind, pos, visible ast.Position, value ast.Expr) *decl {
+	d := &decl{name: name, kind: kind, pos: pos, visible: visible, value: value}
+	s := a.stack[len(a.stack)-1]
+	s.decls = append(s.decls, d)
+	a.decls = append(a.decls, d)
+	return d
+}
+
+func (a *analysis) lookup(name string) *decl {
+	for i := len(a.stack) - 1; i >= 0; i-- {
+		decls := a.stack[i].decls
+		for j := len(decls) - 1; j >= 0; j-- {
+			if decls[j].name == name {
+				return decls[j]
+			}
+		}
+	}
+	return nil
+}
+
+func (a *analysis) block(stmts []ast.Stmt) {
+	for _, stmt := range stmts {
+		a.stmt(stmt)
+	}
+}
+
+func (a *analysis) scopedBlock(stmts []ast.Stmt, start, end ast.Position) {
+	a.openScope(start, end)
+	a.block(stmts)
+	a.closeScope()
+}
+
+func (a *analysis) stmt(stmt ast.Stmt) {
+	switch s := stmt.(type) {
+	case *ast.AssignStmt:
+		a.exprs(s.Rhs)
+		for i, lhs := range s.Lhs {
+			var value ast.Expr
+			if i < len(s.Rhs) {
+				value = s.Rhs[i]
+			}
+			a.assign(lhs, value)
+		}
+	case *ast.LocalAssignStmt:
+		if len(s.Names) == 1 && len(s.Exprs) == 1 && a.isLocalFunction(s) {
+			fn := s.Exprs[0].(*ast.FunctionExpr)
+			// the name of a local function is visible in its body.
+			pos := a.doc.nameAfter(startOf(s), s.Names[0])
+			a.declare(s.Names[0], declFunction, pos, pos, fn)
+			a.function(fn, false)
+			return
+		}
+		a.exprs(s.Exprs)
+		pos := startOf(s)
+		for i, name := range s.Names {
+			var value ast.Expr
+			if i < len(s.Exprs) {
+				value = s.Exprs[i]
+			}
+			pos = a.doc.nameAfter(pos, name)
+			d := a.declare(name, declLocal, pos, endOf(s), value)
+			if _, ok := value.(*ast.FunctionExpr); ok {
+				d.kind = declFunction
+			}
+			if tbl, ok := value.(*ast.TableExpr); ok {
+				a.tableFields(name, d, tbl)
+			}
+		}
+	case *ast.FuncCallStmt:
+		a.expr(s.Expr)
+	case *ast.DoBlockStmt:
+		a.scopedBlock(s.Stmts, startOf(s), endOf(s))
+	case *ast.WhileStmt:
+		a.expr(s.Condition)
+		a.scopedBlock(s.Stmts, startOf(s), endOf(s))
+	case *ast.RepeatStmt:
+		// the condition sees the locals of the body.
+		a.openScope(startOf(s), endOf(s))
+		a.block(s.Stmts)
+		a.expr(s.Condition)
+		a.closeScope()
+	case *ast.IfStmt:
+		end := endOf(s)
+		for cur := s; ; {
+			a.expr(cur.Condition)
+			thenEnd := end
+			if len(cur.Else) > 0 {
+				thenEnd = startOf(cur.Else[0])
+			}
+			a.scopedBlock(cur.Then, endOf(cur.Condition), thenEnd)
+			if elseif := cur.ElseIf(); elseif != nil {
+				cur = elseif
+				continue
+			}
+			if len(cur.Else) > 0 {
+				a.scopedBlock(cur.Else, startOf(cur.Else[0]), end)
+			}
+			break
+		}
+	case *ast.NumberForStmt:
+		a.expr(s.Init)
+		a.expr(s.Limit)
+		if s.Step != nil {
+			a.expr(s.Step)
+		}
+		a.openScope(startOf(s), endOf(s))
+		pos := a.doc.nameAfter(startOf(s), s.Name)
+		a.declare(s.Name, declLoop, pos, pos, nil)
+		a.block(s.Stmts)
+		a.closeScope()
+	case *ast.GenericForStmt:
+		a.exprs(s.Exprs)
+		a.openScope(startOf(s), endOf(s))
+		pos := startOf(s)
+		for _, name := range s.Names {
+			pos = a.doc.nameAfter(pos, name)
+			a.declare(name, declLoop, pos, pos, nil)
+		}
+		a.block(s.Stmts)
+		a.closeScope()
+	case *ast.FuncDefStmt:
+		if s.Name.Func != nil {
+			a.assign(s.Name.Func, s.Func)
+		} else {
+			a.expr(s.Name.Receiver)
+			if ident, ok := s.Name.Receiver.(*ast.IdentExpr); ok {
+				pos := a.doc.nameAfter(endOf(ident), s.Name.Method)
+				a.addField(ident, s.Name.Method, pos, true, s.Func)
+				a.members[pos] = &member{object: ident, name: s.Name.Method, method: true}
+			}
+		}
+		a.function(s.Func, s.Name.Func == nil)
+	case *ast.ReturnStmt:
+		a.exprs(s.Exprs)
+	}
+}
+
+// isLocalFunction reports whether s is a "local function" statement rather than a local
+// assigned a function expression.
+func (a *analysis) isLocalFunction(s *ast.LocalAssignStmt) bool {
+	i := a.doc.tokenIndex(startOf(s))
+	return i >= 0 && i+1 < len(a.doc.tokens) && a.doc.tokens[i+1].Type == parse.TFunction
+}
+
+func (a *analysis) assign(lhs ast.Expr, value ast.Expr) {
+	switch e := lhs.(type) {
+	case *ast.IdentExpr:
+		if d := a.lookup(e.Value); d != nil {
+			a.refs[startOf(e)] = d
+		} else if _, ok := a.globals[e.Value]; !ok {
+			a.globals[e.Value] = &global{pos: startOf(e), value: value}
+			if tbl, ok := value.(*ast.TableExpr); ok {
+				a.tableFields(e.Value, nil, tbl)
+			}
+		}
+	case *ast.AttrGetExpr:
+		a.expr(e)
+		if ident, ok := e.Object.(*ast.IdentExpr); ok {
+			if key, ok := e.Key.(*ast.StringExpr); ok {
+				a.addField(ident, key.Value, startOf(key), false, value)
+			}
+		}
+	default:
+		a.expr(e)
+	}
+}
+
+func (a *analysis) addField(object *ast.IdentExpr, name string, pos ast.Position, method bool, value ast.Expr) {
+	a.fields = append(a.fields, &field{object: object.Value, decl: a.lookup(object.Value), name: name, pos: pos, method: method, value: value})
+}
+
+func (a *analysis) tableFields(object string, d *decl, tbl *ast.TableExpr) {
+	for _, f := range tbl.Fields {
+		if key, ok := f.Key.(*ast.StringExpr); ok {
+			a.fields = append(a.fields, &field{object: object, decl: d, name: key.Value, pos: startOf(key), value: f.Value})
+		}
+	}
+}
+
+func (a *analysis) function(fn *ast.FunctionExpr, method bool) {
+	a.openScope(startOf(fn), endOf(fn))
+	start := startOf(fn)
+	if method {
+		a.declare("self", declSelf, start, start, nil)
+	}
+	pos := start
+	for _, name := range fn.ParList.Names {
+		pos = a.doc.nameAfter(pos, name)
+		a.declare(name, declParam, pos, pos, nil)
+	}
+	a.block(fn.Stmts)
+	a.closeScope()
+}
+
+func (a *analysis) exprs(exprs []ast.Expr) {
+	for _, expr := range exprs {
+		a.expr(expr)
+	}
+}
+
+func (a *analysis) expr(expr ast.Expr) {
+	switch e := expr.(type) {
+	case *ast.IdentExpr:
+		if d := a.lookup(e.Value); d != nil {
+			a.refs[startOf(e)] = d
+		}
+	case *ast.AttrGetExpr:
+		a.expr(e.Object)
+		if key, ok := e.Key.(*ast.StringExpr); ok && key.Line() > 0 && a.isName(key) {
+			a.members[startOf(key)] = &member{object: e.Object, name: key.Value}
+		} else {
+			a.expr(e.Key)
+		}
+	case *ast.TableExpr:
+		for _, f := range e.Fields {
+			if f.Key != nil {
+				a.expr(f.Key)
+			}
+			a.expr(f.Value)
+		}
+	case *ast.FuncCallExpr:
+		if e.Func != nil {
+			a.expr(e.Func)
+		} else {
+			a.expr(e.Receiver)
+			pos := a.doc.nameAfter(endOf(e.Receiver), e.Method)
+			a.members[pos] = &member{object: e.Receiver, name: e.Method, method: true}
+		}
+		a.exprs(e.Args)
+	case *ast.LogicalOpExpr:
+		a.expr(e.Lhs)
+		a.expr(e.Rhs)
+	case *ast.RelationalOpExpr:
+		a.expr(e.Lhs)
+		a.expr(e.Rhs)
+	case *ast.StringConcatOpExpr:
+		a.expr(e.Lhs)
+		a.expr(e.Rhs)
+	case *ast.ArithmeticOpExpr:
+		a.expr(e.Lhs)
+		a.expr(e.Rhs)
+	case *ast.UnaryMinusOpExpr:
+		a.expr(e.Expr)
+	case *ast.UnaryNotOpExpr:
+		a.expr(e.Expr)
+	case *ast.UnaryLenOpExpr:
+		a.expr(e.Expr)
+	case *ast.FunctionExpr:
+		a.function(e, false)
+	}
+}
+
+// isName reports whether the key of a field access is a name, as in "t.name", rather than a
+// string, as in `t["name"]`.
+func (a *analysis) isName(key *ast.StringExpr) bool {
+	tok := a.doc.tokenAt(startOf(key))
+	return tok != nil && tok.Pos == startOf(key) && tok.Str == key.Value && tok.End.Column-tok.Pos.Column+1 == len(key.Value)
+}
+
+// visible returns the local variables visible at pos, the innermost first.
+func (a *analysis) visible(pos ast.Position) []*decl {
+	var decls []*decl
+	seen := map[string]bool{}
+	for i := len(a.scopes) - 1; i >= 0; i-- {
+		s := a.scopes[i]
+		if before(pos, s.start) || !before(pos, s.end) && pos != s.end {
+			continue
+		}
+		for j := len(s.decls) - 1; j >= 0; j-- {
+			d := s.decls[j]
+			if !seen[d.name] && !before(pos, d.visible) {
+				seen[d.name] = true
+				decls = append(decls, d)
+			}
+		}
+	}
+	return decls
+}
+
+// lookupAt returns the local variable name visible at pos, or nil.
+func (a *analysis) lookupAt(name string, pos ast.Position) *decl {
+	for _, d := range a.visible(pos) {
+		if d.name == name {
+			return d
+		}
+	}
+	return nil
+}
+
+// declAt returns the declaration named or referenced at pos.
+func (a *analysis) declAt(pos ast.Position) *decl {
+	if d, ok := a.refs[pos]; ok {
+		return d
+	}
+	for _, d := range a.decls {
+		if d.pos == pos && d.kind != declSelf {
+			return d
+		}
+	}
+	return nil
+}
+
+// fieldsOf returns the fields defined for the local d, or for the global name if d is nil.
+func (a *analysis) fieldsOf(d *decl, name string) []*field {
+	var fields []*field
+	for _, f := range a.fields {
+		if f.decl == d && (d != nil || f.object == name) {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// exports returns the fields of the table returned by the chunk.
+func (a *analysis) exports() []*field {
+	chunk := a.doc.chunk
+	if len(chunk) == 0 {
+		return nil
+	}
+	ret, ok := chunk[len(chunk)-1].(*ast.ReturnStmt)
+	if !ok || len(ret.Exprs) != 1 {
+		return nil
+	}
+	switch e := ret.Exprs[0].(type) {
+	case *ast.IdentExpr:
+		return a.fieldsOf(a.refs[startOf(e)], e.Value)
+	case *ast.TableExpr:
+		var fields []*field
+		for _, f := range e.Fields {
+			if key, ok := f.Key.(*ast.StringExpr); ok {
+				fields = append(fields, &field{name: key.Value, pos: startOf(key), value: f.Value})
+			}
+		}
+		return fields
+	}
+	return nil
+}
+
+// requiredModule returns the name of the module loaded by an expression of the form
+// require("name"), or "".
+func (a *analysis) requiredModule(expr ast.Expr) string {
+	call, ok := expr.(*ast.FuncCallExpr)
+	if !ok || call.Func == nil || len(call.Args) != 1 {
+		return ""
+	}
+	fn, ok := call.Func.(*ast.IdentExpr)
+	if !ok || fn.Value != "require" || a.refs[startOf(fn)] != nil {
+		return ""
+	}
+	if name, ok := call.Args[0].(*ast.StringExpr); ok {
+		return name.Value
+	}
+	return ""
+}
@@ -0,0 +1,207 @@
+package lsp
+
+import (
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/edunx/lua"
+	"github.com/edunx/lua/ast"
+	"github.com/edunx/lua/parse"
+)
+
+// document is an open or a required script and the result of its analysis.
+type document struct {
+	uri    string
+	path   string
+	text   string
+	lines  []string
+	tokens []ast.Token
+	chunk  []ast.Stmt
+	// syntax holds the syntax errors, and compile is the compile error of a chunk without
+	// syntax errors.
+	syntax  []*parse.Diagnostic
+	compile error
+	info    *analysis
+}
+
+func newDocument(uri, text string) *document {
+	doc := &document{uri: uri, path: uriToPath(uri), text: text}
+	doc.lines = strings.Split(text, "\n")
+	for i, line := range doc.lines {
+		doc.lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	name := filepath.Base(doc.path)
+	if doc.path == "" {
+		name = uri
+	}
+	doc.tokens = parse.Tokens(strings.NewReader(text), name)
+	for i := range doc.tokens {
+		// positions are compared with the ones of the nodes, which have no source.
+		doc.tokens[i].Pos.Source = ""
+		doc.tokens[i].End.Source = ""
+	}
+	doc.chunk, doc.syntax = parse.ParseRecover(strings.NewReader(text), name)
+	doc.info = analyze(doc)
+	if len(doc.syntax) == 0 {
+		// the compiler may change the tree, so it compiles a chunk of its own.
+		if chunk, err := parse.Parse(strings.NewReader(text), name); err == nil {
+			_, doc.compile = lua.Compile(chunk, name)
+		}
+	}
+	return doc
+}
+
+// uriToPath returns the path of a file URI, or "" for any other URI.
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+func pathToURI(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
+
+// lspPosition converts a 1-based line and byte column of the document to a protocol
+// position. A column past the end of the line is the end of the line.
+func (doc *document) lspPosition(line, column int) Position {
+	if line < 1 {
+		return Position{}
+	}
+	if line > len(doc.lines) {
+		last := len(doc.lines) - 1
+		return Position{last, utf16Len(doc.lines[last])}
+	}
+	text := doc.lines[line-1]
+	if column-1 < len(text) && column > 0 {
+		text = text[:column-1]
+	}
+	return Position{line - 1, utf16Len(text)}
+}
+
+// position converts a protocol position to a 1-based line and byte column.
+func (doc *document) position(pos Position) ast.Position {
+	if pos.Line < 0 || pos.Line >= len(doc.lines) {
+		return ast.Position{Line: pos.Line + 1, Column: 1}
+	}
+	text := doc.lines[pos.Line]
+	n := 0
+	for i, r := range text {
+		if n >= pos.Character {
+			return ast.Position{Line: pos.Line + 1, Column: i + 1}
+		}
+		n += len(utf16.Encode([]rune{r}))
+	}
+	return ast.Position{Line: pos.Line + 1, Column: len(text) + 1}
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		s = s[size:]
+		n += len(utf16.Encode([]rune{r}))
+	}
+	return n
+}
+
+// nodeRange returns the range of a node. The last column of a node is inclusive.
+func (doc *document) nodeRange(node ast.PositionHolder) Range {
+	start := doc.lspPosition(node.Line(), node.Column())
+	if node.LastLine() == 0 {
+		return Range{start, start}
+	}
+	return Range{start, doc.lspPosition(node.LastLine(), node.LastColumn()+1)}
+}
+
+// nameRange returns the range of the name starting at pos.
+func (doc *document) nameRange(pos ast.Position, name string) Range {
+	return Range{doc.lspPosition(pos.Line, pos.Column), doc.lspPosition(pos.Line, pos.Column+len(name))}
+}
+
+// lineRange returns the range of a line, without its indentation.
+func (doc *document) lineRange(line int) Range {
+	if line < 1 || line > len(doc.lines) {
+		return Range{doc.lspPosition(line, 1), doc.lspPosition(line, 1)}
+	}
+	text := doc.lines[line-1]
+	indent := len(text) - len(strings.TrimLeft(text, " \t"))
+	return Range{doc.lspPosition(line, indent+1), doc.lspPosition(line, len(text)+1)}
+}
+
+func before(a, b ast.Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+// tokenIndex returns the index of the last token starting at or before pos, or -1.
+func (doc *document) tokenIndex(pos ast.Position) int {
+	return sort.Search(len(doc.tokens), func(i int) bool {
+		return before(pos, doc.tokens[i].Pos)
+	}) - 1
+}
+
+// tokenAt returns the token covering pos, or nil.
+func (doc *document) tokenAt(pos ast.Position) *ast.Token {
+	i := doc.tokenIndex(pos)
+	if i < 0 {
+		return nil
+	}
+	tok := &doc.tokens[i]
+	if tok.Type < 0 || tok.End.Line != pos.Line || tok.End.Column+1 < pos.Column {
+		return nil
+	}
+	return tok
+}
+
+// nameAfter returns the position of the first identifier name that starts at or after pos,
+// or pos if there is none.
+func (doc *document) nameAfter(pos ast.Position, name string) ast.Position {
+	i := sort.Search(len(doc.tokens), func(i int) bool {
+		return !before(doc.tokens[i].Pos, pos)
+	})
+	for ; i < len(doc.tokens); i++ {
+		if tok := doc.tokens[i]; tok.Type == parse.TIdent && tok.Str == name {
+			return tok.Pos
+		}
+	}
+	return pos
+}
+
+// diagnostics returns the syntax errors, or the compile error, of the document.
+func (doc *document) diagnostics() []Diagnostic {
+	diags := []Diagnostic{}
+	for _, d := range doc.syntax {
+		var rng Range
+		switch {
+		case d.Start.Line == parse.EOF:
+			end := doc.lspPosition(len(doc.lines), len(doc.lines[len(doc.lines)-1])+1)
+			rng = Range{end, end}
+		case d.End == d.Start:
+			rng = Range{doc.lspPosition(d.Start.Line, d.Start.Column), doc.lspPosition(d.Start.Line, d.Start.Column+1)}
+		default:
+			rng = Range{doc.lspPosition(d.Start.Line, d.Start.Column), doc.lspPosition(d.End.Line, d.End.Column)}
+		}
+		msg := d.Message
+		if len(d.Expected) > 0 {
+			msg += ", expected '" + strings.Join(d.Expected, "', '") + "'"
+		}
+		diags = append(diags, Diagnostic{Range: rng, Severity: SeverityError, Code: d.Code, Source: "glua", Message: msg})
+	}
+	if cerr, ok := doc.compile.(*lua.CompileError); ok {
+		diags = append(diags, Diagnostic{Range: doc.lineRange(cerr.Line), Severity: SeverityError, Code: "compile-error", Source: "glua", Message: cerr.Message})
+	}
+	return diags
+}
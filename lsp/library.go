@@ -0,0 +1,102 @@
+package lsp
+
+import (
+	"sort"
+
+	"github.com/edunx/lua"
+)
+
+type entryKind int
+
+const (
+	entryValue entryKind = iota
+	entryFunction
+	entryTable
+	entryRock
+)
+
+// entry is a global registered by the libraries, or a field of a library table or a rock.
+type entry struct {
+	name string
+	kind entryKind
+	meta lua.Meta
+	// fields holds the fields of a table or a rock, sorted by name.
+	fields []*entry
+}
+
+// library holds the globals registered by a configuration of the libraries.
+type library struct {
+	globals map[string]*entry
+}
+
+// newLibrary describes the globals of L. The fields of a rock are the ones given by its
+// MetaProvider.
+func newLibrary(L *lua.LState) *library {
+	lib := &library{globals: map[string]*entry{}}
+	L.G.Global.ForEach(func(key, value lua.LValue) {
+		name, ok := key.(lua.LString)
+		if !ok || name == "_G" {
+			return
+		}
+		e := newEntry(L, string(name), string(name), value)
+		switch v := value.(type) {
+		case *lua.LTable:
+			v.ForEach(func(key, value lua.LValue) {
+				if field, ok := key.(lua.LString); ok {
+					e.fields = append(e.fields, newEntry(L, string(field), string(name)+"."+string(field), value))
+				}
+			})
+		case *lua.LightUserData:
+			if mp, ok := v.Value.(lua.MetaProvider); ok {
+				for field, meta := range mp.Meta() {
+					f := &entry{name: field, kind: entryValue, meta: meta}
+					if meta.Signature != "" {
+						f.kind = entryFunction
+					}
+					e.fields = append(e.fields, f)
+				}
+			}
+		}
+		sort.Slice(e.fields, func(i, j int) bool { return e.fields[i].name < e.fields[j].name })
+		lib.globals[string(name)] = e
+	})
+	return lib
+}
+
+func newEntry(L *lua.LState, name, fullname string, value lua.LValue) *entry {
+	e := &entry{name: name}
+	switch value.(type) {
+	case *lua.LFunction, *lua.GFunction:
+		e.kind = entryFunction
+	case *lua.LTable:
+		e.kind = entryTable
+	case *lua.LightUserData:
+		e.kind = entryRock
+	}
+	e.meta, _ = L.GetMeta(fullname)
+	return e
+}
+
+// lookup returns the global name, or its field if field is not "".
+func (lib *library) lookup(name, field string) *entry {
+	e := lib.globals[name]
+	if e == nil || field == "" {
+		return e
+	}
+	for _, f := range e.fields {
+		if f.name == field {
+			return f
+		}
+	}
+	return nil
+}
+
+// sorted returns the globals sorted by name.
+func (lib *library) sorted() []*entry {
+	entries := make([]*entry, 0, len(lib.globals))
+	for _, e := range lib.globals {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	return entries
+}
@@ -0,0 +1,574 @@
+// Package lsp implements a Language Server Protocol server for Lua scripts. It reports
+// syntax and compile errors, and provides document symbols, go-to-definition, hover and
+// completion.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/edunx/lua"
+	"github.com/edunx/lua/ast"
+	"github.com/edunx/lua/parse"
+)
+
+// Config configures the libraries known to the server.
+type Config struct {
+	// Options are the options of the state whose globals are offered by completion and hover.
+	Options lua.Options
+	// Open, if not nil, is called with the state to register more libraries or rocks. Rocks
+	// describe their fields by implementing lua.MetaProvider.
+	Open func(L *lua.LState)
+}
+
+// Server is a language server. It is not safe for concurrent use.
+type Server struct {
+	lib  *library
+	root string
+	docs map[string]*document
+	w    io.Writer
+	exit bool
+}
+
+// NewServer returns a server knowing the globals of a state created with config. A nil
+// config opens the standard libraries.
+func NewServer(config *Config) *Server {
+	var L *lua.LState
+	if config == nil {
+		L = lua.NewState()
+	} else {
+		L = lua.NewState(config.Options)
+		if config.Open != nil {
+			config.Open(L)
+		}
+	}
+	defer L.Close()
+	return &Server{lib: newLibrary(L), docs: map[string]*document{}}
+}
+
+// Serve reads the requests from r and writes the responses to w until the exit notification
+// or the end of r.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.w = w
+	reader := textproto.NewReader(bufio.NewReader(r))
+	for !s.exit {
+		header, err := reader.ReadMIMEHeader()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		length, err := strconv.Atoi(header.Get("Content-Length"))
+		if err != nil {
+			return fmt.Errorf("invalid Content-Length: %q", header.Get("Content-Length"))
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(reader.R, body); err != nil {
+			return err
+		}
+		if err := s.handle(body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) write(v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+func (s *Server) handle(body []byte) error {
+	var msg message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return s.write(errorResponse{"2.0", json.RawMessage("null"), &ResponseError{CodeParseError, err.Error()}})
+	}
+	result, err := s.dispatch(msg.Method, msg.Params)
+	if msg.ID == nil {
+		// notifications have no response.
+		return nil
+	}
+	if err != nil {
+		rerr, ok := err.(*ResponseError)
+		if !ok {
+			rerr = &ResponseError{CodeInvalidParams, err.Error()}
+		}
+		return s.write(errorResponse{"2.0", *msg.ID, rerr})
+	}
+	return s.write(response{"2.0", *msg.ID, result})
+}
+
+func (s *Server) dispatch(method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "initialize":
+		var p InitializeParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		s.root = uriToPath(p.RootURI)
+		var result InitializeResult
+		result.Capabilities.TextDocumentSync = 1
+		result.Capabilities.DocumentSymbolProvider = true
+		result.Capabilities.DefinitionProvider = true
+		result.Capabilities.HoverProvider = true
+		result.Capabilities.CompletionProvider.TriggerCharacters = []string{".", ":"}
+		result.ServerInfo.Name = "glua-lsp"
+		return result, nil
+	case "initialized", "$/cancelRequest":
+		return nil, nil
+	case "shutdown":
+		return nil, nil
+	case "exit":
+		s.exit = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var p DidOpenTextDocumentParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		return nil, s.update(p.TextDocument.URI, p.TextDocument.Text)
+	case "textDocument/didChange":
+		var p DidChangeTextDocumentParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		if n := len(p.ContentChanges); n > 0 {
+			return nil, s.update(p.TextDocument.URI, p.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var p DidCloseTextDocumentParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		delete(s.docs, p.TextDocument.URI)
+		return nil, s.write(notification{"2.0", "textDocument/publishDiagnostics", PublishDiagnosticsParams{p.TextDocument.URI, []Diagnostic{}}})
+	case "textDocument/documentSymbol":
+		var p DocumentSymbolParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		doc, err := s.document(p.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		return doc.symbols(doc.chunk, true), nil
+	case "textDocument/definition", "textDocument/hover", "textDocument/completion":
+		var p TextDocumentPositionParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		doc, err := s.document(p.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		pos := doc.position(p.Position)
+		switch method {
+		case "textDocument/definition":
+			return s.definition(doc, pos), nil
+		case "textDocument/hover":
+			return s.hover(doc, pos), nil
+		}
+		return s.completion(doc, pos), nil
+	}
+	return nil, &ResponseError{CodeMethodNotFound, "method not found: " + method}
+}
+
+func (s *Server) update(uri, text string) error {
+	doc := newDocument(uri, text)
+	s.docs[uri] = doc
+	return s.write(notification{"2.0", "textDocument/publishDiagnostics", PublishDiagnosticsParams{uri, doc.diagnostics()}})
+}
+
+func (s *Server) document(uri string) (*document, error) {
+	if doc, ok := s.docs[uri]; ok {
+		return doc, nil
+	}
+	return nil, &ResponseError{CodeInvalidParams, "unknown document: " + uri}
+}
+
+// module returns the document of the module loaded by require(name) from doc, looking in the
+// directory of doc and in the root directory of the workspace.
+func (s *Server) module(doc *document, name string) *document {
+	file := filepath.FromSlash(strings.Replace(name, ".", "/", -1))
+	var dirs []string
+	if doc.path != "" {
+		dirs = append(dirs, filepath.Dir(doc.path))
+	}
+	if s.root != "" {
+		dirs = append(dirs, s.root)
+	}
+	for _, dir := range dirs {
+		for _, path := range []string{filepath.Join(dir, file+".lua"), filepath.Join(dir, file, "init.lua")} {
+			uri := pathToURI(path)
+			if doc, ok := s.docs[uri]; ok {
+				return doc
+			}
+			if text, err := os.ReadFile(path); err == nil {
+				return newDocument(uri, string(text))
+			}
+		}
+	}
+	return nil
+}
+
+// target is what the identifier at a position refers to.
+type target struct {
+	doc  *document
+	name string
+	// decl is the local variable, or field the field of a table defined by a document.
+	decl  *decl
+	field *field
+	// entry is the library global or field, and lib its library for a field.
+	entry *entry
+	lib   string
+	// global is the global assigned by doc.
+	global *global
+}
+
+// resolve returns what the identifier at pos refers to, or nil.
+func (s *Server) resolve(doc *document, pos ast.Position) *target {
+	tok := doc.tokenAt(pos)
+	if tok == nil || tok.Type != parse.TIdent {
+		return nil
+	}
+	info := doc.info
+	if m, ok := info.members[tok.Pos]; ok {
+		return s.resolveMember(doc, m.object, tok.Str)
+	}
+	if d := info.declAt(tok.Pos); d != nil {
+		return &target{doc: doc, name: tok.Str, decl: d}
+	}
+	if g, ok := info.globals[tok.Str]; ok {
+		return &target{doc: doc, name: tok.Str, global: g}
+	}
+	if e := s.lib.lookup(tok.Str, ""); e != nil {
+		return &target{doc: doc, name: tok.Str, entry: e}
+	}
+	return nil
+}
+
+func (s *Server) resolveMember(doc *document, object ast.Expr, name string) *target {
+	for _, f := range s.fields(doc, object) {
+		if f.field.name == name {
+			return &target{doc: f.doc, name: name, field: f.field}
+		}
+	}
+	if ident, ok := object.(*ast.IdentExpr); ok && doc.info.refs[startOf(ident)] == nil {
+		if e := s.lib.lookup(ident.Value, name); e != nil {
+			return &target{doc: doc, name: name, entry: e, lib: ident.Value}
+		}
+	}
+	return nil
+}
+
+type docField struct {
+	doc   *document
+	field *field
+}
+
+// fields returns the fields defined by the documents for the table object.
+func (s *Server) fields(doc *document, object ast.Expr) []docField {
+	ident, ok := object.(*ast.IdentExpr)
+	if !ok {
+		return nil
+	}
+	return s.fieldsOf(doc, doc.info.refs[startOf(ident)], ident.Value)
+}
+
+func (s *Server) definition(doc *document, pos ast.Position) []Location {
+	locations := []Location{}
+	t := s.resolve(doc, pos)
+	switch {
+	case t == nil:
+	case t.decl != nil:
+		locations = append(locations, Location{t.doc.uri, t.doc.nameRange(t.decl.pos, t.decl.name)})
+	case t.field != nil:
+		locations = append(locations, Location{t.doc.uri, t.doc.nameRange(t.field.pos, t.field.name)})
+	case t.global != nil:
+		locations = append(locations, Location{t.doc.uri, t.doc.nameRange(t.global.pos, t.name)})
+	}
+	return locations
+}
+
+func (s *Server) hover(doc *document, pos ast.Position) *Hover {
+	t := s.resolve(doc, pos)
+	if t == nil {
+		return nil
+	}
+	var text, help string
+	switch {
+	case t.decl != nil:
+		switch t.decl.kind {
+		case declParam:
+			text = "(parameter) " + t.name
+		case declLoop:
+			text = "(loop variable) " + t.name
+		case declSelf:
+			text = "(parameter) self"
+		default:
+			if fn, ok := t.decl.value.(*ast.FunctionExpr); ok {
+				text = "local function " + t.name + signature(fn)
+			} else if mod := doc.info.requiredModule(t.decl.value); mod != "" {
+				text = "local " + t.name + " = require(" + strconv.Quote(mod) + ")"
+			} else {
+				text = "local " + t.name
+			}
+		}
+	case t.field != nil:
+		object := t.field.object
+		if object == "" {
+			object = strings.TrimSuffix(filepath.Base(t.doc.path), ".lua")
+		}
+		sep := "."
+		if t.field.method {
+			sep = ":"
+		}
+		if fn, ok := t.field.value.(*ast.FunctionExpr); ok {
+			text = "function " + object + sep + t.name + signature(fn)
+		} else {
+			text = "(field) " + object + sep + t.name
+		}
+	case t.global != nil:
+		if fn, ok := t.global.value.(*ast.FunctionExpr); ok {
+			text = "function " + t.name + signature(fn)
+		} else {
+			text = "(global) " + t.name
+		}
+	case t.entry != nil:
+		name := t.name
+		if t.lib != "" {
+			name = t.lib + "." + name
+		}
+		switch t.entry.kind {
+		case entryFunction:
+			text = "function " + name + t.entry.meta.Signature
+		case entryTable:
+			text = "(library) " + name
+		case entryRock:
+			text = "(rock) " + name
+		default:
+			text = "(global) " + name
+		}
+		help = t.entry.meta.Doc
+	}
+	value := "```lua\n" + text + "\n```"
+	if help != "" {
+		value += "\n\n" + help
+	}
+	tok := doc.tokenAt(pos)
+	rng := doc.nameRange(tok.Pos, tok.Str)
+	return &Hover{Contents: MarkupContent{"markdown", value}, Range: &rng}
+}
+
+func signature(fn *ast.FunctionExpr) string {
+	params := append([]string(nil), fn.ParList.Names...)
+	if fn.ParList.HasVargs {
+		params = append(params, "...")
+	}
+	return "(" + strings.Join(params, ", ") + ")"
+}
+
+var (
+	memberPattern = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_]*)\s*([.:])\s*([A-Za-z_][A-Za-z0-9_]*)?$`)
+	namePattern   = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+var keywords = []string{
+	"and", "break", "do", "else", "elseif", "end", "false", "for", "function", "if", "in",
+	"local", "nil", "not", "or", "repeat", "return", "then", "true", "until", "while",
+}
+
+func (s *Server) completion(doc *document, pos ast.Position) CompletionList {
+	list := CompletionList{Items: []CompletionItem{}}
+	if pos.Line < 1 || pos.Line > len(doc.lines) {
+		return list
+	}
+	text := doc.lines[pos.Line-1]
+	if pos.Column-1 < len(text) {
+		text = text[:pos.Column-1]
+	}
+	seen := map[string]bool{}
+	add := func(item CompletionItem, prefix string) {
+		if !seen[item.Label] && strings.HasPrefix(item.Label, prefix) {
+			seen[item.Label] = true
+			list.Items = append(list.Items, item)
+		}
+	}
+
+	if m := memberPattern.FindStringSubmatch(text); m != nil {
+		methods := m[2] == ":"
+		local := doc.info.lookupAt(m[1], pos)
+		for _, f := range s.fieldsOf(doc, local, m[1]) {
+			fn, isFunc := f.field.value.(*ast.FunctionExpr)
+			switch {
+			case isFunc:
+				add(CompletionItem{Label: f.field.name, Kind: CompletionFunction, Detail: "function " + f.field.name + signature(fn)}, m[3])
+			case !methods:
+				add(CompletionItem{Label: f.field.name, Kind: CompletionField}, m[3])
+			}
+		}
+		if local == nil {
+			if e := s.lib.lookup(m[1], ""); e != nil {
+				for _, f := range e.fields {
+					if f.kind == entryFunction {
+						add(CompletionItem{Label: f.name, Kind: CompletionFunction, Detail: "function " + m[1] + "." + f.name + f.meta.Signature, Documentation: f.meta.Doc}, m[3])
+					} else if !methods {
+						add(CompletionItem{Label: f.name, Kind: CompletionField, Documentation: f.meta.Doc}, m[3])
+					}
+				}
+			}
+		}
+		return list
+	}
+
+	prefix := namePattern.FindString(text)
+	for _, d := range doc.info.visible(pos) {
+		kind := CompletionVariable
+		if d.kind == declFunction {
+			kind = CompletionFunction
+		}
+		add(CompletionItem{Label: d.name, Kind: kind}, prefix)
+	}
+	for name, g := range doc.info.globals {
+		kind := CompletionVariable
+		if _, ok := g.value.(*ast.FunctionExpr); ok {
+			kind = CompletionFunction
+		}
+		add(CompletionItem{Label: name, Kind: kind}, prefix)
+	}
+	for _, e := range s.lib.sorted() {
+		item := CompletionItem{Label: e.name, Kind: CompletionVariable, Documentation: e.meta.Doc}
+		switch e.kind {
+		case entryFunction:
+			item.Kind = CompletionFunction
+			item.Detail = "function " + e.name + e.meta.Signature
+		case entryTable, entryRock:
+			item.Kind = CompletionModule
+		}
+		add(item, prefix)
+	}
+	for _, kw := range keywords {
+		add(CompletionItem{Label: kw, Kind: CompletionKeyword}, prefix)
+	}
+	return list
+}
+
+// fieldsOf returns the fields of the local d, or of the global name if d is nil: the fields
+// of a table defined by doc, or the exports of the module loaded into d.
+func (s *Server) fieldsOf(doc *document, d *decl, name string) []docField {
+	var fields []docField
+	for _, f := range doc.info.fieldsOf(d, name) {
+		fields = append(fields, docField{doc, f})
+	}
+	if d != nil && d.value != nil {
+		if mod := doc.info.requiredModule(d.value); mod != "" {
+			if m := s.module(doc, mod); m != nil {
+				for _, f := range m.info.exports() {
+					fields = append(fields, docField{m, f})
+				}
+			}
+		}
+	}
+	return fields
+}
+
+// symbols returns the symbols defined by stmts: the locals and globals of the chunk and the
+// functions, with the fields of the tables they are assigned.
+func (doc *document) symbols(stmts []ast.Stmt, top bool) []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+	add := func(name string, kind int, node ast.PositionHolder, pos ast.Position, value ast.Expr) {
+		sym := DocumentSymbol{Name: name, Kind: kind, Range: doc.nodeRange(node), SelectionRange: doc.nameRange(pos, name[strings.LastIndexAny(name, ".:")+1:])}
+		switch v := value.(type) {
+		case *ast.FunctionExpr:
+			if sym.Kind == SymbolVariable {
+				sym.Kind = SymbolFunction
+			}
+			sym.Detail = signature(v)
+			sym.Children = doc.symbols(v.Stmts, false)
+		case *ast.TableExpr:
+			for _, f := range v.Fields {
+				if key, ok := f.Key.(*ast.StringExpr); ok {
+					kind := SymbolVariable
+					if _, ok := f.Value.(*ast.FunctionExpr); ok {
+						kind = SymbolFunction
+					}
+					sym.Children = append(sym.Children, DocumentSymbol{Name: key.Value, Kind: kind, Range: doc.nodeRange(f.Value), SelectionRange: doc.nameRange(startOf(key), key.Value)})
+				}
+			}
+		}
+		if !top && sym.Kind == SymbolVariable {
+			return
+		}
+		symbols = append(symbols, sym)
+	}
+	for _, stmt := range stmts {
+		switch st := stmt.(type) {
+		case *ast.LocalAssignStmt:
+			pos := startOf(st)
+			for i, name := range st.Names {
+				pos = doc.nameAfter(pos, name)
+				var value ast.Expr
+				if i < len(st.Exprs) {
+					value = st.Exprs[i]
+				}
+				add(name, SymbolVariable, st, pos, value)
+			}
+		case *ast.AssignStmt:
+			if !top {
+				continue
+			}
+			for i, lhs := range st.Lhs {
+				var value ast.Expr
+				if i < len(st.Rhs) {
+					value = st.Rhs[i]
+				}
+				name, key := exprName(lhs)
+				if name == "" || doc.info.refs[startOf(lhs)] != nil {
+					continue
+				}
+				add(name, SymbolVariable, st, key, value)
+			}
+		case *ast.FuncDefStmt:
+			if st.Name.Func != nil {
+				if name, key := exprName(st.Name.Func); name != "" {
+					add(name, SymbolFunction, st, key, st.Func)
+				}
+			} else if name, _ := exprName(st.Name.Receiver); name != "" {
+				pos := doc.nameAfter(endOf(st.Name.Receiver), st.Name.Method)
+				add(name+":"+st.Name.Method, SymbolMethod, st, pos, st.Func)
+			}
+		}
+	}
+	return symbols
+}
+
+// exprName returns the dotted name of a variable or a field, as "a.b.c", and the position
+// of its last name.
+func exprName(expr ast.Expr) (string, ast.Position) {
+	switch e := expr.(type) {
+	case *ast.IdentExpr:
+		return e.Value, startOf(e)
+	case *ast.AttrGetExpr:
+		key, ok := e.Key.(*ast.StringExpr)
+		if !ok {
+			return "", ast.Position{}
+		}
+		if object, _ := exprName(e.Object); object != "" {
+			return object + "." + key.Value, startOf(key)
+		}
+	}
+	return "", ast.Position{}
+}
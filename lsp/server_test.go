@@ -0,0 +1,244 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/edunx/lua"
+)
+
+type testRock struct {
+	lua.Super
+}
+
+func (r *testRock) Meta() map[string]lua.Meta {
+	return map[string]lua.Meta{
+		"push":  {Signature: "(topic, msg)", Doc: "Sends msg to topic."},
+		"topic": {Doc: "The default topic."},
+	}
+}
+
+// session runs the requests against a server and returns its messages by id, and the
+// notifications by method.
+func session(t *testing.T, server *Server, requests []string) (map[int]json.RawMessage, map[string][]json.RawMessage) {
+	var in bytes.Buffer
+	for _, r := range requests {
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(r), r)
+	}
+	var out bytes.Buffer
+	if err := server.Serve(&in, &out); err != nil {
+		t.Fatal(err)
+	}
+	results := map[int]json.RawMessage{}
+	notifications := map[string][]json.RawMessage{}
+	reader := textproto.NewReader(bufio.NewReader(&out))
+	for {
+		header, err := reader.ReadMIMEHeader()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		n, _ := strconv.Atoi(header.Get("Content-Length"))
+		body := make([]byte, n)
+		if _, err := io.ReadFull(reader.R, body); err != nil {
+			t.Fatal(err)
+		}
+		var msg struct {
+			ID     *int            `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+			Result json.RawMessage `json:"result"`
+			Error  json.RawMessage `json:"error"`
+		}
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case msg.ID == nil:
+			notifications[msg.Method] = append(notifications[msg.Method], msg.Params)
+		case msg.Error != nil:
+			results[*msg.ID] = msg.Error
+		default:
+			results[*msg.ID] = msg.Result
+		}
+	}
+	return results, notifications
+}
+
+func request(id int, method string, params interface{}) string {
+	body, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params})
+	return string(body)
+}
+
+func notify(method string, params interface{}) string {
+	body, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+	return string(body)
+}
+
+func at(uri string, line, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{TextDocumentIdentifier{uri}, Position{line, character}}
+}
+
+func labels(t *testing.T, raw json.RawMessage) string {
+	var list CompletionList
+	if err := json.Unmarshal(raw, &list); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, item := range list.Items {
+		names = append(names, item.Label)
+	}
+	return strings.Join(names, " ")
+}
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+	mod := "local M = {}\n\nfunction M.greet(name, greeting)\n  return greeting .. name\nend\n\nreturn M\n"
+	if err := os.WriteFile(filepath.Join(dir, "greeter.lua"), []byte(mod), 0644); err != nil {
+		t.Fatal(err)
+	}
+	main := `local greeter = require("greeter")
+local count = 0
+
+local function add(n)
+  count = count + n
+  return count
+end
+
+print(greeter.greet("world", add(1)))
+str
+string.r
+kafka.
+`
+	broken := "local x = \nif then end\n"
+	uri := pathToURI(filepath.Join(dir, "main.lua"))
+	brokenURI := pathToURI(filepath.Join(dir, "broken.lua"))
+
+	server := NewServer(&Config{
+		Open: func(L *lua.LState) {
+			L.SetGlobal("kafka", L.NewLightUserData(&testRock{}))
+		},
+	})
+	results, notifications := session(t, server, []string{
+		request(1, "initialize", InitializeParams{RootURI: pathToURI(dir)}),
+		notify("initialized", struct{}{}),
+		notify("textDocument/didOpen", DidOpenTextDocumentParams{TextDocumentItem{URI: uri, Text: main}}),
+		notify("textDocument/didOpen", DidOpenTextDocumentParams{TextDocumentItem{URI: brokenURI, Text: broken}}),
+		request(2, "textDocument/documentSymbol", DocumentSymbolParams{TextDocumentIdentifier{uri}}),
+		request(3, "textDocument/definition", at(uri, 4, 10)),
+		request(4, "textDocument/definition", at(uri, 8, 15)),
+		request(5, "textDocument/hover", at(uri, 3, 17)),
+		request(6, "textDocument/hover", at(uri, 8, 16)),
+		request(7, "textDocument/completion", at(uri, 9, 3)),
+		request(8, "textDocument/completion", at(uri, 10, 8)),
+		request(9, "textDocument/completion", at(uri, 11, 6)),
+		request(10, "textDocument/hover", at(uri, 8, 1)),
+		request(11, "unknown/method", struct{}{}),
+		request(12, "shutdown", nil),
+		notify("exit", nil),
+	})
+
+	var init InitializeResult
+	if err := json.Unmarshal(results[1], &init); err != nil || !init.Capabilities.HoverProvider {
+		t.Errorf("unexpected initialize result %s", results[1])
+	}
+
+	published := notifications["textDocument/publishDiagnostics"]
+	if len(published) != 2 {
+		t.Fatalf("expected 2 diagnostics notifications, but got %d", len(published))
+	}
+	// the incomplete lines of main.lua are syntax errors.
+	var diags PublishDiagnosticsParams
+	json.Unmarshal(published[0], &diags)
+	if len(diags.Diagnostics) == 0 || diags.Diagnostics[0].Range.Start.Line < 9 {
+		t.Errorf("unexpected diagnostics for main.lua %v", diags.Diagnostics)
+	}
+	json.Unmarshal(published[1], &diags)
+	if len(diags.Diagnostics) == 0 || diags.Diagnostics[0].Range.Start.Line != 1 {
+		t.Errorf("unexpected diagnostics for broken.lua %v", diags.Diagnostics)
+	}
+
+	var symbols []DocumentSymbol
+	json.Unmarshal(results[2], &symbols)
+	var names []string
+	for _, sym := range symbols {
+		names = append(names, fmt.Sprintf("%s:%d", sym.Name, sym.Kind))
+	}
+	if got := strings.Join(names, " "); got != "greeter:13 count:13 add:12" {
+		t.Errorf("unexpected symbols %q", got)
+	}
+
+	cases := []struct {
+		id       int
+		expected string
+	}{
+		// count in add refers to the local of line 2.
+		{3, `[{"uri":"` + uri + `","range":{"start":{"line":1,"character":6},"end":{"line":1,"character":11}}}]`},
+		// greeter.greet is defined by the required module.
+		{4, `[{"uri":"` + pathToURI(filepath.Join(dir, "greeter.lua")) + `","range":{"start":{"line":2,"character":11},"end":{"line":2,"character":16}}}]`},
+		{11, `{"code":-32601,"message":"method not found: unknown/method"}`},
+	}
+	for _, c := range cases {
+		if got := string(results[c.id]); got != c.expected {
+			t.Errorf("%d: expected %s, but got %s", c.id, c.expected, got)
+		}
+	}
+
+	hovers := []struct {
+		id       int
+		expected string
+	}{
+		{5, "local function add(n)"},
+		{6, "function M.greet(name, greeting)"},
+		{10, "function print(...)"},
+	}
+	for _, c := range hovers {
+		var hover Hover
+		json.Unmarshal(results[c.id], &hover)
+		if !strings.Contains(hover.Contents.Value, c.expected) {
+			t.Errorf("%d: expected %q in %q", c.id, c.expected, hover.Contents.Value)
+		}
+	}
+
+	if got := labels(t, results[7]); got != "string" {
+		t.Errorf("unexpected completion of str: %q", got)
+	}
+	if got := labels(t, results[8]); got != "rep reverse" {
+		t.Errorf("unexpected completion of string.r: %q", got)
+	}
+	if got := labels(t, results[9]); got != "push topic" {
+		t.Errorf("unexpected completion of kafka.: %q", got)
+	}
+}
+
+func TestVisibleLocals(t *testing.T) {
+	src := "local a = 1\nlocal function f(b)\n  local c = b\n  \nend\nlocal d = a\n"
+	doc := newDocument("file:///test.lua", src)
+	cases := []struct {
+		pos      Position
+		expected string
+	}{
+		{Position{0, 0}, ""},
+		{Position{3, 2}, "c b f a"},
+		{Position{5, 0}, "f a"},
+	}
+	for _, c := range cases {
+		var names []string
+		for _, d := range doc.info.visible(doc.position(c.pos)) {
+			names = append(names, d.name)
+		}
+		if got := strings.Join(names, " "); got != c.expected {
+			t.Errorf("%v: expected %q, but got %q", c.pos, c.expected, got)
+		}
+	}
+}
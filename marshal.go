@@ -0,0 +1,685 @@
+package lua
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* struct fields {{{ */
+
+type structField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+var structFieldsCache sync.Map // map[reflect.Type][]structField
+
+// structFields returns the fields of a struct type that are visible to Lua. The name of a field is
+// taken from its `lua:"name"` tag or defaults to the Go field name. Fields of embedded structs
+// without a tag are promoted, and fields tagged with `lua:"-"` are skipped.
+func structFields(t reflect.Type) []structField {
+	if fields, ok := structFieldsCache.Load(t); ok {
+		return fields.([]structField)
+	}
+	fields := []structField{}
+	seen := map[string]bool{}
+	var walk func(t reflect.Type, index []int)
+	walk = func(t reflect.Type, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("lua")
+			if tag == "-" {
+				continue
+			}
+			name, opts := tag, ""
+			if idx := strings.Index(tag, ","); idx >= 0 {
+				name, opts = tag[:idx], tag[idx+1:]
+			}
+			fidx := append(append([]int{}, index...), i)
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if f.Anonymous && name == "" && ft.Kind() == reflect.Struct && ft != timeType {
+				if f.Type.Kind() == reflect.Struct {
+					walk(ft, fidx)
+				}
+				continue
+			}
+			if f.PkgPath != "" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			fields = append(fields, structField{name, fidx, strings.Contains(opts, "omitempty")})
+		}
+	}
+	walk(t, nil)
+	structFieldsCache.Store(t, fields)
+	return fields
+}
+
+/* }}} */
+
+/* Marshal {{{ */
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	lvalueType   = reflect.TypeOf((*LValue)(nil)).Elem()
+	rockType     = reflect.TypeOf((*rock)(nil)).Elem()
+	gfuncType    = reflect.TypeOf(LGFunction(nil))
+)
+
+type marshaler struct {
+	L    *LState
+	seen map[seenKey]*LTable
+}
+
+// seenKey identifies the Go value a table was made from. The address alone is not enough:
+// a struct and its first field, a slice and its prefix, or two empty slices can share it.
+type seenKey struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+// marshalKey returns the key of a pointer, slice or map. It reports false for values that refer
+// to no memory, which must not share a table.
+func marshalKey(rv reflect.Value) (seenKey, bool) {
+	switch rv.Kind() {
+	case reflect.Ptr:
+		return seenKey{rv.Pointer(), rv.Type(), 0}, rv.Type().Elem().Size() > 0
+	case reflect.Slice:
+		return seenKey{rv.Pointer(), rv.Type(), rv.Len()}, rv.Len() > 0 && rv.Type().Elem().Size() > 0
+	}
+	return seenKey{rv.Pointer(), rv.Type(), 0}, true
+}
+
+// lookup returns the table already made from rv.
+func (m *marshaler) lookup(rv reflect.Value) (*LTable, bool) {
+	key, ok := marshalKey(rv)
+	if !ok {
+		return nil, false
+	}
+	tb, ok := m.seen[key]
+	return tb, ok
+}
+
+// remember records that tb was made from rv.
+func (m *marshaler) remember(rv reflect.Value, tb *LTable) {
+	if key, ok := marshalKey(rv); ok {
+		m.seen[key] = tb
+	}
+}
+
+// Marshal converts a Go value into an LValue.
+//
+// Booleans, numbers and strings are converted to their Lua counterparts, []byte and
+// time.Duration values to strings and time.Time values to RFC 3339 strings. Structs,
+// maps, slices and arrays become tables; struct fields are named by their `lua:"name"`
+// tag. Pointers are followed, and shared or cyclic pointers, maps and slices of the same
+// type and length are converted to the same table. LValues are returned as they are, LGFunctions are
+// wrapped into functions and rocks into LightUserData. Any other value is wrapped
+// into an LUserData.
+func Marshal(L *LState, v interface{}) LValue {
+	m := &marshaler{L: L, seen: map[seenKey]*LTable{}}
+	return m.marshal(reflect.ValueOf(v))
+}
+
+func (m *marshaler) marshal(rv reflect.Value) LValue {
+	if !rv.IsValid() {
+		return LNil
+	}
+	if rv.Type().Implements(lvalueType) {
+		if rv.Kind() == reflect.Interface || rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				return LNil
+			}
+		}
+		return rv.Interface().(LValue)
+	}
+	if rv.Type().Implements(rockType) {
+		if rv.Kind() == reflect.Ptr && rv.IsNil() {
+			return LNil
+		}
+		return m.L.NewLightUserData(rv.Interface().(rock))
+	}
+
+	switch rv.Type() {
+	case timeType:
+		return LString(rv.Interface().(time.Time).Format(time.RFC3339Nano))
+	case durationType:
+		return LString(time.Duration(rv.Int()).String())
+	case gfuncType:
+		if rv.IsNil() {
+			return LNil
+		}
+		return m.L.NewFunction(rv.Interface().(LGFunction))
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		return LBool(rv.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return LNumber(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return LNumber(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return LNumber(rv.Float())
+	case reflect.String:
+		return LString(rv.String())
+	case reflect.Interface:
+		if rv.IsNil() {
+			return LNil
+		}
+		return m.marshal(rv.Elem())
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return LNil
+		}
+		if rv.Elem().Kind() != reflect.Struct {
+			return m.marshal(rv.Elem())
+		}
+		if tb, ok := m.lookup(rv); ok {
+			return tb
+		}
+		tb := m.L.NewTable()
+		m.remember(rv, tb)
+		m.marshalStruct(tb, rv.Elem())
+		return tb
+	case reflect.Struct:
+		tb := m.L.NewTable()
+		m.marshalStruct(tb, rv)
+		return tb
+	case reflect.Slice:
+		if rv.IsNil() {
+			return LNil
+		}
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return LString(rv.Bytes())
+		}
+		if tb, ok := m.lookup(rv); ok {
+			return tb
+		}
+		tb := m.L.CreateTable(rv.Len(), 0)
+		m.remember(rv, tb)
+		m.marshalArray(tb, rv)
+		return tb
+	case reflect.Array:
+		tb := m.L.CreateTable(rv.Len(), 0)
+		m.marshalArray(tb, rv)
+		return tb
+	case reflect.Map:
+		if rv.IsNil() {
+			return LNil
+		}
+		if tb, ok := m.lookup(rv); ok {
+			return tb
+		}
+		tb := m.L.CreateTable(0, rv.Len())
+		m.remember(rv, tb)
+		iter := rv.MapRange()
+		for iter.Next() {
+			key := m.marshal(iter.Key())
+			if key == LNil {
+				continue
+			}
+			if n, ok := key.(LNumber); ok && math.IsNaN(float64(n)) {
+				continue
+			}
+			tb.RawSet(key, m.marshal(iter.Value()))
+		}
+		return tb
+	}
+
+	ud := m.L.NewUserData()
+	ud.Value = rv.Interface()
+	return ud
+}
+
+func (m *marshaler) marshalArray(tb *LTable, rv reflect.Value) {
+	for i := 0; i < rv.Len(); i++ {
+		tb.RawSetInt(i+1, m.marshal(rv.Index(i)))
+	}
+}
+
+func (m *marshaler) marshalStruct(tb *LTable, rv reflect.Value) {
+	for _, f := range structFields(rv.Type()) {
+		fv, ok := fieldByIndex(rv, f.index, false)
+		if !ok {
+			continue
+		}
+		if f.omitEmpty && fv.IsZero() {
+			continue
+		}
+		tb.RawSetString(f.name, m.marshal(fv))
+	}
+}
+
+// fieldByIndex is like reflect.Value.FieldByIndex, but it reports nil embedded pointers
+// instead of panicking, or allocates them if alloc is true.
+func fieldByIndex(rv reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				if !alloc {
+					return reflect.Value{}, false
+				}
+				rv.Set(reflect.New(rv.Type().Elem()))
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(x)
+	}
+	return rv, true
+}
+
+/* }}} */
+
+/* Unmarshal {{{ */
+
+// UnmarshalError describes a value that could not be stored into a Go value. Path is the location of
+// the value in the Lua data, for example `config.servers[2].port`.
+type UnmarshalError struct {
+	Path    string
+	Message string
+}
+
+func (e *UnmarshalError) Error() string {
+	if len(e.Path) == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+type unmarshaler struct {
+	path []string
+	// visiting holds the tables being stored, a table found inside itself is an error.
+	visiting map[*LTable]bool
+}
+
+func (u *unmarshaler) push(elem string) { u.path = append(u.path, elem) }
+
+func (u *unmarshaler) pop() { u.path = u.path[:len(u.path)-1] }
+
+func (u *unmarshaler) pushKey(key LValue) {
+	switch k := key.(type) {
+	case LNumber:
+		u.push("[" + k.String() + "]")
+	case LString:
+		u.push("." + string(k))
+	default:
+		u.push("[" + k.String() + "]")
+	}
+}
+
+func (u *unmarshaler) enter(tb *LTable) error {
+	if u.visiting[tb] {
+		return u.errorf("cyclic table")
+	}
+	if u.visiting == nil {
+		u.visiting = map[*LTable]bool{}
+	}
+	u.visiting[tb] = true
+	return nil
+}
+
+func (u *unmarshaler) leave(tb *LTable) { delete(u.visiting, tb) }
+
+func (u *unmarshaler) errorf(format string, args ...interface{}) error {
+	path := strings.TrimPrefix(strings.Join(u.path, ""), ".")
+	return &UnmarshalError{path, fmt.Sprintf(format, args...)}
+}
+
+func (u *unmarshaler) typeError(expected string, lv LValue) error {
+	return u.errorf("%s expected, got %s", expected, lv.Type().String())
+}
+
+// Unmarshal stores an LValue into the Go value pointed to by v. It is the inverse of Marshal:
+// tables are stored into structs (using `lua:"name"` tags), maps, slices and arrays, numbers into
+// any numeric type as long as they fit, and LightUserData into fields of the rock's type. Unknown
+// table keys are ignored, and a table found inside itself is an error. The returned error is an
+// *UnmarshalError carrying the path of the offending value.
+func Unmarshal(lv LValue, v interface{}) error {
+	return unmarshalPath(lv, v, "")
+}
+
+// UnmarshalGlobal stores the global variable name into v. Error paths start with the variable name.
+func (ls *LState) UnmarshalGlobal(name string, v interface{}) error {
+	return unmarshalPath(ls.GetGlobal(name), v, name)
+}
+
+func unmarshalPath(lv LValue, v interface{}, root string) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return &UnmarshalError{"", fmt.Sprintf("non-nil pointer expected, got %T", v)}
+	}
+	u := &unmarshaler{}
+	if len(root) > 0 {
+		u.push(root)
+	}
+	return u.unmarshal(lv, rv.Elem())
+}
+
+func (u *unmarshaler) unmarshal(lv LValue, rv reflect.Value) error {
+	if lv == nil {
+		lv = LNil
+	}
+	rt := rv.Type()
+
+	// LValues and rocks are stored as they are
+	if rt.Implements(lvalueType) || rt == lvalueType {
+		if reflect.TypeOf(lv).AssignableTo(rt) {
+			rv.Set(reflect.ValueOf(lv))
+			return nil
+		}
+		if lv == LNil {
+			rv.Set(reflect.Zero(rt))
+			return nil
+		}
+	}
+	if ud, ok := lv.(*LightUserData); ok && ud.Value != nil && reflect.TypeOf(ud.Value).AssignableTo(rt) {
+		rv.Set(reflect.ValueOf(ud.Value))
+		return nil
+	}
+	if ud, ok := lv.(*LUserData); ok && ud.Value != nil && reflect.TypeOf(ud.Value).AssignableTo(rt) {
+		rv.Set(reflect.ValueOf(ud.Value))
+		return nil
+	}
+
+	switch rt {
+	case timeType:
+		switch t := lv.(type) {
+		case LString:
+			tm, err := time.Parse(time.RFC3339Nano, string(t))
+			if err != nil {
+				return u.errorf("invalid time %q", string(t))
+			}
+			rv.Set(reflect.ValueOf(tm))
+		case LNumber:
+			sec, frac := math.Modf(float64(t))
+			rv.Set(reflect.ValueOf(time.Unix(int64(sec), int64(frac*1e9))))
+		default:
+			return u.typeError("time", lv)
+		}
+		return nil
+	case durationType:
+		switch d := lv.(type) {
+		case LString:
+			dur, err := time.ParseDuration(string(d))
+			if err != nil {
+				return u.errorf("invalid duration %q", string(d))
+			}
+			rv.SetInt(int64(dur))
+		case LNumber:
+			rv.SetInt(int64(float64(d) * float64(time.Second)))
+		default:
+			return u.typeError("duration", lv)
+		}
+		return nil
+	}
+
+	switch rt.Kind() {
+	case reflect.Ptr:
+		if lv == LNil {
+			rv.Set(reflect.Zero(rt))
+			return nil
+		}
+		if rv.IsNil() {
+			rv.Set(reflect.New(rt.Elem()))
+		}
+		return u.unmarshal(lv, rv.Elem())
+	case reflect.Interface:
+		if lv == LNil {
+			rv.Set(reflect.Zero(rt))
+			return nil
+		}
+		if rt.NumMethod() != 0 {
+			return u.errorf("cannot store %s into %s", lv.Type().String(), rt.String())
+		}
+		gv, err := u.toInterface(lv)
+		if err != nil {
+			return err
+		}
+		if gv == nil {
+			rv.Set(reflect.Zero(rt))
+		} else {
+			rv.Set(reflect.ValueOf(gv))
+		}
+		return nil
+	case reflect.Bool:
+		b, ok := lv.(LBool)
+		if !ok {
+			return u.typeError("boolean", lv)
+		}
+		rv.SetBool(bool(b))
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := u.toNumber(lv)
+		if err != nil {
+			return err
+		}
+		if !isInteger(n) {
+			return u.errorf("number has no integer representation: %v", n)
+		}
+		if rv.OverflowInt(int64(n)) || float64(n) != float64(int64(n)) {
+			return u.errorf("number %v overflows %s", n, rt.String())
+		}
+		rv.SetInt(int64(n))
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := u.toNumber(lv)
+		if err != nil {
+			return err
+		}
+		if !isInteger(n) {
+			return u.errorf("number has no integer representation: %v", n)
+		}
+		if n < 0 || n >= LNumber(math.MaxUint64) || rv.OverflowUint(uint64(n)) {
+			return u.errorf("number %v overflows %s", n, rt.String())
+		}
+		rv.SetUint(uint64(n))
+		return nil
+	case reflect.Float32, reflect.Float64:
+		n, err := u.toNumber(lv)
+		if err != nil {
+			return err
+		}
+		if rv.OverflowFloat(float64(n)) {
+			return u.errorf("number %v overflows %s", n, rt.String())
+		}
+		rv.SetFloat(float64(n))
+		return nil
+	case reflect.String:
+		if !LVCanConvToString(lv) {
+			return u.typeError("string", lv)
+		}
+		rv.SetString(LVAsString(lv))
+		return nil
+	case reflect.Slice:
+		if rt.Elem().Kind() == reflect.Uint8 {
+			if s, ok := lv.(LString); ok {
+				rv.SetBytes([]byte(s))
+				return nil
+			}
+		}
+		if lv == LNil {
+			rv.Set(reflect.Zero(rt))
+			return nil
+		}
+		tb, ok := lv.(*LTable)
+		if !ok {
+			return u.typeError("table", lv)
+		}
+		if err := u.enter(tb); err != nil {
+			return err
+		}
+		n := tb.Len()
+		sl := reflect.MakeSlice(rt, n, n)
+		for i := 0; i < n; i++ {
+			u.push("[" + strconv.Itoa(i+1) + "]")
+			if err := u.unmarshal(tb.RawGetInt(i+1), sl.Index(i)); err != nil {
+				return err
+			}
+			u.pop()
+		}
+		u.leave(tb)
+		rv.Set(sl)
+		return nil
+	case reflect.Array:
+		tb, ok := lv.(*LTable)
+		if !ok {
+			return u.typeError("table", lv)
+		}
+		if tb.Len() > rv.Len() {
+			return u.errorf("too many elements for %s: %d", rt.String(), tb.Len())
+		}
+		if err := u.enter(tb); err != nil {
+			return err
+		}
+		for i := 0; i < rv.Len(); i++ {
+			u.push("[" + strconv.Itoa(i+1) + "]")
+			if err := u.unmarshal(tb.RawGetInt(i+1), rv.Index(i)); err != nil {
+				return err
+			}
+			u.pop()
+		}
+		u.leave(tb)
+		return nil
+	case reflect.Map:
+		if lv == LNil {
+			rv.Set(reflect.Zero(rt))
+			return nil
+		}
+		tb, ok := lv.(*LTable)
+		if !ok {
+			return u.typeError("table", lv)
+		}
+		if err := u.enter(tb); err != nil {
+			return err
+		}
+		mp := reflect.MakeMapWithSize(rt, 0)
+		var err error
+		tb.ForEach(func(key, value LValue) {
+			if err != nil {
+				return
+			}
+			u.pushKey(key)
+			kv := reflect.New(rt.Key()).Elem()
+			if err = u.unmarshal(key, kv); err != nil {
+				return
+			}
+			vv := reflect.New(rt.Elem()).Elem()
+			if err = u.unmarshal(value, vv); err != nil {
+				return
+			}
+			mp.SetMapIndex(kv, vv)
+			u.pop()
+		})
+		if err != nil {
+			return err
+		}
+		u.leave(tb)
+		rv.Set(mp)
+		return nil
+	case reflect.Struct:
+		tb, ok := lv.(*LTable)
+		if !ok {
+			return u.typeError("table", lv)
+		}
+		if err := u.enter(tb); err != nil {
+			return err
+		}
+		for _, f := range structFields(rt) {
+			value := tb.RawGetString(f.name)
+			if value == LNil {
+				continue
+			}
+			fv, _ := fieldByIndex(rv, f.index, true)
+			u.push("." + f.name)
+			if err := u.unmarshal(value, fv); err != nil {
+				return err
+			}
+			u.pop()
+		}
+		u.leave(tb)
+		return nil
+	}
+	return u.errorf("cannot store %s into %s", lv.Type().String(), rt.String())
+}
+
+func (u *unmarshaler) toNumber(lv LValue) (LNumber, error) {
+	switch n := lv.(type) {
+	case LNumber:
+		return n, nil
+	case LString:
+		if num, err := parseNumber(string(n)); err == nil {
+			return num, nil
+		}
+	}
+	return 0, u.typeError("number", lv)
+}
+
+// toInterface converts an LValue into a plain Go value: tables become []interface{} when they
+// only have array elements and map[string]interface{} otherwise.
+func (u *unmarshaler) toInterface(lv LValue) (interface{}, error) {
+	switch v := lv.(type) {
+	case *LNilType:
+		return nil, nil
+	case LBool:
+		return bool(v), nil
+	case LNumber:
+		return float64(v), nil
+	case LString:
+		return string(v), nil
+	case *LightUserData:
+		return v.Value, nil
+	case *LUserData:
+		return v.Value, nil
+	case *LTable:
+		n := v.Len()
+		if n > 0 && v.MaxN() == n && len(v.strdict) == 0 && len(v.dict) == 0 {
+			var arr []interface{}
+			err := u.unmarshal(v, reflect.ValueOf(&arr).Elem())
+			return arr, err
+		}
+		if err := u.enter(v); err != nil {
+			return nil, err
+		}
+		mp := map[string]interface{}{}
+		var err error
+		v.ForEach(func(key, value LValue) {
+			if err != nil {
+				return
+			}
+			u.pushKey(key)
+			var gv interface{}
+			if gv, err = u.toInterface(value); err != nil {
+				return
+			}
+			if LVCanConvToString(key) {
+				mp[LVAsString(key)] = gv
+			} else {
+				mp[key.String()] = gv
+			}
+			u.pop()
+		})
+		u.leave(v)
+		return mp, err
+	}
+	return lv, nil
+}
+
+/* }}} */
@@ -0,0 +1,153 @@
+package lua
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testServer struct {
+	Host    string `lua:"host"`
+	Port    int    `lua:"port"`
+	Enabled *bool  `lua:"enabled"`
+}
+
+type testConfig struct {
+	Name     string            `lua:"name"`
+	Servers  []testServer      `lua:"servers"`
+	Labels   map[string]string `lua:"labels"`
+	Started  time.Time         `lua:"started"`
+	Timeout  time.Duration     `lua:"timeout"`
+	Ratio    float64           `lua:"ratio,omitempty"`
+	Internal string            `lua:"-"`
+	Extra    interface{}       `lua:"extra"`
+	Rock     *testRock         `lua:"rock"`
+}
+
+type testRock struct {
+	Super
+	name string
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	enabled := true
+	cfg := testConfig{
+		Name:     "svc",
+		Servers:  []testServer{{"a", 80, &enabled}, {"b", 81, nil}},
+		Labels:   map[string]string{"env": "prod"},
+		Started:  time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Timeout:  1500 * time.Millisecond,
+		Internal: "secret",
+		Extra:    []interface{}{1.0, "x"},
+		Rock:     &testRock{name: "r1"},
+	}
+	L.SetGlobal("config", Marshal(L, cfg))
+	errorIfScriptFail(t, L, `
+	assert(config.name == "svc")
+	assert(config.servers[2].port == 81)
+	assert(config.servers[1].enabled == true)
+	assert(config.servers[2].enabled == nil)
+	assert(config.labels.env == "prod")
+	assert(config.started == "2020-01-02T03:04:05Z")
+	assert(config.timeout == "1.5s")
+	assert(config.ratio == nil)
+	assert(config.Internal == nil)
+	assert(config.extra[2] == "x")
+	assert(type(config.rock) == "ligthuserdata")
+	`)
+
+	var out testConfig
+	errorIfNotNil(t, L.UnmarshalGlobal("config", &out))
+	out.Internal = cfg.Internal
+	errorIfFalse(t, reflect.DeepEqual(cfg, out), "round trip mismatch: %#v", out)
+}
+
+func TestMarshalCycles(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	type node struct {
+		Next *node
+	}
+	n := &node{}
+	n.Next = n
+	tb := Marshal(L, n).(*LTable)
+	errorIfNotEqual(t, LValue(tb), tb.RawGetString("Next"))
+	errorIfNotEqual(t, LNil, Marshal(L, nil))
+	errorIfNotEqual(t, LValue(LString("abc")), Marshal(L, []byte("abc")))
+
+	// values sharing an address are not the same table
+	empty := Marshal(L, []interface{}{[]string{}, []int{}}).(*LTable)
+	errorIfFalse(t, empty.RawGetInt(1) != empty.RawGetInt(2), "empty slices must not share a table")
+	type inner struct{ V int }
+	type outer struct {
+		In inner
+		P  *inner
+	}
+	o := &outer{In: inner{V: 1}}
+	o.P = &o.In
+	otb := Marshal(L, o).(*LTable)
+	ptb := otb.RawGetString("P").(*LTable)
+	errorIfNotEqual(t, LValue(LNumber(1)), ptb.RawGetString("V"))
+	errorIfNotEqual(t, LNil, ptb.RawGetString("In"))
+	s := []int{1, 2, 3}
+	pair := Marshal(L, struct{ A, B []int }{s[:1], s}).(*LTable)
+	errorIfNotEqual(t, 1, pair.RawGetString("A").(*LTable).Len())
+	errorIfNotEqual(t, 3, pair.RawGetString("B").(*LTable).Len())
+	shared := Marshal(L, struct{ A, B []int }{s, s}).(*LTable)
+	errorIfNotEqual(t, shared.RawGetString("A"), shared.RawGetString("B"))
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	var cfg testConfig
+	errorIfScriptFail(t, L, `config = {servers = {{host = "a", port = 1}, {host = "b", port = "x"}}}`)
+	err := L.UnmarshalGlobal("config", &cfg)
+	errorIfNotEqual(t, "config.servers[2].port: number expected, got string", err.Error())
+	errorIfNotEqual(t, "servers[2].port", Unmarshal(L.GetGlobal("config"), &cfg).(*UnmarshalError).Path)
+
+	errorIfScriptFail(t, L, `config = {servers = {{port = 1.5}}}`)
+	err = L.UnmarshalGlobal("config", &cfg)
+	errorIfNotEqual(t, "config.servers[1].port: number has no integer representation: 1.5", err.Error())
+
+	var small struct{ N int8 }
+	errorIfScriptFail(t, L, `v = {N = 300}`)
+	errorIfNotEqual(t, "v.N: number 300 overflows int8", L.UnmarshalGlobal("v", &small).Error())
+
+	var m map[string]int
+	errorIfScriptFail(t, L, `v = {a = 1, b = true}`)
+	errorIfNotEqual(t, "v.b: number expected, got boolean", L.UnmarshalGlobal("v", &m).Error())
+
+	errorIfNil(t, Unmarshal(LNumber(1), nil))
+
+	var any interface{}
+	errorIfScriptFail(t, L, `v = {}; v.self = v`)
+	errorIfNotEqual(t, "v.self: cyclic table", L.UnmarshalGlobal("v", &any).Error())
+	errorIfScriptFail(t, L, `v = {1}; v[2] = v`)
+	errorIfNotEqual(t, "v[2]: cyclic table", L.UnmarshalGlobal("v", &any).Error())
+	type node struct {
+		Next *node
+	}
+	var n node
+	errorIfScriptFail(t, L, `v = {}; v.Next = v`)
+	errorIfNotEqual(t, "v.Next: cyclic table", L.UnmarshalGlobal("v", &n).Error())
+	// a table may be shared as long as it is not inside itself
+	errorIfScriptFail(t, L, `local t = {1}; v = {t, t}`)
+	errorIfNotNil(t, L.UnmarshalGlobal("v", &any))
+}
+
+func TestUnmarshalInterface(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	errorIfScriptFail(t, L, `v = {list = {1, 2, 3}, obj = {k = "v"}, flag = false}`)
+	var v interface{}
+	errorIfNotNil(t, L.UnmarshalGlobal("v", &v))
+	expected := map[string]interface{}{
+		"list": []interface{}{1.0, 2.0, 3.0},
+		"obj":  map[string]interface{}{"k": "v"},
+		"flag": false,
+	}
+	errorIfFalse(t, reflect.DeepEqual(expected, v), "unexpected value: %#v", v)
+}
@@ -0,0 +1,133 @@
+package lua
+
+// Meta describes a global, a library function or a field of a rock to development tools
+// such as the language server in cmd/glua-lsp.
+type Meta struct {
+	// Signature is the parameter list of a function, as "(s, n [, sep])".
+	Signature string
+	// Doc is a short description of the value.
+	Doc string
+}
+
+// MetaProvider is implemented by rocks that describe their fields. The fields of a rock are
+// resolved by Index, so tools can not list them otherwise.
+type MetaProvider interface {
+	Meta() map[string]Meta
+}
+
+// SetMeta attaches meta to the global name, or to the field of a library or a rock given as
+// "lib.name". It overrides the metadata of the standard libraries.
+func (ls *LState) SetMeta(name string, meta Meta) {
+	if ls.G.meta == nil {
+		ls.G.meta = make(map[string]Meta)
+	}
+	ls.G.meta[name] = meta
+}
+
+// GetMeta returns the metadata attached to name by SetMeta, by the MetaProvider of a global
+// rock or by the standard libraries.
+func (ls *LState) GetMeta(name string) (Meta, bool) {
+	if meta, ok := ls.G.meta[name]; ok {
+		return meta, true
+	}
+	for i := 0; i < len(name); i++ {
+		if name[i] != '.' {
+			continue
+		}
+		if ud, ok := ls.G.Global.RawGetString(name[:i]).(*LightUserData); ok {
+			if mp, ok := ud.Value.(MetaProvider); ok {
+				meta, found := mp.Meta()[name[i+1:]]
+				return meta, found
+			}
+		}
+		break
+	}
+	meta, ok := libraryMeta[name]
+	return meta, ok
+}
+
+// libraryMeta describes the functions of the standard libraries.
+var libraryMeta = map[string]Meta{
+	// base
+	"assert":         {"(v [, message])", "Raises an error if v is false or nil, and returns all its arguments otherwise."},
+	"collectgarbage": {"([opt [, arg]])", "Controls the garbage collector."},
+	"dofile":         {"([filename])", "Runs the file and returns its results."},
+	"error":          {"(message [, level])", "Raises an error with message, prefixed by the position of the given level."},
+	"getfenv":        {"([f])", "Returns the environment of a function."},
+	"getmetatable":   {"(object)", "Returns the metatable of object, or its __metatable field."},
+	"ipairs":         {"(t)", "Iterates over the pairs (1, t[1]), (2, t[2]), ... up to the first nil value."},
+	"load":           {"(func [, chunkname])", "Loads a chunk from the pieces returned by func."},
+	"loadfile":       {"([filename])", "Loads a file as a chunk without running it."},
+	"loadstring":     {"(string [, chunkname])", "Loads a chunk from a string without running it."},
+	"next":           {"(table [, index])", "Returns the next key of table and its value."},
+	"pairs":          {"(t)", "Iterates over all the key-value pairs of t."},
+	"pcall":          {"(f, ...)", "Calls f in protected mode and returns a status and the results or the error."},
+	"print":          {"(...)", "Writes its arguments to stdout."},
+	"rawequal":       {"(v1, v2)", "Compares v1 and v2 without invoking metamethods."},
+	"rawget":         {"(table, index)", "Gets table[index] without invoking metamethods."},
+	"rawset":         {"(table, index, value)", "Sets table[index] without invoking metamethods."},
+	"require":        {"(modname)", "Loads the module modname and returns its value."},
+	"select":         {"(index, ...)", "Returns the arguments after index, or their count if index is \"#\"."},
+	"setfenv":        {"(f, table)", "Sets the environment of a function."},
+	"setmetatable":   {"(table, metatable)", "Sets the metatable of table and returns table."},
+	"tonumber":       {"(e [, base])", "Converts e to a number, or returns nil."},
+	"tostring":       {"(e)", "Converts e to a string."},
+	"type":           {"(v)", "Returns the type of v as a string."},
+	"unpack":         {"(list [, i [, j]])", "Returns the elements list[i], ..., list[j]."},
+	"xpcall":         {"(f, err)", "Calls f in protected mode with err as the message handler."},
+
+	// string
+	"string.byte":    {"(s [, i [, j]])", "Returns the codes of the characters s[i], ..., s[j]."},
+	"string.char":    {"(...)", "Returns the string made of the given character codes."},
+	"string.find":    {"(s, pattern [, init [, plain]])", "Finds the first match of pattern in s and returns its indices and captures."},
+	"string.format":  {"(formatstring, ...)", "Formats its arguments as printf does."},
+	"string.gmatch":  {"(s, pattern)", "Iterates over the matches of pattern in s."},
+	"string.gsub":    {"(s, pattern, repl [, n])", "Replaces the matches of pattern in s and returns the result and the number of matches."},
+	"string.len":     {"(s)", "Returns the length of s."},
+	"string.lower":   {"(s)", "Returns s in lower case."},
+	"string.match":   {"(s, pattern [, init])", "Returns the captures of the first match of pattern in s."},
+	"string.rep":     {"(s, n)", "Returns n copies of s."},
+	"string.reverse": {"(s)", "Returns s reversed."},
+	"string.sub":     {"(s, i [, j])", "Returns the substring of s from i to j."},
+	"string.upper":   {"(s)", "Returns s in upper case."},
+
+	// table
+	"table.concat": {"(table [, sep [, i [, j]]])", "Concatenates the elements table[i], ..., table[j] separated by sep."},
+	"table.getn":   {"(table)", "Returns the length of table."},
+	"table.insert": {"(table, [pos,] value)", "Inserts value at position pos, or at the end of table."},
+	"table.maxn":   {"(table)", "Returns the largest positive numerical index of table."},
+	"table.remove": {"(table [, pos])", "Removes and returns the element at position pos, or the last one."},
+	"table.sort":   {"(table [, comp])", "Sorts the elements of table in place."},
+
+	// math
+	"math.abs":        {"(x)", "Returns the absolute value of x."},
+	"math.ceil":       {"(x)", "Returns the smallest integer larger than or equal to x."},
+	"math.floor":      {"(x)", "Returns the largest integer smaller than or equal to x."},
+	"math.fmod":       {"(x, y)", "Returns the remainder of the division of x by y."},
+	"math.max":        {"(x, ...)", "Returns the maximum of its arguments."},
+	"math.min":        {"(x, ...)", "Returns the minimum of its arguments."},
+	"math.pow":        {"(x, y)", "Returns x raised to the power y."},
+	"math.random":     {"([m [, n]])", "Returns a pseudo-random number."},
+	"math.randomseed": {"(x)", "Sets the seed of the pseudo-random generator."},
+	"math.sqrt":       {"(x)", "Returns the square root of x."},
+
+	// os
+	"os.clock":  {"()", "Returns the CPU time used by the program in seconds."},
+	"os.date":   {"([format [, time]])", "Formats a date."},
+	"os.getenv": {"(varname)", "Returns the value of an environment variable."},
+	"os.remove": {"(filename)", "Deletes a file."},
+	"os.rename": {"(oldname, newname)", "Renames a file."},
+	"os.time":   {"([table])", "Returns the current time, or the time given by table."},
+
+	// io
+	"io.open":  {"(filename [, mode])", "Opens a file and returns a file handle."},
+	"io.lines": {"([filename])", "Iterates over the lines of a file."},
+	"io.write": {"(...)", "Writes its arguments to the default output file."},
+
+	// coroutine
+	"coroutine.create": {"(f)", "Creates a coroutine running f."},
+	"coroutine.resume": {"(co, ...)", "Starts or continues the coroutine co."},
+	"coroutine.status": {"(co)", "Returns the status of the coroutine co."},
+	"coroutine.wrap":   {"(f)", "Creates a coroutine running f and returns a function resuming it."},
+	"coroutine.yield":  {"(...)", "Suspends the running coroutine."},
+}
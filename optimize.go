@@ -0,0 +1,1031 @@
+package lua
+
+import (
+	"math"
+	"math/bits"
+	"strings"
+	"sync"
+)
+
+/* optimizer {{{ */
+
+// Optimize rewrites the code of proto and of its nested functions. It propagates the
+// constants held by locals that are assigned once, including the ones captured as
+// upvalues, folds the operations and the branches on constants, including string
+// concatenations, removes the code that can not be reached, threads the jumps to jumps
+// and removes the moves and the loads of values that are never used.
+//
+// The loads of named locals are kept, so the debug library still sees their values.
+func Optimize(proto *FunctionProto) {
+	buf := optimizeBuffers.Get().(*optimizeBuffer)
+	optimizeProto(proto, nil, buf)
+	optimizeBuffers.Put(buf)
+}
+
+// optimizeRounds bounds the number of times the passes are run over a function; each round
+// may expose more constants and dead code to the next one.
+const optimizeRounds = 8
+
+// regset is a set of registers.
+type regset [4]uint64
+
+func (rs *regset) add(r int)      { rs[r>>6] |= 1 << uint(r&63) }
+func (rs *regset) has(r int) bool { return rs[r>>6]&(1<<uint(r&63)) != 0 }
+
+func (rs *regset) addRange(from, to int) {
+	if to > opMaxArgsA {
+		to = opMaxArgsA
+	}
+	for r := from; r <= to; {
+		last := r | 63
+		if last > to {
+			last = to
+		}
+		n := uint(last - r + 1)
+		mask := ^uint64(0)
+		if n < 64 {
+			mask = (1<<n - 1) << uint(r&63)
+		}
+		rs[r>>6] |= mask
+		r = last + 1
+	}
+}
+
+func (rs *regset) intersect(other *regset) {
+	for i := range rs {
+		rs[i] &= other[i]
+	}
+}
+
+// each calls fn with the registers of the set in increasing order.
+func (rs *regset) each(fn func(r int)) {
+	for i, w := range rs {
+		for w != 0 {
+			fn(i<<6 + bits.TrailingZeros64(w))
+			w &= w - 1
+		}
+	}
+}
+
+func (rs *regset) union(other *regset) {
+	for i := range rs {
+		rs[i] |= other[i]
+	}
+}
+
+func (rs *regset) subtract(other *regset) {
+	for i := range rs {
+		rs[i] &^= other[i]
+	}
+}
+
+// constKey identifies a constant; numbers are compared by their bits, so 0 and -0 differ.
+type constKey struct {
+	typ  LValueType
+	bits uint64
+	str  string
+}
+
+func keyOf(v LValue) constKey {
+	switch cv := v.(type) {
+	case LNumber:
+		return constKey{LTNumber, math.Float64bits(float64(cv)), ""}
+	case LString:
+		return constKey{LTString, 0, string(cv)}
+	case LBool:
+		if cv {
+			return constKey{LTBool, 1, ""}
+		}
+		return constKey{LTBool, 0, ""}
+	}
+	return constKey{v.Type(), 0, ""}
+}
+
+type optimizer struct {
+	proto *FunctionProto
+	code  []uint32
+	// pseudo marks the words that are not executed: the upvalue descriptions following a
+	// CLOSURE and the block number following a SETLIST.
+	pseudo []bool
+	// upvals holds the upvalues known to be constant, and consts the registers holding a
+	// single constant during the whole function.
+	upvals map[int]LValue
+	consts map[int]LValue
+	// captured holds the registers captured by closures, and untracked the ones among them
+	// a closure may assign.
+	captured  regset
+	untracked regset
+	// locals holds the register of each entry of proto.DbgLocals.
+	locals  []int
+	changed bool
+	buf     *optimizeBuffer
+}
+
+// optimizeBuffer holds the memory reused by the liveness analysis of eliminate.
+type optimizeBuffer struct {
+	gen, kill, live []regset
+	edges, first    []int
+}
+
+var optimizeBuffers = sync.Pool{New: func() interface{} { return &optimizeBuffer{} }}
+
+// regsets returns buf resized to n empty sets.
+func regsets(buf *[]regset, n int) []regset {
+	if cap(*buf) < n {
+		*buf = make([]regset, n)
+	}
+	rs := (*buf)[:n]
+	for i := range rs {
+		rs[i] = regset{}
+	}
+	return rs
+}
+
+func optimizeProto(proto *FunctionProto, upvals map[int]LValue, buf *optimizeBuffer) {
+	o := &optimizer{proto: proto, code: proto.Code, upvals: upvals, buf: buf}
+	if !o.worthwhile() {
+		// the nested functions may still use the constants of the upvalues
+		o.analyze()
+	} else {
+		for pc, inst := range o.code {
+			if opGetOpCode(inst) == OP_MOVEN {
+				o.code[pc] = opCreateABC(OP_MOVE, opGetArgA(inst), opGetArgB(inst), 0)
+			}
+		}
+		for round := 0; round < optimizeRounds; round++ {
+			o.changed = false
+			o.analyze()
+			o.propagate()
+			o.thread()
+			o.analyze()
+			o.eliminate()
+			o.compact()
+			if !o.changed {
+				break
+			}
+		}
+		o.analyze()
+		o.bulkMoves()
+		proto.Code = o.code
+	}
+
+	for pc, inst := range o.code {
+		if o.pseudo[pc] || opGetOpCode(inst) != OP_CLOSURE {
+			continue
+		}
+		child := proto.FunctionPrototypes[opGetArgBx(inst)]
+		known := map[int]LValue{}
+		for i := 0; i < int(child.NumUpvalues); i++ {
+			desc := o.code[pc+1+i]
+			if opGetOpCode(desc) == OP_MOVE {
+				if v, ok := o.consts[opGetArgB(desc)]; ok {
+					known[i] = v
+				}
+			} else if v, ok := o.upvals[opGetArgB(desc)]; ok {
+				known[i] = v
+			}
+		}
+		optimizeProto(child, known, buf)
+	}
+} // }}}
+
+/* analysis {{{ */
+
+// worthwhile reports whether the code loads constants, reads upvalues holding constants or
+// jumps; the code of the other functions is left as it is.
+func (o *optimizer) worthwhile() bool {
+	for _, inst := range o.code {
+		switch opGetOpCode(inst) {
+		case OP_LOADK, OP_LOADBOOL, OP_LOADNIL, OP_JMP:
+			return true
+		case OP_GETUPVAL:
+			if _, ok := o.upvals[opGetArgB(inst)]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// analyze computes the pseudo words, the registers of the locals, the captured registers
+// and the constant registers of the current code.
+func (o *optimizer) analyze() {
+	code := o.code
+	o.pseudo = make([]bool, len(code))
+	o.captured = regset{}
+	o.untracked = regset{}
+	for pc := 0; pc < len(code); pc++ {
+		inst := code[pc]
+		switch opGetOpCode(inst) {
+		case OP_CLOSURE:
+			child := o.proto.FunctionPrototypes[opGetArgBx(inst)]
+			written := upvaluesWritten(child)
+			for i := 0; i < int(child.NumUpvalues); i++ {
+				desc := code[pc+1+i]
+				o.pseudo[pc+1+i] = true
+				if opGetOpCode(desc) == OP_MOVE {
+					o.captured.add(opGetArgB(desc))
+					if written[i] {
+						o.untracked.add(opGetArgB(desc))
+					}
+				}
+			}
+			pc += int(child.NumUpvalues)
+		case OP_SETLIST:
+			if opGetArgC(inst) == 0 {
+				pc++
+				o.pseudo[pc] = true
+			}
+		}
+	}
+
+	o.locals = make([]int, len(o.proto.DbgLocals))
+	entry := 0
+	for i, local := range o.proto.DbgLocals {
+		for j := 0; j < i; j++ {
+			if o.proto.DbgLocals[j].EndPc >= local.StartPc {
+				o.locals[i]++
+			}
+		}
+		if local.StartPc == 0 {
+			entry++
+		}
+	}
+
+	// a register is constant if it is written once, by a load of a constant.
+	var loaded regset
+	values := map[int]LValue{}
+	for pc, inst := range code {
+		if o.pseudo[pc] {
+			continue
+		}
+		if v, ok := o.loaded(inst); ok {
+			for r := opGetArgA(inst); r <= loadedTo(inst); r++ {
+				values[r] = v
+				loaded.add(r)
+			}
+		}
+	}
+	var writes [opMaxArgsA + 1]int
+	for pc := range code {
+		if o.pseudo[pc] || len(values) == 0 {
+			continue
+		}
+		may, _ := o.writes(pc)
+		may.intersect(&loaded)
+		may.each(func(r int) { writes[r]++ })
+	}
+	o.consts = map[int]LValue{}
+	for r, v := range values {
+		if writes[r] == 1 && r >= entry && !o.untracked.has(r) {
+			o.consts[r] = v
+		}
+	}
+}
+
+// upvaluesWritten reports which upvalues of proto may be assigned by proto or by the
+// closures it creates.
+func upvaluesWritten(proto *FunctionProto) []bool {
+	written := make([]bool, proto.NumUpvalues)
+	for pc := 0; pc < len(proto.Code); pc++ {
+		inst := proto.Code[pc]
+		switch opGetOpCode(inst) {
+		case OP_SETUPVAL:
+			written[opGetArgB(inst)] = true
+		case OP_CLOSURE:
+			child := proto.FunctionPrototypes[opGetArgBx(inst)]
+			childWritten := upvaluesWritten(child)
+			for i := 0; i < int(child.NumUpvalues); i++ {
+				if desc := proto.Code[pc+1+i]; opGetOpCode(desc) == OP_GETUPVAL && childWritten[i] {
+					written[opGetArgB(desc)] = true
+				}
+			}
+			pc += int(child.NumUpvalues)
+		case OP_SETLIST:
+			if opGetArgC(inst) == 0 {
+				pc++
+			}
+		}
+	}
+	return written
+}
+
+// loaded returns the constant loaded by inst, if it is a load of a constant.
+func (o *optimizer) loaded(inst uint32) (LValue, bool) {
+	switch opGetOpCode(inst) {
+	case OP_LOADK:
+		return o.proto.Constants[opGetArgBx(inst)], true
+	case OP_LOADBOOL:
+		if opGetArgC(inst) == 0 {
+			return LBool(opGetArgB(inst) != 0), true
+		}
+	case OP_LOADNIL:
+		return LNil, true
+	}
+	return nil, false
+}
+
+// loadedTo returns the last register written by a load.
+func loadedTo(inst uint32) int {
+	if opGetOpCode(inst) == OP_LOADNIL {
+		return opGetArgB(inst)
+	}
+	return opGetArgA(inst)
+}
+
+// reads returns the registers read by the instruction at pc.
+func (o *optimizer) reads(pc int) regset {
+	var rs regset
+	inst := o.code[pc]
+	a, b, c := opGetArgA(inst), opGetArgB(inst), opGetArgC(inst)
+	rk := func(x int) {
+		if !opIsK(x) {
+			rs.add(x)
+		}
+	}
+	// ranges up to the top of the stack.
+	top := func(from, n int) {
+		if n == 0 {
+			rs.addRange(from, opMaxArgsA)
+		} else {
+			rs.addRange(from, from+n-1)
+		}
+	}
+	switch opGetOpCode(inst) {
+	case OP_MOVE, OP_UNM, OP_NOT, OP_LEN:
+		rs.add(b)
+	case OP_GETTABLE, OP_GETTABLEKS, OP_SELF:
+		rs.add(b)
+		rk(c)
+	case OP_SETGLOBAL, OP_SETUPVAL, OP_TEST:
+		rs.add(a)
+	case OP_SETTABLE, OP_SETTABLEKS:
+		rs.add(a)
+		rk(b)
+		rk(c)
+	case OP_ADD, OP_SUB, OP_MUL, OP_DIV, OP_MOD, OP_POW, OP_EQ, OP_LT, OP_LE:
+		rk(b)
+		rk(c)
+	case OP_CONCAT:
+		rs.addRange(b, c)
+	case OP_TESTSET:
+		rs.add(b)
+	case OP_CALL, OP_TAILCALL:
+		if b == 0 {
+			top(a, 0)
+		} else {
+			top(a, b)
+		}
+	case OP_RETURN:
+		if b == 0 {
+			top(a, 0)
+		} else if b > 1 {
+			top(a, b-1)
+		}
+	case OP_SETLIST:
+		if b == 0 {
+			top(a, 0)
+		} else {
+			top(a, b+1)
+		}
+	case OP_FORLOOP, OP_FORPREP, OP_TFORLOOP:
+		rs.addRange(a, a+2)
+	case OP_CLOSURE:
+		child := o.proto.FunctionPrototypes[opGetArgBx(inst)]
+		for i := 0; i < int(child.NumUpvalues); i++ {
+			if desc := o.code[pc+1+i]; opGetOpCode(desc) == OP_MOVE {
+				rs.add(opGetArgB(desc))
+			}
+		}
+	}
+	return rs
+}
+
+// writes returns the registers the instruction at pc may write, and the ones it surely
+// overwrites. A call overwrites all the registers from its function up.
+func (o *optimizer) writes(pc int) (may, must regset) {
+	inst := o.code[pc]
+	a, b := opGetArgA(inst), opGetArgB(inst)
+	switch opGetOpCode(inst) {
+	case OP_MOVE, OP_LOADK, OP_LOADBOOL, OP_GETUPVAL, OP_GETGLOBAL, OP_GETTABLE, OP_GETTABLEKS,
+		OP_NEWTABLE, OP_ADD, OP_SUB, OP_MUL, OP_DIV, OP_MOD, OP_POW, OP_UNM, OP_NOT, OP_LEN,
+		OP_CONCAT, OP_CLOSURE, OP_FORPREP:
+		must.add(a)
+	case OP_LOADNIL:
+		must.addRange(a, b)
+	case OP_SELF:
+		must.addRange(a, a+1)
+	case OP_TESTSET:
+		may.add(a)
+	case OP_CALL, OP_TAILCALL:
+		must.addRange(a, opMaxArgsA)
+	case OP_VARARG:
+		if b == 0 {
+			must.addRange(a, opMaxArgsA)
+		} else {
+			must.addRange(a, a+b-2)
+		}
+	case OP_FORLOOP:
+		must.add(a)
+		may.add(a + 3)
+	case OP_TFORLOOP:
+		must.addRange(a+3, opMaxArgsA)
+		may.add(a + 2)
+	}
+	may.union(&must)
+	return may, must
+}
+
+// target returns the destination of the jump at pc.
+func (o *optimizer) target(pc int) int {
+	return pc + 1 + opGetArgSbx(o.code[pc])
+}
+
+// skips reports whether the instruction at pc may skip the next one.
+func (o *optimizer) skips(pc int) bool {
+	inst := o.code[pc]
+	op := opGetOpCode(inst)
+	return opProps[op].IsTest || op == OP_LOADBOOL && opGetArgC(inst) != 0
+}
+
+// successors appends to dst the instructions that may run after the one at pc.
+func (o *optimizer) successors(dst []int, pc int) []int {
+	inst := o.code[pc]
+	next := pc + 1
+	switch opGetOpCode(inst) {
+	case OP_JMP, OP_FORPREP:
+		return append(dst, o.target(pc))
+	case OP_FORLOOP:
+		return append(dst, next, o.target(pc))
+	case OP_RETURN:
+		return dst
+	case OP_CLOSURE:
+		next += int(o.proto.FunctionPrototypes[opGetArgBx(inst)].NumUpvalues)
+	case OP_SETLIST:
+		if opGetArgC(inst) == 0 {
+			next++
+		}
+	}
+	if o.skips(pc) {
+		if opGetOpCode(inst) == OP_LOADBOOL {
+			return append(dst, next+1)
+		}
+		return append(dst, next, next+1)
+	}
+	return append(dst, next)
+}
+
+// scoped adds to scoped[pc] the registers of the named locals in scope at pc.
+func (o *optimizer) scoped(scoped []regset) {
+	for i, local := range o.proto.DbgLocals {
+		for pc := local.StartPc; pc <= local.EndPc && pc < len(scoped); pc++ {
+			scoped[pc].add(o.locals[i])
+		}
+	}
+} // }}}
+
+/* passes {{{ */
+
+// constant returns the index of v in the constants, adding it if needed, or -1 if the
+// index would be larger than max.
+func (o *optimizer) constant(v LValue, max int) int {
+	key := keyOf(v)
+	for i, c := range o.proto.Constants {
+		if keyOf(c) == key {
+			if i > max {
+				return -1
+			}
+			return i
+		}
+	}
+	if len(o.proto.Constants) > max {
+		return -1
+	}
+	o.proto.Constants = append(o.proto.Constants, v)
+	sv := ""
+	if s, ok := v.(LString); ok {
+		sv = string(s)
+	}
+	o.proto.stringConstants = append(o.proto.stringConstants, sv)
+	return len(o.proto.Constants) - 1
+}
+
+func (o *optimizer) set(pc int, inst uint32) {
+	if o.code[pc] != inst {
+		o.code[pc] = inst
+		o.changed = true
+	}
+}
+
+func (o *optimizer) nop(pc int) {
+	o.set(pc, opCreateASbx(OP_NOP, 0, 0))
+}
+
+// load replaces the instruction at pc with a load of v into a.
+func (o *optimizer) load(pc, a int, v LValue) bool {
+	switch cv := v.(type) {
+	case *LNilType:
+		o.set(pc, opCreateABC(OP_LOADNIL, a, a, 0))
+	case LBool:
+		b := 0
+		if cv {
+			b = 1
+		}
+		o.set(pc, opCreateABC(OP_LOADBOOL, a, b, 0))
+	default:
+		k := o.constant(v, opMaxArgBx)
+		if k < 0 {
+			return false
+		}
+		o.set(pc, opCreateABx(OP_LOADK, a, k))
+	}
+	return true
+}
+
+// branch replaces the test at pc: if taken is true, the jump that follows it always runs,
+// otherwise it is always skipped.
+func (o *optimizer) branch(pc int, taken bool) {
+	if taken {
+		o.nop(pc)
+	} else {
+		o.set(pc, opCreateASbx(OP_JMP, 0, 1))
+	}
+}
+
+// propagate numbers the values of the registers in each block, replaces the reads of
+// constants by the constants, folds the operations on constants and removes the moves and
+// the loads of a value a register already holds.
+func (o *optimizer) propagate() {
+	code := o.code
+	leaders := make([]bool, len(code)+2)
+	leaders[0] = true
+	for pc, inst := range code {
+		if o.pseudo[pc] {
+			continue
+		}
+		switch opGetOpCode(inst) {
+		case OP_JMP, OP_FORPREP, OP_FORLOOP:
+			if t := o.target(pc); t >= 0 && t < len(leaders) {
+				leaders[t] = true
+			}
+			leaders[pc+1] = true
+		case OP_RETURN, OP_TAILCALL:
+			leaders[pc+1] = true
+		}
+		if o.skips(pc) {
+			leaders[pc+2] = true
+		}
+	}
+
+	numbers := map[constKey]int{}
+	values := map[int]LValue{}
+	next := 0
+	fresh := func() int {
+		next++
+		return next
+	}
+	number := func(v LValue) int {
+		key := keyOf(v)
+		if n, ok := numbers[key]; ok {
+			return n
+		}
+		n := fresh()
+		numbers[key] = n
+		values[n] = v
+		return n
+	}
+	// vn holds the value numbers of the registers in known, the others hold unknown values.
+	var vn [opMaxArgsA + 1]int
+	var known regset
+	num := func(r int) int {
+		if known.has(r) {
+			return vn[r]
+		}
+		return 0
+	}
+	setNum := func(r, n int) {
+		vn[r] = n
+		known.add(r)
+	}
+	constOf := func(r int) (LValue, bool) {
+		if v, ok := values[num(r)]; ok {
+			return v, true
+		}
+		v, ok := o.consts[r]
+		return v, ok
+	}
+	rkConst := func(x int) (LValue, bool) {
+		if opIsK(x) {
+			return o.proto.Constants[opIndexK(x)], true
+		}
+		return constOf(x)
+	}
+	// rk returns the operand x, or the constant it holds if it fits an operand.
+	rk := func(x int) int {
+		if opIsK(x) {
+			return x
+		}
+		v, ok := constOf(x)
+		if !ok {
+			return x
+		}
+		switch v.(type) {
+		case LNumber, LString:
+			if k := o.constant(v, opMaxIndexRk); k >= 0 {
+				return opRkAsk(k)
+			}
+		}
+		return x
+	}
+
+	for pc := 0; pc < len(code); pc++ {
+		if o.pseudo[pc] {
+			continue
+		}
+		if leaders[pc] {
+			known = regset{}
+		}
+		inst := code[pc]
+		op := opGetOpCode(inst)
+		a, b, c := opGetArgA(inst), opGetArgB(inst), opGetArgC(inst)
+		switch op {
+		case OP_MOVE:
+			if a == b || num(a) != 0 && num(a) == num(b) {
+				o.nop(pc)
+				continue
+			}
+			if v, ok := constOf(b); ok {
+				o.load(pc, a, v)
+			}
+		case OP_LOADK, OP_LOADBOOL, OP_LOADNIL:
+			if v, ok := o.loaded(inst); ok {
+				redundant := true
+				for r := a; r <= loadedTo(inst); r++ {
+					redundant = redundant && num(r) != 0 && num(r) == number(v)
+				}
+				if redundant {
+					o.nop(pc)
+					continue
+				}
+			}
+		case OP_GETUPVAL:
+			if v, ok := o.upvals[b]; ok {
+				o.load(pc, a, v)
+			}
+		case OP_GETTABLE, OP_GETTABLEKS, OP_SELF:
+			c = rk(c)
+			if op == OP_GETTABLE && opIsK(c) && o.proto.Constants[opIndexK(c)].Type() == LTString {
+				op = OP_GETTABLEKS
+			}
+			o.set(pc, opCreateABC(op, a, b, c))
+		case OP_SETTABLE, OP_SETTABLEKS:
+			b, c = rk(b), rk(c)
+			if op == OP_SETTABLE && opIsK(b) && o.proto.Constants[opIndexK(b)].Type() == LTString {
+				op = OP_SETTABLEKS
+			}
+			o.set(pc, opCreateABC(op, a, b, c))
+		case OP_ADD, OP_SUB, OP_MUL, OP_DIV, OP_MOD, OP_POW:
+			lhs, lok := rkConst(b)
+			rhs, rok := rkConst(c)
+			x, xok := lhs.(LNumber)
+			y, yok := rhs.(LNumber)
+			if lok && rok && xok && yok {
+				o.load(pc, a, arith(op, x, y))
+			} else {
+				o.set(pc, opCreateABC(op, a, rk(b), rk(c)))
+			}
+		case OP_UNM:
+			if v, ok := constOf(b); ok {
+				if x, ok := v.(LNumber); ok {
+					o.load(pc, a, -x)
+				}
+			}
+		case OP_NOT:
+			if v, ok := constOf(b); ok {
+				o.load(pc, a, LBool(!LVAsBool(v)))
+			}
+		case OP_CONCAT:
+			buf := make([]string, 0, c-b+1)
+			for r := b; r <= c; r++ {
+				v, ok := constOf(r)
+				if !ok || !LVCanConvToString(v) {
+					break
+				}
+				buf = append(buf, LVAsString(v))
+			}
+			if len(buf) == c-b+1 {
+				o.load(pc, a, LString(strings.Join(buf, "")))
+			}
+		case OP_TEST:
+			if v, ok := constOf(a); ok {
+				o.branch(pc, LVAsBool(v) == (c != 0))
+			}
+		case OP_TESTSET:
+			if v, ok := constOf(b); ok {
+				if LVAsBool(v) == (c != 0) {
+					o.set(pc, opCreateABC(OP_MOVE, a, b, 0))
+				} else {
+					o.branch(pc, false)
+				}
+			}
+		case OP_EQ, OP_LT, OP_LE:
+			lhs, lok := rkConst(b)
+			rhs, rok := rkConst(c)
+			if lok && rok {
+				if result, ok := compare(op, lhs, rhs); ok {
+					o.branch(pc, result == (a != 0))
+					continue
+				}
+			}
+			o.set(pc, opCreateABC(op, a, rk(b), rk(c)))
+		}
+
+		// the values of the registers after the instruction.
+		inst = code[pc]
+		a, b = opGetArgA(inst), opGetArgB(inst)
+		if v, ok := o.loaded(inst); ok {
+			for r := a; r <= loadedTo(inst); r++ {
+				setNum(r, number(v))
+			}
+		} else if opGetOpCode(inst) == OP_MOVE {
+			if num(b) == 0 {
+				setNum(b, fresh())
+			}
+			setNum(a, num(b))
+		} else {
+			may, _ := o.writes(pc)
+			known.subtract(&may)
+		}
+		known.subtract(&o.untracked)
+	}
+}
+
+func arith(op int, x, y LNumber) LNumber {
+	switch op {
+	case OP_ADD:
+		return x + y
+	case OP_SUB:
+		return x - y
+	case OP_MUL:
+		return x * y
+	case OP_DIV:
+		return x / y
+	case OP_MOD:
+		return luaModulo(x, y)
+	}
+	return LNumber(math.Pow(float64(x), float64(y)))
+}
+
+// compare returns the result of a comparison of constants that can not call metamethods.
+func compare(op int, lhs, rhs LValue) (bool, bool) {
+	if op == OP_EQ {
+		if lhs.Type() != rhs.Type() {
+			return false, true
+		}
+		switch lv := lhs.(type) {
+		case LNumber:
+			return lv == rhs.(LNumber), true
+		case LString:
+			return lv == rhs.(LString), true
+		case LBool:
+			return lv == rhs.(LBool), true
+		case *LNilType:
+			return true, true
+		}
+		return false, false
+	}
+	x, xok := lhs.(LNumber)
+	y, yok := rhs.(LNumber)
+	if !xok || !yok {
+		return false, false
+	}
+	if op == OP_LT {
+		return x < y, true
+	}
+	return x <= y, true
+}
+
+// thread makes the jumps to jumps go to their final destination, and removes the jumps to
+// the next instruction.
+func (o *optimizer) thread() {
+	code := o.code
+	for pc, inst := range code {
+		if o.pseudo[pc] || opGetOpCode(inst) != OP_JMP {
+			continue
+		}
+		t := o.target(pc)
+		for steps := 0; t < len(code) && steps < len(code); steps++ {
+			if op := opGetOpCode(code[t]); op == OP_NOP {
+				t++
+			} else if op == OP_JMP && o.target(t) != t {
+				t = o.target(t)
+			} else {
+				break
+			}
+		}
+		if t == pc+1 {
+			o.nop(pc)
+		} else {
+			o.set(pc, opCreateASbx(OP_JMP, 0, t-pc-1))
+		}
+	}
+}
+
+// eliminate removes the moves and the loads of temporaries that are never read.
+func (o *optimizer) eliminate() {
+	code := o.code
+	// the named locals are live in their scope, so the debug library sees their values.
+	buf := o.buf
+	gen := regsets(&buf.gen, len(code)+2)
+	o.scoped(gen)
+	kill := regsets(&buf.kill, len(code))
+	// the successors of pc are edges[first[pc]:first[pc+1]]
+	edges := buf.edges[:0]
+	if cap(buf.first) < len(code)+1 {
+		buf.first = make([]int, len(code)+1)
+	}
+	first := buf.first[:len(code)+1]
+	for pc := range code {
+		first[pc] = len(edges)
+		if o.pseudo[pc] {
+			continue
+		}
+		reads := o.reads(pc)
+		gen[pc].union(&reads)
+		_, kill[pc] = o.writes(pc)
+		edges = o.successors(edges, pc)
+	}
+	first[len(code)] = len(edges)
+	buf.edges = edges
+	live := regsets(&buf.live, len(code)+2)
+	for changed := true; changed; {
+		changed = false
+		for pc := len(code) - 1; pc >= 0; pc-- {
+			if o.pseudo[pc] {
+				continue
+			}
+			var out regset
+			for _, s := range edges[first[pc]:first[pc+1]] {
+				if s >= 0 && s < len(live) {
+					out.union(&live[s])
+				}
+			}
+			in := gen[pc]
+			out.subtract(&kill[pc])
+			in.union(&out)
+			if in != live[pc] {
+				live[pc] = in
+				changed = true
+			}
+		}
+	}
+
+	for pc, inst := range code {
+		if o.pseudo[pc] {
+			continue
+		}
+		switch opGetOpCode(inst) {
+		case OP_MOVE, OP_LOADK, OP_LOADBOOL, OP_LOADNIL, OP_GETUPVAL:
+		default:
+			continue
+		}
+		if opGetOpCode(inst) == OP_LOADBOOL && opGetArgC(inst) != 0 {
+			continue
+		}
+		var out regset
+		for _, s := range edges[first[pc]:first[pc+1]] {
+			if s >= 0 && s < len(live) {
+				out.union(&live[s])
+			}
+		}
+		dead := true
+		for r := opGetArgA(inst); r <= loadedTo(inst); r++ {
+			dead = dead && !out.has(r) && !o.captured.has(r)
+		}
+		if dead {
+			o.nop(pc)
+		}
+	}
+}
+
+// compact removes the instructions that can not be reached and the NOPs, and adjusts the
+// jumps and the debug information.
+func (o *optimizer) compact() {
+	code := o.code
+	reachable := make([]bool, len(code))
+	stack := []int{0}
+	for len(stack) > 0 {
+		pc := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if pc < 0 || pc >= len(code) || reachable[pc] {
+			continue
+		}
+		reachable[pc] = true
+		if opGetOpCode(code[pc]) == OP_CLOSURE || opGetOpCode(code[pc]) == OP_SETLIST {
+			for next := pc + 1; next < len(code) && o.pseudo[next]; next++ {
+				reachable[next] = true
+			}
+		}
+		stack = o.successors(stack, pc)
+	}
+
+	keep := make([]bool, len(code))
+	for pc := range code {
+		switch {
+		case o.pseudo[pc]:
+			keep[pc] = reachable[pc]
+		case pc > 0 && reachable[pc-1] && !o.pseudo[pc-1] && !reachable[pc] &&
+			opGetOpCode(code[pc-1]) == OP_LOADBOOL && opGetArgC(code[pc-1]) != 0:
+			// a LOADBOOL skipping a word nobody jumps to does not need to skip it.
+			o.set(pc-1, opCreateABC(OP_LOADBOOL, opGetArgA(code[pc-1]), opGetArgB(code[pc-1]), 0))
+		case pc > 0 && reachable[pc-1] && !o.pseudo[pc-1] && o.skips(pc-1):
+			// a test skips the next word, so it can not be removed.
+			keep[pc] = true
+			if !reachable[pc] {
+				o.nop(pc)
+			}
+		default:
+			keep[pc] = reachable[pc] && opGetOpCode(code[pc]) != OP_NOP
+		}
+	}
+
+	// index maps each old pc to the new pc of the first kept instruction at or after it.
+	index := make([]int, len(code)+1)
+	n := 0
+	for pc := range code {
+		index[pc] = n
+		if keep[pc] {
+			n++
+		}
+	}
+	index[len(code)] = n
+	if n == len(code) {
+		return
+	}
+	o.changed = true
+
+	newcode := make([]uint32, 0, n)
+	positions := make([]int, 0, n)
+	columns := make([]int, 0, n)
+	for pc, inst := range code {
+		if !keep[pc] {
+			continue
+		}
+		if !o.pseudo[pc] {
+			switch opGetOpCode(inst) {
+			case OP_JMP, OP_FORPREP, OP_FORLOOP:
+				t := o.target(pc)
+				if t > len(code) {
+					t = len(code)
+				}
+				opSetArgSbx(&inst, index[t]-len(newcode)-1)
+			}
+		}
+		newcode = append(newcode, inst)
+		positions = append(positions, o.proto.DbgSourcePositions[pc])
+		if pc < len(o.proto.DbgSourceColumns) {
+			columns = append(columns, o.proto.DbgSourceColumns[pc])
+		}
+	}
+	o.code = newcode
+	o.proto.DbgSourcePositions = positions
+	o.proto.DbgSourceColumns = columns
+
+	remap := func(pc int) int {
+		if pc < 0 {
+			return pc
+		}
+		if pc > len(code) {
+			pc = len(code)
+		}
+		return index[pc]
+	}
+	for _, local := range o.proto.DbgLocals {
+		local.StartPc = remap(local.StartPc)
+		local.EndPc = remap(local.EndPc)
+	}
+	calls := o.proto.DbgCalls[:0]
+	for _, call := range o.proto.DbgCalls {
+		if call.Pc >= 0 && call.Pc < len(code) && keep[call.Pc] {
+			call.Pc = index[call.Pc]
+			calls = append(calls, call)
+		}
+	}
+	o.proto.DbgCalls = calls
+}
+
+// bulkMoves turns the runs of moves into MOVEN instructions, as patchCode does.
+func (o *optimizer) bulkMoves() {
+	moven := 0
+	for pc := 0; pc <= len(o.code); pc++ {
+		if pc < len(o.code) && !o.pseudo[pc] && opGetOpCode(o.code[pc]) == OP_MOVE {
+			moven++
+			continue
+		}
+		if moven > 1 {
+			opSetOpCode(&o.code[pc-moven], OP_MOVEN)
+			opSetArgC(&o.code[pc-moven], intMin(moven-1, opMaxArgsC))
+		}
+		moven = 0
+	}
+} // }}}
@@ -0,0 +1,122 @@
+package lua
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/edunx/lua/parse"
+)
+
+func compileString(t *testing.T, src string) *FunctionProto {
+	chunk, err := parse.Parse(strings.NewReader(src), "<string>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proto, err := Compile(chunk, "<string>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proto
+}
+
+// opcodes counts the opcodes of proto and of its nested functions, and checks the jumps and
+// the moves left by the optimizer.
+func opcodes(t *testing.T, proto *FunctionProto, counts map[int]int) map[int]int {
+	pseudo := 0
+	for pc, inst := range proto.Code {
+		if pseudo > 0 {
+			pseudo--
+			continue
+		}
+		op := opGetOpCode(inst)
+		counts[op]++
+		switch op {
+		case OP_CLOSURE:
+			pseudo = int(proto.FunctionPrototypes[opGetArgBx(inst)].NumUpvalues)
+		case OP_MOVEN:
+			pseudo = opGetArgC(inst)
+		case OP_SETLIST:
+			if opGetArgC(inst) == 0 {
+				pseudo = 1
+			}
+		case OP_JMP:
+			target := pc + 1 + opGetArgSbx(inst)
+			if target == pc+1 {
+				t.Errorf("jump to the next instruction at %d", pc)
+			} else if target < len(proto.Code) && opGetOpCode(proto.Code[target]) == OP_JMP {
+				t.Errorf("jump to a jump at %d", pc)
+			}
+		case OP_MOVE:
+			if opGetArgA(inst) == opGetArgB(inst) {
+				t.Errorf("move to itself at %d", pc)
+			}
+		}
+	}
+	for _, child := range proto.FunctionPrototypes {
+		opcodes(t, child, counts)
+	}
+	return counts
+}
+
+func TestOptimize(t *testing.T) {
+	cases := []struct {
+		src      string
+		absent   []int
+		expected string
+	}{
+		{`local DEBUG = false
+		  local n = 0
+		  if DEBUG then n = 1 end
+		  result = n`, []int{OP_TEST, OP_JMP}, "0"},
+		{`local DEBUG = false
+		  local function check(x)
+		    if DEBUG then print("check", x) end
+		    return x * 2
+		  end
+		  result = check(21)`, []int{OP_TEST, OP_GETUPVAL}, "42"},
+		{`local prefix, id = "rule", 3
+		  result = prefix .. ":" .. id`, []int{OP_CONCAT}, "rule:3"},
+		{`local LEVEL = 2
+		  local s = "low"
+		  if LEVEL > 1 then s = "high" elseif LEVEL > 0 then s = "mid" end
+		  result = s`, []int{OP_LT, OP_JMP}, "high"},
+		{`local limit, n = 3, 0
+		  while true do
+		    n = n + 1
+		    if n > limit then break end
+		  end
+		  result = n`, []int{OP_NOP}, "4"},
+		{`local x = 1
+		  if flag then x = 2 end
+		  result = x`, []int{OP_NOP}, "2"},
+		{`local n = 0
+		  local function inc() n = n + 1 end
+		  inc(); inc()
+		  result = n`, []int{OP_NOP}, "2"},
+		{`local t, keys = {}, {}
+		  for i = 1, 3 do t[i] = i * i end
+		  for k, v in ipairs(t) do keys[#keys + 1] = k .. "=" .. v end
+		  result = table.concat(keys, ",")`, []int{OP_NOP}, "1=1,2=4,3=9"},
+	}
+	for i, c := range cases {
+		proto := compileString(t, c.src)
+		Optimize(proto)
+		counts := opcodes(t, proto, map[int]int{})
+		for _, op := range c.absent {
+			if counts[op] != 0 {
+				t.Errorf("%d: %s is left in\n%s", i, opProps[op].Name, proto.String())
+			}
+		}
+
+		for _, optimize := range []bool{false, true} {
+			L := NewState(Options{Optimize: optimize})
+			L.SetGlobal("flag", LTrue)
+			if err := L.DoString(c.src); err != nil {
+				t.Errorf("%d: %v", i, err)
+			} else if got := L.GetGlobal("result").String(); got != c.expected {
+				t.Errorf("%d: expected %q, but got %q (optimize=%v)", i, c.expected, got, optimize)
+			}
+			L.Close()
+		}
+	}
+}
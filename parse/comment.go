@@ -0,0 +1,136 @@
+package parse
+
+import (
+	"github.com/edunx/lua/ast"
+)
+
+// region is a block of statements spanning the lines [start, end). owner is the statement
+// that holds the block, or nil for the chunk.
+type region struct {
+	start, end int
+	stmts      []ast.Stmt
+	owner      ast.Stmt
+}
+
+func (r *region) contains(line int) bool {
+	return r.start <= line && line < r.end
+}
+
+// attachComments attaches each comment to the statement it belongs to. A comment goes into
+// the innermost block that contains it. Within a block, an inline comment or a comment on
+// the lines of a statement trails that statement, and any other comment leads the
+// statement that follows it. The comments after the last statement of a block trail that
+// statement, and the comments of an empty block trail the statement that holds the block.
+// Comments of an empty chunk are dropped.
+func attachComments(chunk []ast.Stmt, comments []*ast.Comment, empty map[int]bool) {
+	root := &region{0, int(^uint(0) >> 1), chunk, nil}
+	for _, c := range comments {
+		c.EmptyLineBefore = empty[c.Line()-1]
+		attachComment(root, c)
+	}
+	ast.Inspect(chunk, func(node interface{}) bool {
+		if stmt, ok := node.(ast.Stmt); ok {
+			stmt.Comments().EmptyLineBefore = empty[stmt.Line()-1]
+		}
+		return true
+	})
+}
+
+func attachComment(r *region, c *ast.Comment) {
+	line := c.Line()
+	for _, stmt := range r.stmts {
+		for _, sub := range stmtRegions(stmt) {
+			if sub.contains(line) {
+				attachComment(sub, c)
+				return
+			}
+		}
+	}
+
+	var prev, next ast.Stmt
+	for _, stmt := range r.stmts {
+		if stmt.Line() > line {
+			next = stmt
+			break
+		}
+		prev = stmt
+	}
+	switch {
+	case prev != nil && (c.Inline || ast.EndLine(prev) >= line):
+		prev.Comments().Trailing = append(prev.Comments().Trailing, c)
+	case next != nil:
+		next.Comments().Leading = append(next.Comments().Leading, c)
+	case prev != nil:
+		prev.Comments().Trailing = append(prev.Comments().Trailing, c)
+	case r.owner != nil:
+		r.owner.Comments().Trailing = append(r.owner.Comments().Trailing, c)
+	}
+}
+
+// stmtRegions returns the blocks held by stmt, including the bodies of the function
+// expressions of stmt.
+func stmtRegions(stmt ast.Stmt) []*region {
+	var regions []*region
+	block := func(start, end int, stmts []ast.Stmt, owner ast.Stmt) {
+		regions = append(regions, &region{start, end, stmts, owner})
+	}
+	switch s := stmt.(type) {
+	case *ast.DoBlockStmt:
+		block(s.Line(), s.LastLine(), s.Stmts, s)
+	case *ast.WhileStmt:
+		block(s.Line(), s.LastLine(), s.Stmts, s)
+		regions = append(regions, funcRegions(stmt, s.Condition)...)
+	case *ast.RepeatStmt:
+		block(s.Line(), s.LastLine(), s.Stmts, s)
+		regions = append(regions, funcRegions(stmt, s.Condition)...)
+	case *ast.NumberForStmt:
+		block(s.Line(), s.LastLine(), s.Stmts, s)
+		regions = append(regions, funcRegions(stmt, s.Init, s.Limit, s.Step)...)
+	case *ast.GenericForStmt:
+		block(s.Line(), s.LastLine(), s.Stmts, s)
+		regions = append(regions, funcRegions(stmt, s.Exprs...)...)
+	case *ast.FuncDefStmt:
+		block(s.Func.Line(), s.Func.LastLine(), s.Func.Stmts, s)
+	case *ast.IfStmt:
+		end := s.LastLine()
+		for cur := s; ; {
+			regions = append(regions, funcRegions(cur, cur.Condition)...)
+			if elseif := cur.ElseIf(); elseif != nil {
+				block(cur.Line(), elseif.Line(), cur.Then, cur)
+				cur = elseif
+				continue
+			}
+			if cur.ElseLine == 0 {
+				block(cur.Line(), end, cur.Then, cur)
+				break
+			}
+			block(cur.Line(), cur.ElseLine, cur.Then, cur)
+			block(cur.ElseLine, end, cur.Else, cur)
+			break
+		}
+	case *ast.AssignStmt:
+		regions = funcRegions(stmt, append(append([]ast.Expr{}, s.Lhs...), s.Rhs...)...)
+	case *ast.LocalAssignStmt:
+		regions = funcRegions(stmt, s.Exprs...)
+	case *ast.FuncCallStmt:
+		regions = funcRegions(stmt, s.Expr)
+	case *ast.ReturnStmt:
+		regions = funcRegions(stmt, s.Exprs...)
+	}
+	return regions
+}
+
+// funcRegions returns the bodies of the outermost function expressions in exprs.
+func funcRegions(owner ast.Stmt, exprs ...ast.Expr) []*region {
+	var regions []*region
+	for _, expr := range exprs {
+		ast.Inspect(expr, func(node interface{}) bool {
+			if fn, ok := node.(*ast.FunctionExpr); ok {
+				regions = append(regions, &region{fn.Line(), fn.LastLine(), fn.Stmts, owner})
+				return false
+			}
+			return true
+		})
+	}
+	return regions
+}
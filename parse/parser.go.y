@@ -1,524 +1,583 @@
-%{
-package parse
-
-import (
-  "github.com/edunx/lua/ast"
-)
-%}
-%type<stmts> chunk
-%type<stmts> chunk1
-%type<stmts> block
-%type<stmt>  stat
-%type<stmts> elseifs
-%type<stmt>  laststat
-%type<funcname> funcname
-%type<funcname> funcname1
-%type<exprlist> varlist
-%type<expr> var
-%type<namelist> namelist
-%type<exprlist> exprlist
-%type<expr> expr
-%type<expr> string
-%type<expr> prefixexp
-%type<expr> functioncall
-%type<expr> afunctioncall
-%type<exprlist> args
-%type<expr> function
-%type<funcexpr> funcbody
-%type<parlist> parlist
-%type<expr> tableconstructor
-%type<fieldlist> fieldlist
-%type<field> field
-%type<fieldsep> fieldsep
-
-%union {
-  token  ast.Token
-
-  stmts    []ast.Stmt
-  stmt     ast.Stmt
-
-  funcname *ast.FuncName
-  funcexpr *ast.FunctionExpr
-
-  exprlist []ast.Expr
-  expr   ast.Expr
-
-  fieldlist []*ast.Field
-  field     *ast.Field
-  fieldsep  string
-
-  namelist []string
-  parlist  *ast.ParList
-}
-
-/* Reserved words */
-%token<token> TAnd TBreak TDo TElse TElseIf TEnd TFalse TFor TFunction TIf TIn TLocal TNil TNot TOr TReturn TRepeat TThen TTrue TUntil TWhile 
-
-/* Literals */
-%token<token> TEqeq TNeq TLte TGte T2Comma T3Comma TIdent TNumber TString '{' '('
-
-/* Operators */
-%left TOr
-%left TAnd
-%left '>' '<' TGte TLte TEqeq TNeq
-%right T2Comma
-%left '+' '-'
-%left '*' '/' '%'
-%right UNARY /* not # -(unary) */
-%right '^'
-
-%%
-
-chunk: 
-        chunk1 {
-            $$ = $1
-            if l, ok := yylex.(*Lexer); ok {
-                l.Stmts = $$
-            }
-        } |
-        chunk1 laststat {
-            $$ = append($1, $2)
-            if l, ok := yylex.(*Lexer); ok {
-                l.Stmts = $$
-            }
-        } | 
-        chunk1 laststat ';' {
-            $$ = append($1, $2)
-            if l, ok := yylex.(*Lexer); ok {
-                l.Stmts = $$
-            }
-        }
-
-chunk1: 
-        {
-            $$ = []ast.Stmt{}
-        } |
-        chunk1 stat {
-            $$ = append($1, $2)
-        } | 
-        chunk1 ';' {
-            $$ = $1
-        }
-
-block: 
-        chunk {
-            $$ = $1
-        }
-
-stat:
-        varlist '=' exprlist {
-            $$ = &ast.AssignStmt{Lhs: $1, Rhs: $3}
-            $$.SetLine($1[0].Line())
-        } |
-        /* 'stat = functioncal' causes a reduce/reduce conflict */
-        prefixexp {
-            if _, ok := $1.(*ast.FuncCallExpr); !ok {
-               yylex.(*Lexer).Error("parse error")
-            } else {
-              $$ = &ast.FuncCallStmt{Expr: $1}
-              $$.SetLine($1.Line())
-            }
-        } |
-        TDo block TEnd {
-            $$ = &ast.DoBlockStmt{Stmts: $2}
-            $$.SetLine($1.Pos.Line)
-            $$.SetLastLine($3.Pos.Line)
-        } |
-        TWhile expr TDo block TEnd {
-            $$ = &ast.WhileStmt{Condition: $2, Stmts: $4}
-            $$.SetLine($1.Pos.Line)
-            $$.SetLastLine($5.Pos.Line)
-        } |
-        TRepeat block TUntil expr {
-            $$ = &ast.RepeatStmt{Condition: $4, Stmts: $2}
-            $$.SetLine($1.Pos.Line)
-            $$.SetLastLine($4.Line())
-        } |
-        TIf expr TThen block elseifs TEnd {
-            $$ = &ast.IfStmt{Condition: $2, Then: $4}
-            cur := $$
-            for _, elseif := range $5 {
-                cur.(*ast.IfStmt).Else = []ast.Stmt{elseif}
-                cur = elseif
-            }
-            $$.SetLine($1.Pos.Line)
-            $$.SetLastLine($6.Pos.Line)
-        } |
-        TIf expr TThen block elseifs TElse block TEnd {
-            $$ = &ast.IfStmt{Condition: $2, Then: $4}
-            cur := $$
-            for _, elseif := range $5 {
-                cur.(*ast.IfStmt).Else = []ast.Stmt{elseif}
-                cur = elseif
-            }
-            cur.(*ast.IfStmt).Else = $7
-            $$.SetLine($1.Pos.Line)
-            $$.SetLastLine($8.Pos.Line)
-        } |
-        TFor TIdent '=' expr ',' expr TDo block TEnd {
-            $$ = &ast.NumberForStmt{Name: $2.Str, Init: $4, Limit: $6, Stmts: $8}
-            $$.SetLine($1.Pos.Line)
-            $$.SetLastLine($9.Pos.Line)
-        } |
-        TFor TIdent '=' expr ',' expr ',' expr TDo block TEnd {
-            $$ = &ast.NumberForStmt{Name: $2.Str, Init: $4, Limit: $6, Step:$8, Stmts: $10}
-            $$.SetLine($1.Pos.Line)
-            $$.SetLastLine($11.Pos.Line)
-        } |
-        TFor namelist TIn exprlist TDo block TEnd {
-            $$ = &ast.GenericForStmt{Names:$2, Exprs:$4, Stmts: $6}
-            $$.SetLine($1.Pos.Line)
-            $$.SetLastLine($7.Pos.Line)
-        } |
-        TFunction funcname funcbody {
-            $$ = &ast.FuncDefStmt{Name: $2, Func: $3}
-            $$.SetLine($1.Pos.Line)
-            $$.SetLastLine($3.LastLine())
-        } |
-        TLocal TFunction TIdent funcbody {
-            $$ = &ast.LocalAssignStmt{Names:[]string{$3.Str}, Exprs: []ast.Expr{$4}}
-            $$.SetLine($1.Pos.Line)
-            $$.SetLastLine($4.LastLine())
-        } | 
-        TLocal namelist '=' exprlist {
-            $$ = &ast.LocalAssignStmt{Names: $2, Exprs:$4}
-            $$.SetLine($1.Pos.Line)
-        } |
-        TLocal namelist {
-            $$ = &ast.LocalAssignStmt{Names: $2, Exprs:[]ast.Expr{}}
-            $$.SetLine($1.Pos.Line)
-        }
-
-elseifs: 
-        {
-            $$ = []ast.Stmt{}
-        } | 
-        elseifs TElseIf expr TThen block {
-            $$ = append($1, &ast.IfStmt{Condition: $3, Then: $5})
-            $$[len($$)-1].SetLine($2.Pos.Line)
-        }
-
-laststat:
-        TReturn {
-            $$ = &ast.ReturnStmt{Exprs:nil}
-            $$.SetLine($1.Pos.Line)
-        } |
-        TReturn exprlist {
-            $$ = &ast.ReturnStmt{Exprs:$2}
-            $$.SetLine($1.Pos.Line)
-        } |
-        TBreak  {
-            $$ = &ast.BreakStmt{}
-            $$.SetLine($1.Pos.Line)
-        }
-
-funcname: 
-        funcname1 {
-            $$ = $1
-        } |
-        funcname1 ':' TIdent {
-            $$ = &ast.FuncName{Func:nil, Receiver:$1.Func, Method: $3.Str}
-        }
-
-funcname1:
-        TIdent {
-            $$ = &ast.FuncName{Func: &ast.IdentExpr{Value:$1.Str}}
-            $$.Func.SetLine($1.Pos.Line)
-        } | 
-        funcname1 '.' TIdent {
-            key:= &ast.StringExpr{Value:$3.Str}
-            key.SetLine($3.Pos.Line)
-            fn := &ast.AttrGetExpr{Object: $1.Func, Key: key}
-            fn.SetLine($3.Pos.Line)
-            $$ = &ast.FuncName{Func: fn}
-        }
-
-varlist:
-        var {
-            $$ = []ast.Expr{$1}
-        } | 
-        varlist ',' var {
-            $$ = append($1, $3)
-        }
-
-var:
-        TIdent {
-            $$ = &ast.IdentExpr{Value:$1.Str}
-            $$.SetLine($1.Pos.Line)
-        } |
-        prefixexp '[' expr ']' {
-            $$ = &ast.AttrGetExpr{Object: $1, Key: $3}
-            $$.SetLine($1.Line())
-        } | 
-        prefixexp '.' TIdent {
-            key := &ast.StringExpr{Value:$3.Str}
-            key.SetLine($3.Pos.Line)
-            $$ = &ast.AttrGetExpr{Object: $1, Key: key}
-            $$.SetLine($1.Line())
-        }
-
-namelist:
-        TIdent {
-            $$ = []string{$1.Str}
-        } | 
-        namelist ','  TIdent {
-            $$ = append($1, $3.Str)
-        }
-
-exprlist:
-        expr {
-            $$ = []ast.Expr{$1}
-        } |
-        exprlist ',' expr {
-            $$ = append($1, $3)
-        }
-
-expr:
-        TNil {
-            $$ = &ast.NilExpr{}
-            $$.SetLine($1.Pos.Line)
-        } | 
-        TFalse {
-            $$ = &ast.FalseExpr{}
-            $$.SetLine($1.Pos.Line)
-        } | 
-        TTrue {
-            $$ = &ast.TrueExpr{}
-            $$.SetLine($1.Pos.Line)
-        } | 
-        TNumber {
-            $$ = &ast.NumberExpr{Value: $1.Str}
-            $$.SetLine($1.Pos.Line)
-        } | 
-        T3Comma {
-            $$ = &ast.Comma3Expr{}
-            $$.SetLine($1.Pos.Line)
-        } |
-        function {
-            $$ = $1
-        } | 
-        prefixexp {
-            $$ = $1
-        } |
-        string {
-            $$ = $1
-        } |
-        tableconstructor {
-            $$ = $1
-        } |
-        expr TOr expr {
-            $$ = &ast.LogicalOpExpr{Lhs: $1, Operator: "or", Rhs: $3}
-            $$.SetLine($1.Line())
-        } |
-        expr TAnd expr {
-            $$ = &ast.LogicalOpExpr{Lhs: $1, Operator: "and", Rhs: $3}
-            $$.SetLine($1.Line())
-        } |
-        expr '>' expr {
-            $$ = &ast.RelationalOpExpr{Lhs: $1, Operator: ">", Rhs: $3}
-            $$.SetLine($1.Line())
-        } |
-        expr '<' expr {
-            $$ = &ast.RelationalOpExpr{Lhs: $1, Operator: "<", Rhs: $3}
-            $$.SetLine($1.Line())
-        } |
-        expr TGte expr {
-            $$ = &ast.RelationalOpExpr{Lhs: $1, Operator: ">=", Rhs: $3}
-            $$.SetLine($1.Line())
-        } |
-        expr TLte expr {
-            $$ = &ast.RelationalOpExpr{Lhs: $1, Operator: "<=", Rhs: $3}
-            $$.SetLine($1.Line())
-        } |
-        expr TEqeq expr {
-            $$ = &ast.RelationalOpExpr{Lhs: $1, Operator: "==", Rhs: $3}
-            $$.SetLine($1.Line())
-        } |
-        expr TNeq expr {
-            $$ = &ast.RelationalOpExpr{Lhs: $1, Operator: "~=", Rhs: $3}
-            $$.SetLine($1.Line())
-        } |
-        expr T2Comma expr {
-            $$ = &ast.StringConcatOpExpr{Lhs: $1, Rhs: $3}
-            $$.SetLine($1.Line())
-        } |
-        expr '+' expr {
-            $$ = &ast.ArithmeticOpExpr{Lhs: $1, Operator: "+", Rhs: $3}
-            $$.SetLine($1.Line())
-        } |
-        expr '-' expr {
-            $$ = &ast.ArithmeticOpExpr{Lhs: $1, Operator: "-", Rhs: $3}
-            $$.SetLine($1.Line())
-        } |
-        expr '*' expr {
-            $$ = &ast.ArithmeticOpExpr{Lhs: $1, Operator: "*", Rhs: $3}
-            $$.SetLine($1.Line())
-        } |
-        expr '/' expr {
-            $$ = &ast.ArithmeticOpExpr{Lhs: $1, Operator: "/", Rhs: $3}
-            $$.SetLine($1.Line())
-        } |
-        expr '%' expr {
-            $$ = &ast.ArithmeticOpExpr{Lhs: $1, Operator: "%", Rhs: $3}
-            $$.SetLine($1.Line())
-        } |
-        expr '^' expr {
-            $$ = &ast.ArithmeticOpExpr{Lhs: $1, Operator: "^", Rhs: $3}
-            $$.SetLine($1.Line())
-        } |
-        '-' expr %prec UNARY {
-            $$ = &ast.UnaryMinusOpExpr{Expr: $2}
-            $$.SetLine($2.Line())
-        } |
-        TNot expr %prec UNARY {
-            $$ = &ast.UnaryNotOpExpr{Expr: $2}
-            $$.SetLine($2.Line())
-        } |
-        '#' expr %prec UNARY {
-            $$ = &ast.UnaryLenOpExpr{Expr: $2}
-            $$.SetLine($2.Line())
-        }
-
-string: 
-        TString {
-            $$ = &ast.StringExpr{Value: $1.Str}
-            $$.SetLine($1.Pos.Line)
-        } 
-
-prefixexp:
-        var {
-            $$ = $1
-        } |
-        afunctioncall {
-            $$ = $1
-        } |
-        functioncall {
-            $$ = $1
-        } |
-        '(' expr ')' {
-            $$ = $2
-            $$.SetLine($1.Pos.Line)
-        }
-
-afunctioncall:
-        '(' functioncall ')' {
-            $2.(*ast.FuncCallExpr).AdjustRet = true
-            $$ = $2
-        }
-
-functioncall:
-        prefixexp args {
-            $$ = &ast.FuncCallExpr{Func: $1, Args: $2}
-            $$.SetLine($1.Line())
-        } |
-        prefixexp ':' TIdent args {
-            $$ = &ast.FuncCallExpr{Method: $3.Str, Receiver: $1, Args: $4}
-            $$.SetLine($1.Line())
-        }
-
-args:
-        '(' ')' {
-            if yylex.(*Lexer).PNewLine {
-               yylex.(*Lexer).TokenError($1, "ambiguous syntax (function call x new statement)")
-            }
-            $$ = []ast.Expr{}
-        } |
-        '(' exprlist ')' {
-            if yylex.(*Lexer).PNewLine {
-               yylex.(*Lexer).TokenError($1, "ambiguous syntax (function call x new statement)")
-            }
-            $$ = $2
-        } |
-        tableconstructor {
-            $$ = []ast.Expr{$1}
-        } | 
-        string {
-            $$ = []ast.Expr{$1}
-        }
-
-function:
-        TFunction funcbody {
-            $$ = &ast.FunctionExpr{ParList:$2.ParList, Stmts: $2.Stmts}
-            $$.SetLine($1.Pos.Line)
-            $$.SetLastLine($2.LastLine())
-        }
-
-funcbody:
-        '(' parlist ')' block TEnd {
-            $$ = &ast.FunctionExpr{ParList: $2, Stmts: $4}
-            $$.SetLine($1.Pos.Line)
-            $$.SetLastLine($5.Pos.Line)
-        } | 
-        '(' ')' block TEnd {
-            $$ = &ast.FunctionExpr{ParList: &ast.ParList{HasVargs: false, Names: []string{}}, Stmts: $3}
-            $$.SetLine($1.Pos.Line)
-            $$.SetLastLine($4.Pos.Line)
-        }
-
-parlist:
-        T3Comma {
-            $$ = &ast.ParList{HasVargs: true, Names: []string{}}
-        } | 
-        namelist {
-          $$ = &ast.ParList{HasVargs: false, Names: []string{}}
-          $$.Names = append($$.Names, $1...)
-        } | 
-        namelist ',' T3Comma {
-          $$ = &ast.ParList{HasVargs: true, Names: []string{}}
-          $$.Names = append($$.Names, $1...)
-        }
-
-
-tableconstructor:
-        '{' '}' {
-            $$ = &ast.TableExpr{Fields: []*ast.Field{}}
-            $$.SetLine($1.Pos.Line)
-        } |
-        '{' fieldlist '}' {
-            $$ = &ast.TableExpr{Fields: $2}
-            $$.SetLine($1.Pos.Line)
-        }
-
-
-fieldlist:
-        field {
-            $$ = []*ast.Field{$1}
-        } | 
-        fieldlist fieldsep field {
-            $$ = append($1, $3)
-        } | 
-        fieldlist fieldsep {
-            $$ = $1
-        }
-
-field:
-        TIdent '=' expr {
-            $$ = &ast.Field{Key: &ast.StringExpr{Value:$1.Str}, Value: $3}
-            $$.Key.SetLine($1.Pos.Line)
-        } | 
-        '[' expr ']' '=' expr {
-            $$ = &ast.Field{Key: $2, Value: $5}
-        } |
-        expr {
-            $$ = &ast.Field{Value: $1}
-        }
-
-fieldsep:
-        ',' {
-            $$ = ","
-        } | 
-        ';' {
-            $$ = ";"
-        }
-
-%%
-
-func TokenName(c int) string {
-	if c >= TAnd && c-TAnd < len(yyToknames) {
-		if yyToknames[c-TAnd] != "" {
-			return yyToknames[c-TAnd]
-		}
-	}
-    return string([]byte{byte(c)})
-}
-
+%{
+package parse
+
+import (
+  "github.com/edunx/lua/ast"
+)
+%}
+%type<stmts> chunk
+%type<stmts> chunk1
+%type<stmts> block
+%type<stmt>  stat
+%type<stmts> elseifs
+%type<stmt>  laststat
+%type<funcname> funcname
+%type<funcname> funcname1
+%type<exprlist> varlist
+%type<expr> var
+%type<namelist> namelist
+%type<exprlist> exprlist
+%type<expr> expr
+%type<expr> string
+%type<expr> prefixexp
+%type<expr> functioncall
+%type<expr> afunctioncall
+%type<exprlist> args
+%type<expr> function
+%type<funcexpr> funcbody
+%type<parlist> parlist
+%type<expr> tableconstructor
+%type<fieldlist> fieldlist
+%type<field> field
+%type<fieldsep> fieldsep
+
+%union {
+  token  ast.Token
+
+  stmts    []ast.Stmt
+  stmt     ast.Stmt
+
+  funcname *ast.FuncName
+  funcexpr *ast.FunctionExpr
+
+  exprlist []ast.Expr
+  expr   ast.Expr
+
+  fieldlist []*ast.Field
+  field     *ast.Field
+  fieldsep  string
+
+  namelist []string
+  namepos  []ast.Position
+  parlist  *ast.ParList
+}
+
+/* Reserved words */
+%token<token> TAnd TBreak TDo TElse TElseIf TEnd TFalse TFor TFunction TIf TIn TLocal TNil TNot TOr TReturn TRepeat TThen TTrue TUntil TWhile 
+
+/* Literals */
+%token<token> TEqeq TNeq TLte TGte T2Comma T3Comma TIdent TNumber TString '{' '('
+
+/* Operators */
+%left TOr
+%left TAnd
+%left '>' '<' TGte TLte TEqeq TNeq
+%right T2Comma
+%left '+' '-'
+%left '*' '/' '%'
+%right UNARY /* not # -(unary) */
+%right '^'
+
+%%
+
+chunk: 
+        chunk1 {
+            $$ = $1
+            if l, ok := yylex.(*Lexer); ok {
+                l.Stmts = $$
+            }
+        } |
+        chunk1 laststat {
+            $$ = append($1, $2)
+            if l, ok := yylex.(*Lexer); ok {
+                l.Stmts = $$
+            }
+        } | 
+        chunk1 laststat ';' {
+            $$ = append($1, $2)
+            if l, ok := yylex.(*Lexer); ok {
+                l.Stmts = $$
+            }
+        }
+
+chunk1: 
+        {
+            $$ = []ast.Stmt{}
+        } |
+        chunk1 stat {
+            $$ = append($1, $2)
+        } | 
+        chunk1 ';' {
+            $$ = $1
+        }
+
+block: 
+        chunk {
+            $$ = $1
+        }
+
+stat:
+        varlist '=' exprlist {
+            $$ = &ast.AssignStmt{Lhs: $1, Rhs: $3}
+            setStart($$, startOf($1[0]))
+            setEnd($$, endOf($3[len($3)-1]))
+        } |
+        /* 'stat = functioncal' causes a reduce/reduce conflict */
+        prefixexp {
+            if _, ok := $1.(*ast.FuncCallExpr); !ok {
+               yylex.(*Lexer).Error("parse error")
+            } else {
+              $$ = &ast.FuncCallStmt{Expr: $1}
+              setStart($$, startOf($1))
+              setEnd($$, endOf($1))
+            }
+        } |
+        TDo block TEnd {
+            $$ = &ast.DoBlockStmt{Stmts: $2}
+            setStart($$, $1.Pos)
+            setEnd($$, $3.End)
+        } |
+        TWhile expr TDo block TEnd {
+            $$ = &ast.WhileStmt{Condition: $2, Stmts: $4}
+            setStart($$, $1.Pos)
+            setEnd($$, $5.End)
+        } |
+        TRepeat block TUntil expr {
+            $$ = &ast.RepeatStmt{Condition: $4, Stmts: $2}
+            setStart($$, $1.Pos)
+            setEnd($$, endOf($4))
+        } |
+        TIf expr TThen block elseifs TEnd {
+            $$ = &ast.IfStmt{Condition: $2, Then: $4}
+            cur := $$
+            for _, elseif := range $5 {
+                cur.(*ast.IfStmt).Else = []ast.Stmt{elseif}
+                setEnd(elseif, $6.End)
+                cur = elseif
+            }
+            setStart($$, $1.Pos)
+            setEnd($$, $6.End)
+        } |
+        TIf expr TThen block elseifs TElse block TEnd {
+            $$ = &ast.IfStmt{Condition: $2, Then: $4}
+            cur := $$
+            for _, elseif := range $5 {
+                cur.(*ast.IfStmt).Else = []ast.Stmt{elseif}
+                setEnd(elseif, $8.End)
+                cur = elseif
+            }
+            cur.(*ast.IfStmt).Else = $7
+            cur.(*ast.IfStmt).ElseLine = $6.Pos.Line
+            setStart($$, $1.Pos)
+            setEnd($$, $8.End)
+        } |
+        TFor TIdent '=' expr ',' expr TDo block TEnd {
+            $$ = &ast.NumberForStmt{Name: $2.Str, NamePos: $2.Pos, Init: $4, Limit: $6, Stmts: $8}
+            setStart($$, $1.Pos)
+            setEnd($$, $9.End)
+        } |
+        TFor TIdent '=' expr ',' expr ',' expr TDo block TEnd {
+            $$ = &ast.NumberForStmt{Name: $2.Str, NamePos: $2.Pos, Init: $4, Limit: $6, Step:$8, Stmts: $10}
+            setStart($$, $1.Pos)
+            setEnd($$, $11.End)
+        } |
+        TFor namelist TIn exprlist TDo block TEnd {
+            $$ = &ast.GenericForStmt{Names:$2, NamePos: $<namepos>2, Exprs:$4, Stmts: $6}
+            setStart($$, $1.Pos)
+            setEnd($$, $7.End)
+        } |
+        TFunction funcname funcbody {
+            $$ = &ast.FuncDefStmt{Name: $2, Func: $3}
+            setStart($$, $1.Pos)
+            setEnd($$, endOf($3))
+        } |
+        TLocal TFunction TIdent funcbody {
+            $$ = &ast.LocalAssignStmt{Names:[]string{$3.Str}, NamePos: []ast.Position{$3.Pos}, Exprs: []ast.Expr{$4}}
+            setStart($$, $1.Pos)
+            setEnd($$, endOf($4))
+        } | 
+        TLocal namelist '=' exprlist {
+            $$ = &ast.LocalAssignStmt{Names: $2, NamePos: $<namepos>2, Exprs:$4}
+            setStart($$, $1.Pos)
+            setEnd($$, endOf($4[len($4)-1]))
+        } |
+        TLocal namelist {
+            $$ = &ast.LocalAssignStmt{Names: $2, NamePos: $<namepos>2, Exprs:[]ast.Expr{}}
+            setStart($$, $1.Pos)
+            setEnd($$, $<token>2.End)
+        }
+
+elseifs: 
+        {
+            $$ = []ast.Stmt{}
+        } | 
+        elseifs TElseIf expr TThen block {
+            $$ = append($1, &ast.IfStmt{Condition: $3, Then: $5})
+            setStart($$[len($$)-1], $2.Pos)
+        }
+
+laststat:
+        TReturn {
+            $$ = &ast.ReturnStmt{Exprs:nil}
+            setStart($$, $1.Pos)
+            setEnd($$, $1.End)
+        } |
+        TReturn exprlist {
+            $$ = &ast.ReturnStmt{Exprs:$2}
+            setStart($$, $1.Pos)
+            setEnd($$, endOf($2[len($2)-1]))
+        } |
+        TBreak  {
+            $$ = &ast.BreakStmt{}
+            setStart($$, $1.Pos)
+            setEnd($$, $1.End)
+        }
+
+funcname: 
+        funcname1 {
+            $$ = $1
+        } |
+        funcname1 ':' TIdent {
+            $$ = &ast.FuncName{Func:nil, Receiver:$1.Func, Method: $3.Str}
+        }
+
+funcname1:
+        TIdent {
+            $$ = &ast.FuncName{Func: &ast.IdentExpr{Value:$1.Str}}
+            setStart($$.Func, $1.Pos)
+            setEnd($$.Func, $1.End)
+        } | 
+        funcname1 '.' TIdent {
+            key:= &ast.StringExpr{Value:$3.Str}
+            setStart(key, $3.Pos)
+            setEnd(key, $3.End)
+            fn := &ast.AttrGetExpr{Object: $1.Func, Key: key}
+            setStart(fn, startOf($1.Func))
+            setEnd(fn, $3.End)
+            $$ = &ast.FuncName{Func: fn}
+        }
+
+varlist:
+        var {
+            $$ = []ast.Expr{$1}
+        } | 
+        varlist ',' var {
+            $$ = append($1, $3)
+        }
+
+var:
+        TIdent {
+            $$ = &ast.IdentExpr{Value:$1.Str}
+            setStart($$, $1.Pos)
+            setEnd($$, $1.End)
+        } |
+        prefixexp '[' expr ']' {
+            $$ = &ast.AttrGetExpr{Object: $1, Key: $3}
+            setStart($$, startOf($1))
+            setEnd($$, $<token>4.End)
+        } | 
+        prefixexp '.' TIdent {
+            key := &ast.StringExpr{Value:$3.Str}
+            setStart(key, $3.Pos)
+            setEnd(key, $3.End)
+            $$ = &ast.AttrGetExpr{Object: $1, Key: key}
+            setStart($$, startOf($1))
+            setEnd($$, $3.End)
+        }
+
+namelist:
+        TIdent {
+            $$ = []string{$1.Str}
+            $<namepos>$ = []ast.Position{$1.Pos}
+            $<token>$ = $1
+        } | 
+        namelist ','  TIdent {
+            $$ = append($1, $3.Str)
+            $<namepos>$ = append($<namepos>1, $3.Pos)
+            $<token>$ = $3
+        }
+
+exprlist:
+        expr {
+            $$ = []ast.Expr{$1}
+        } |
+        exprlist ',' expr {
+            $$ = append($1, $3)
+        }
+
+expr:
+        TNil {
+            $$ = &ast.NilExpr{}
+            setStart($$, $1.Pos)
+            setEnd($$, $1.End)
+        } | 
+        TFalse {
+            $$ = &ast.FalseExpr{}
+            setStart($$, $1.Pos)
+            setEnd($$, $1.End)
+        } | 
+        TTrue {
+            $$ = &ast.TrueExpr{}
+            setStart($$, $1.Pos)
+            setEnd($$, $1.End)
+        } | 
+        TNumber {
+            $$ = &ast.NumberExpr{Value: $1.Str}
+            setStart($$, $1.Pos)
+            setEnd($$, $1.End)
+        } | 
+        T3Comma {
+            $$ = &ast.Comma3Expr{}
+            setStart($$, $1.Pos)
+            setEnd($$, $1.End)
+        } |
+        function {
+            $$ = $1
+        } | 
+        prefixexp {
+            $$ = $1
+        } |
+        string {
+            $$ = $1
+        } |
+        tableconstructor {
+            $$ = $1
+        } |
+        expr TOr expr {
+            $$ = &ast.LogicalOpExpr{Lhs: $1, Operator: "or", Rhs: $3}
+            setStart($$, startOf($1))
+            setEnd($$, endOf($3))
+        } |
+        expr TAnd expr {
+            $$ = &ast.LogicalOpExpr{Lhs: $1, Operator: "and", Rhs: $3}
+            setStart($$, startOf($1))
+            setEnd($$, endOf($3))
+        } |
+        expr '>' expr {
+            $$ = &ast.RelationalOpExpr{Lhs: $1, Operator: ">", Rhs: $3}
+            setStart($$, startOf($1))
+            setEnd($$, endOf($3))
+        } |
+        expr '<' expr {
+            $$ = &ast.RelationalOpExpr{Lhs: $1, Operator: "<", Rhs: $3}
+            setStart($$, startOf($1))
+            setEnd($$, endOf($3))
+        } |
+        expr TGte expr {
+            $$ = &ast.RelationalOpExpr{Lhs: $1, Operator: ">=", Rhs: $3}
+            setStart($$, startOf($1))
+            setEnd($$, endOf($3))
+        } |
+        expr TLte expr {
+            $$ = &ast.RelationalOpExpr{Lhs: $1, Operator: "<=", Rhs: $3}
+            setStart($$, startOf($1))
+            setEnd($$, endOf($3))
+        } |
+        expr TEqeq expr {
+            $$ = &ast.RelationalOpExpr{Lhs: $1, Operator: "==", Rhs: $3}
+            setStart($$, startOf($1))
+            setEnd($$, endOf($3))
+        } |
+        expr TNeq expr {
+            $$ = &ast.RelationalOpExpr{Lhs: $1, Operator: "~=", Rhs: $3}
+            setStart($$, startOf($1))
+            setEnd($$, endOf($3))
+        } |
+        expr T2Comma expr {
+            $$ = &ast.StringConcatOpExpr{Lhs: $1, Rhs: $3}
+            setStart($$, startOf($1))
+            setEnd($$, endOf($3))
+        } |
+        expr '+' expr {
+            $$ = &ast.ArithmeticOpExpr{Lhs: $1, Operator: "+", Rhs: $3}
+            setStart($$, startOf($1))
+            setEnd($$, endOf($3))
+        } |
+        expr '-' expr {
+            $$ = &ast.ArithmeticOpExpr{Lhs: $1, Operator: "-", Rhs: $3}
+            setStart($$, startOf($1))
+            setEnd($$, endOf($3))
+        } |
+        expr '*' expr {
+            $$ = &ast.ArithmeticOpExpr{Lhs: $1, Operator: "*", Rhs: $3}
+            setStart($$, startOf($1))
+            setEnd($$, endOf($3))
+        } |
+        expr '/' expr {
+            $$ = &ast.ArithmeticOpExpr{Lhs: $1, Operator: "/", Rhs: $3}
+            setStart($$, startOf($1))
+            setEnd($$, endOf($3))
+        } |
+        expr '%' expr {
+            $$ = &ast.ArithmeticOpExpr{Lhs: $1, Operator: "%", Rhs: $3}
+            setStart($$, startOf($1))
+            setEnd($$, endOf($3))
+        } |
+        expr '^' expr {
+            $$ = &ast.ArithmeticOpExpr{Lhs: $1, Operator: "^", Rhs: $3}
+            setStart($$, startOf($1))
+            setEnd($$, endOf($3))
+        } |
+        '-' expr %prec UNARY {
+            $$ = &ast.UnaryMinusOpExpr{Expr: $2}
+            setStart($$, $<token>1.Pos)
+            setEnd($$, endOf($2))
+        } |
+        TNot expr %prec UNARY {
+            $$ = &ast.UnaryNotOpExpr{Expr: $2}
+            setStart($$, $1.Pos)
+            setEnd($$, endOf($2))
+        } |
+        '#' expr %prec UNARY {
+            $$ = &ast.UnaryLenOpExpr{Expr: $2}
+            setStart($$, $<token>1.Pos)
+            setEnd($$, endOf($2))
+        }
+
+string: 
+        TString {
+            $$ = &ast.StringExpr{Value: $1.Str}
+            setStart($$, $1.Pos)
+            setEnd($$, $1.End)
+        } 
+
+prefixexp:
+        var {
+            $$ = $1
+        } |
+        afunctioncall {
+            $$ = $1
+        } |
+        functioncall {
+            $$ = $1
+        } |
+        '(' expr ')' {
+            $$ = $2
+            setStart($$, $1.Pos)
+            setEnd($$, $<token>3.End)
+        }
+
+afunctioncall:
+        '(' functioncall ')' {
+            $2.(*ast.FuncCallExpr).AdjustRet = true
+            $$ = $2
+            setStart($$, $1.Pos)
+            setEnd($$, $<token>3.End)
+        }
+
+functioncall:
+        prefixexp args {
+            $$ = &ast.FuncCallExpr{Func: $1, Args: $2}
+            setStart($$, startOf($1))
+            setEnd($$, $<token>2.End)
+        } |
+        prefixexp ':' TIdent args {
+            $$ = &ast.FuncCallExpr{Method: $3.Str, Receiver: $1, Args: $4}
+            setStart($$, startOf($1))
+            setEnd($$, $<token>4.End)
+        }
+
+/* the token of args is the closing parenthesis of the arguments */
+args:
+        '(' ')' {
+            if yylex.(*Lexer).PNewLine {
+               yylex.(*Lexer).TokenError($1, "ambiguous syntax (function call x new statement)")
+            }
+            $$ = []ast.Expr{}
+            $<token>$ = $<token>2
+        } |
+        '(' exprlist ')' {
+            if yylex.(*Lexer).PNewLine {
+               yylex.(*Lexer).TokenError($1, "ambiguous syntax (function call x new statement)")
+            }
+            $$ = $2
+            $<token>$ = $<token>3
+        } |
+        tableconstructor {
+            $$ = []ast.Expr{$1}
+            $<token>$ = ast.Token{End: endOf($1)}
+        } | 
+        string {
+            $$ = []ast.Expr{$1}
+            $<token>$ = ast.Token{End: endOf($1)}
+        }
+
+function:
+        TFunction funcbody {
+            $$ = &ast.FunctionExpr{ParList:$2.ParList, Stmts: $2.Stmts}
+            setStart($$, $1.Pos)
+            setEnd($$, endOf($2))
+        }
+
+funcbody:
+        '(' parlist ')' block TEnd {
+            $$ = &ast.FunctionExpr{ParList: $2, Stmts: $4}
+            setStart($$, $1.Pos)
+            setEnd($$, $5.End)
+        } | 
+        '(' ')' block TEnd {
+            $$ = &ast.FunctionExpr{ParList: &ast.ParList{HasVargs: false, Names: []string{}}, Stmts: $3}
+            setStart($$, $1.Pos)
+            setEnd($$, $4.End)
+        }
+
+parlist:
+        T3Comma {
+            $$ = &ast.ParList{HasVargs: true, Names: []string{}}
+        } | 
+        namelist {
+          $$ = &ast.ParList{HasVargs: false, Names: []string{}, NamePos: $<namepos>1}
+          $$.Names = append($$.Names, $1...)
+        } | 
+        namelist ',' T3Comma {
+          $$ = &ast.ParList{HasVargs: true, Names: []string{}, NamePos: $<namepos>1}
+          $$.Names = append($$.Names, $1...)
+        }
+
+
+tableconstructor:
+        '{' '}' {
+            $$ = &ast.TableExpr{Fields: []*ast.Field{}}
+            setStart($$, $1.Pos)
+            setEnd($$, $<token>2.End)
+        } |
+        '{' fieldlist '}' {
+            $$ = &ast.TableExpr{Fields: $2}
+            setStart($$, $1.Pos)
+            setEnd($$, $<token>3.End)
+        }
+
+
+fieldlist:
+        field {
+            $$ = []*ast.Field{$1}
+        } | 
+        fieldlist fieldsep field {
+            $$ = append($1, $3)
+        } | 
+        fieldlist fieldsep {
+            $$ = $1
+        }
+
+field:
+        TIdent '=' expr {
+            $$ = &ast.Field{Key: &ast.StringExpr{Value:$1.Str}, Value: $3}
+            setStart($$.Key, $1.Pos)
+            setEnd($$.Key, $1.End)
+        } | 
+        '[' expr ']' '=' expr {
+            $$ = &ast.Field{Key: $2, Value: $5}
+        } |
+        expr {
+            $$ = &ast.Field{Value: $1}
+        }
+
+fieldsep:
+        ',' {
+            $$ = ","
+        } | 
+        ';' {
+            $$ = ";"
+        }
+
+%%
+
+func TokenName(c int) string {
+	if c >= TAnd && c-TAnd < len(yyToknames) {
+		if yyToknames[c-TAnd] != "" {
+			return yyToknames[c-TAnd]
+		}
+	}
+    return string([]byte{byte(c)})
+}
+
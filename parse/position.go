@@ -0,0 +1,25 @@
+package parse
+
+import (
+	"github.com/edunx/lua/ast"
+)
+
+// setStart sets the first line and column of node.
+func setStart(node ast.PositionHolder, pos ast.Position) {
+	node.SetLine(pos.Line)
+	node.SetColumn(pos.Column)
+}
+
+// setEnd sets the last line and column of node.
+func setEnd(node ast.PositionHolder, pos ast.Position) {
+	node.SetLastLine(pos.Line)
+	node.SetLastColumn(pos.Column)
+}
+
+func startOf(node ast.PositionHolder) ast.Position {
+	return ast.Position{Line: node.Line(), Column: node.Column()}
+}
+
+func endOf(node ast.PositionHolder) ast.Position {
+	return ast.Position{Line: node.LastLine(), Column: node.LastColumn()}
+}
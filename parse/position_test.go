@@ -0,0 +1,58 @@
+package parse
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/edunx/lua/ast"
+)
+
+func span(node ast.PositionHolder) [4]int {
+	return [4]int{node.Line(), node.Column(), node.LastLine(), node.LastColumn()}
+}
+
+func TestPositions(t *testing.T) {
+	src := `local v = t.a["b"]:c(1,
+  2).d
+if x then
+elseif y then
+else if z then end
+end
+`
+	chunk, err := Parse(strings.NewReader(src), "test.lua")
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := chunk[0].(*ast.LocalAssignStmt)
+	attr := local.Exprs[0].(*ast.AttrGetExpr)
+	call := attr.Object.(*ast.FuncCallExpr)
+	index := call.Receiver.(*ast.AttrGetExpr)
+	ifstmt := chunk[1].(*ast.IfStmt)
+	cases := []struct {
+		node     ast.PositionHolder
+		expected [4]int
+	}{
+		{local, [4]int{1, 1, 2, 6}},
+		{attr, [4]int{1, 11, 2, 6}},
+		{attr.Key, [4]int{2, 6, 2, 6}},
+		{call, [4]int{1, 11, 2, 4}},
+		{call.Args[1], [4]int{2, 3, 2, 3}},
+		{index, [4]int{1, 11, 1, 18}},
+		{index.Key, [4]int{1, 15, 1, 17}},
+		{ifstmt, [4]int{3, 1, 6, 3}},
+		{ifstmt.Condition, [4]int{3, 4, 3, 4}},
+	}
+	for i, c := range cases {
+		if got := span(c.node); got != c.expected {
+			t.Errorf("%d: expected %v, but got %v", i, c.expected, got)
+		}
+	}
+
+	elseif := ifstmt.ElseIf()
+	if elseif == nil || span(elseif) != [4]int{4, 1, 6, 3} {
+		t.Fatalf("unexpected elseif part %v", elseif)
+	}
+	if nested := elseif.Else[0].(*ast.IfStmt); elseif.ElseIf() != nil || span(nested) != [4]int{5, 6, 5, 18} {
+		t.Errorf("unexpected else part %v", span(nested))
+	}
+}
@@ -0,0 +1,431 @@
+package parse
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/edunx/lua/ast"
+)
+
+// Codes of the diagnostics returned by ParseRecover.
+const (
+	CodeInvalidToken     = "invalid-token"
+	CodeUnexpectedToken  = "unexpected-token"
+	CodeUnexpectedEOF    = "unexpected-eof"
+	CodeAmbiguousCall    = "ambiguous-call"
+	CodeInvalidStatement = "invalid-statement"
+)
+
+// Diagnostic is a syntax error found by ParseRecover. End is the position following the last
+// character of the offending token. Expected lists the tokens the parser accepted instead,
+// if any.
+type Diagnostic struct {
+	Start    ast.Position
+	End      ast.Position
+	Code     string
+	Message  string
+	Expected []string
+}
+
+func (d *Diagnostic) Error() string {
+	msg := d.Message
+	if len(d.Expected) > 0 {
+		msg += ", expected '" + strings.Join(d.Expected, "', '") + "'"
+	}
+	if d.Start.Line == EOF {
+		return fmt.Sprintf("%v at EOF:   %s", d.Start.Source, msg)
+	}
+	return fmt.Sprintf("%v line:%d(column:%d):   %s", d.Start.Source, d.Start.Line, d.Start.Column, msg)
+}
+
+// scannedToken is a token and the state of the lexer after it was scanned.
+type scannedToken struct {
+	tok      ast.Token
+	pnewline bool
+}
+
+// ParseRecover parses a chunk and reports every syntax error instead of stopping at the
+// first one. After an error, the statement holding the offending token is dropped and the
+// parsing resumes at the next statement, so the returned chunk holds the statements
+// without errors.
+func ParseRecover(reader io.Reader, name string) ([]ast.Stmt, []*Diagnostic) {
+	toks, diags := scanTokens(NewScanner(reader, name))
+	closed := false
+	for {
+		f, stack := lrRun(toks)
+		if f < 0 {
+			chunk, err := parseTokens(toks)
+			if err == nil {
+				sortDiagnostics(diags)
+				return chunk, diags
+			}
+			perr, ok := err.(*Error)
+			if !ok {
+				return nil, append(diags, &Diagnostic{Code: CodeInvalidStatement, Message: err.Error()})
+			}
+			f = tokenIndex(toks, perr.Pos)
+			d := tokenDiagnostic(toks[f], CodeAmbiguousCall, perr.Message)
+			if perr.Message == "parse error" {
+				// the statement is an expression that precedes the current token.
+				if f > 0 {
+					f--
+				}
+				d = tokenDiagnostic(toks[f], CodeInvalidStatement, "syntax error: expression is not a statement")
+			}
+			diags = addDiagnostic(diags, d)
+			toks = dropStatement(toks, f)
+			continue
+		}
+
+		if f == len(toks)-1 {
+			d := tokenDiagnostic(toks[f], CodeUnexpectedEOF, "unexpected <eof>")
+			d.Expected = expectedTokens(stack)
+			diags = addDiagnostic(diags, d)
+			if !closed {
+				closed = true
+				if closers := closingTokens(toks); len(closers) > 0 {
+					toks = append(toks[:f:f], append(closers, toks[f])...)
+					continue
+				}
+			}
+		} else {
+			d := tokenDiagnostic(toks[f], CodeUnexpectedToken, fmt.Sprintf("syntax error near '%s'", toks[f].tok.Str))
+			d.Expected = expectedTokens(stack)
+			diags = addDiagnostic(diags, d)
+		}
+		if len(toks) == 1 {
+			sortDiagnostics(diags)
+			return nil, diags
+		}
+		toks = dropStatement(toks, f)
+	}
+}
+
+// addDiagnostic adds d to diags, unless the last diagnostic is at the same position.
+func addDiagnostic(diags []*Diagnostic, d *Diagnostic) []*Diagnostic {
+	if n := len(diags); n > 0 && diags[n-1].Start == d.Start {
+		return diags
+	}
+	return append(diags, d)
+}
+
+func sortDiagnostics(diags []*Diagnostic) {
+	key := func(d *Diagnostic) (int, int) {
+		if d.Start.Line == EOF {
+			return int(^uint(0) >> 1), 0
+		}
+		return d.Start.Line, d.Start.Column
+	}
+	sort.SliceStable(diags, func(i, j int) bool {
+		li, ci := key(diags[i])
+		lj, cj := key(diags[j])
+		return li < lj || li == lj && ci < cj
+	})
+}
+
+func scanTokens(sc *Scanner) ([]scannedToken, []*Diagnostic) {
+	var toks []scannedToken
+	var diags []*Diagnostic
+	lexer := &Lexer{scanner: sc, Token: ast.Token{Str: ""}, PrevTokenType: TNil}
+	for {
+		tok, err := sc.Scan(lexer)
+		if err != nil {
+			d := &Diagnostic{Code: CodeInvalidToken, Message: err.Error()}
+			if perr, ok := err.(*Error); ok {
+				d.Start, d.End, d.Message = perr.Pos, perr.Pos, perr.Message
+			}
+			diags = append(diags, d)
+			if sc.Pos.Line == EOF {
+				tok = ast.Token{Type: EOF, Pos: sc.Pos}
+			} else {
+				continue
+			}
+		}
+		lexer.PrevTokenType = tok.Type
+		lexer.Token = tok
+		toks = append(toks, scannedToken{tok, lexer.PNewLine})
+		if tok.Type < 0 {
+			return toks, diags
+		}
+	}
+}
+
+// Tokens returns the tokens of a chunk, up to and including the EOF token. Invalid tokens
+// are skipped.
+func Tokens(reader io.Reader, name string) []ast.Token {
+	toks, _ := scanTokens(NewScanner(reader, name))
+	list := make([]ast.Token, len(toks))
+	for i, t := range toks {
+		list[i] = t.tok
+	}
+	return list
+}
+
+func parseTokens(toks []scannedToken) (chunk []ast.Stmt, err error) {
+	lexer := &Lexer{Token: ast.Token{Str: ""}, PrevTokenType: TNil, tokens: toks}
+	defer func() {
+		if e := recover(); e != nil {
+			err, _ = e.(error)
+		}
+	}()
+	yyParse(lexer)
+	chunk = lexer.Stmts
+	return
+}
+
+func (lx *Lexer) lexToken(lval *yySymType) int {
+	if len(lx.tokens) == 0 {
+		return 0
+	}
+	t := lx.tokens[0]
+	lx.tokens = lx.tokens[1:]
+	lx.PrevTokenType = lx.Token.Type
+	lx.PNewLine = t.pnewline
+	lval.token = t.tok
+	lx.Token = t.tok
+	if t.tok.Type < 0 {
+		return 0
+	}
+	return int(t.tok.Type)
+}
+
+func tokenIndex(toks []scannedToken, pos ast.Position) int {
+	for i, t := range toks {
+		if t.tok.Pos == pos {
+			return i
+		}
+	}
+	return len(toks) - 1
+}
+
+func tokenDiagnostic(t scannedToken, code, msg string) *Diagnostic {
+	end := t.tok.End
+	if end.Line != EOF {
+		end.Column++
+	}
+	return &Diagnostic{Start: t.tok.Pos, End: end, Code: code, Message: msg}
+}
+
+// nesting returns the change of the block nesting level caused by a token.
+func nesting(typ int) int {
+	switch typ {
+	case TFunction, TDo, TThen, TRepeat, '(', '{', '[':
+		return 1
+	case TEnd, TUntil, TElseIf, ')', '}', ']':
+		return -1
+	}
+	return 0
+}
+
+// startsStatement reports whether a token starts or ends a statement.
+func startsStatement(typ int) bool {
+	switch typ {
+	case TLocal, TFunction, TIf, TWhile, TFor, TDo, TRepeat, TReturn, TBreak,
+		TEnd, TElse, TElseIf, TUntil, EOF:
+		return true
+	}
+	return false
+}
+
+// dropStatement removes the tokens of the statement holding the token f: it starts at the
+// last line before f nested at most as deep as f, and spans the lines nested deeper. If f
+// starts a statement on its own line, the incomplete statement before f is removed instead.
+func dropStatement(toks []scannedToken, f int) []scannedToken {
+	depth := make([]int, len(toks))
+	for i := 1; i < len(toks); i++ {
+		depth[i] = depth[i-1] + nesting(toks[i-1].tok.Type)
+	}
+	lineStart := func(i int) bool {
+		return i == 0 || toks[i].tok.Pos.Line != toks[i-1].tok.Pos.Line
+	}
+	start := func(f int) int {
+		for i := f; i > 0; i-- {
+			if toks[i].tok.Type >= 0 && lineStart(i) && depth[i] <= depth[f] {
+				return i
+			}
+		}
+		return 0
+	}
+
+	if f > 0 && lineStart(f) && startsStatement(toks[f].tok.Type) {
+		s := start(f - 1)
+		return append(toks[:s:s], toks[f:]...)
+	}
+	s := start(f)
+	e := len(toks) - 1
+	for i := f + 1; i < len(toks)-1; i++ {
+		if lineStart(i) && depth[i] <= depth[s] {
+			e = i
+			break
+		}
+	}
+	if e <= s {
+		e = s + 1
+	}
+	return append(toks[:s:s], toks[e:]...)
+}
+
+// closingTokens returns the tokens closing the blocks left open at the end of toks.
+func closingTokens(toks []scannedToken) []scannedToken {
+	var open []int
+	for _, t := range toks {
+		switch n := nesting(t.tok.Type); {
+		case n > 0:
+			open = append(open, t.tok.Type)
+		case n < 0 && len(open) > 0:
+			open = open[:len(open)-1]
+		}
+	}
+	pos := toks[len(toks)-1].tok.Pos
+	var closers []scannedToken
+	add := func(typ int, str string) {
+		closers = append(closers, scannedToken{tok: ast.Token{Type: typ, Name: TokenName(typ), Str: str, Pos: pos}})
+	}
+	for i := len(open) - 1; i >= 0; i-- {
+		switch open[i] {
+		case TRepeat:
+			add(TUntil, "until")
+			add(TTrue, "true")
+		case '(':
+			add(')', ")")
+		case '{':
+			add('}', "}")
+		case '[':
+			add(']', "]")
+		default:
+			add(TEnd, "end")
+		}
+	}
+	return closers
+}
+
+// singleToken is a lexer returning a single token, used to translate tokens into the codes
+// of the parser tables.
+type singleToken int
+
+func (t singleToken) Lex(lval *yySymType) int { return int(t) }
+func (t singleToken) Error(string)            {}
+
+func tokenCode(typ int) int {
+	if typ < 0 {
+		typ = 0
+	}
+	var lval yySymType
+	return yylex1(singleToken(typ), &lval)
+}
+
+// lrStep applies the parser tables to the state stack for the lookahead code. It returns
+// the new stack and whether the lookahead was shifted, or accepted is set, or the stack is
+// nil on an error.
+func lrStep(stack []int, code int) (next []int, shifted, accepted bool) {
+	state := stack[len(stack)-1]
+	if n := yyPact[state]; n > yyFlag {
+		n += code
+		if n >= 0 && n < yyLast && yyChk[yyAct[n]] == code {
+			return append(stack, yyAct[n]), true, false
+		}
+	}
+	n := yyDef[state]
+	if n == -2 {
+		xi := 0
+		for yyExca[xi+0] != -1 || yyExca[xi+1] != state {
+			xi += 2
+		}
+		for xi += 2; ; xi += 2 {
+			if yyExca[xi+0] < 0 || yyExca[xi+0] == code {
+				break
+			}
+		}
+		if n = yyExca[xi+1]; n < 0 {
+			return stack, false, true
+		}
+	}
+	if n == 0 {
+		return nil, false, false
+	}
+
+	// reduce by production n
+	stack = stack[:len(stack)-yyR2[n]]
+	nt := yyR1[n]
+	g := yyPgo[nt]
+	j := g + stack[len(stack)-1] + 1
+	state = yyAct[g]
+	if j < yyLast && yyChk[yyAct[j]] == -nt {
+		state = yyAct[j]
+	}
+	return append(stack, state), false, false
+}
+
+// lrRun runs the parser tables on toks. It returns the index of the first token the parser
+// does not accept and the state stack after the last shift, before the default reductions
+// the token triggered, or -1 if toks are accepted.
+func lrRun(toks []scannedToken) (int, []int) {
+	stack := []int{0}
+	last := []int{0}
+	for i := 0; i < len(toks); {
+		code := tokenCode(toks[i].tok.Type)
+		next, shifted, accepted := lrStep(stack, code)
+		switch {
+		case accepted:
+			return -1, nil
+		case next == nil:
+			return i, last
+		case shifted:
+			i++
+			// lrStep appends to the stack, so the one after the shift is copied.
+			last = append(last[:0], next...)
+		}
+		stack = next
+	}
+	return len(toks) - 1, last
+}
+
+var (
+	tokenCodes     map[int]string
+	tokenCodesOnce sync.Once
+)
+
+// tokenNames returns the names of the tokens by parser code.
+func tokenNames() map[int]string {
+	tokenCodesOnce.Do(initTokenNames)
+	return tokenCodes
+}
+
+func initTokenNames() {
+	names := map[int]string{tokenCode(EOF): "<eof>"}
+	for ch := 1; ch < len(yyTok1); ch++ {
+		if ch > ' ' && ch < 0x7f {
+			names[tokenCode(ch)] = string(rune(ch))
+		}
+	}
+	for word, typ := range reservedWords {
+		names[tokenCode(typ)] = word
+	}
+	for typ, name := range map[int]string{
+		TEqeq: "==", TNeq: "~=", TLte: "<=", TGte: ">=", T2Comma: "..", T3Comma: "...",
+		TIdent: "<name>", TNumber: "<number>", TString: "<string>",
+	} {
+		names[tokenCode(typ)] = name
+	}
+	tokenCodes = names
+}
+
+// expectedTokens returns the tokens that the parser accepts in the state stack.
+func expectedTokens(stack []int) []string {
+	var expected []string
+	for code, name := range tokenNames() {
+		s := append([]int(nil), stack...)
+		for steps := 0; s != nil && steps < 1000; steps++ {
+			var shifted, accepted bool
+			if s, shifted, accepted = lrStep(s, code); shifted || accepted {
+				expected = append(expected, name)
+				break
+			}
+		}
+	}
+	sort.Strings(expected)
+	return expected
+}
@@ -0,0 +1,111 @@
+package parse
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/edunx/lua/ast"
+)
+
+func TestParseRecover(t *testing.T) {
+	src := `local a = = 1
+function f(x)
+  local y = x +
+  return y
+end
+print(a
+local b = 2
+x
+if a then
+  b = 3
+`
+	chunk, diags := ParseRecover(strings.NewReader(src), "test.lua")
+	expected := []struct {
+		line, column int
+		code         string
+	}{
+		{1, 11, CodeUnexpectedToken},
+		{4, 3, CodeUnexpectedToken},
+		{7, 1, CodeUnexpectedToken},
+		{8, 1, CodeInvalidStatement},
+		{EOF, 0, CodeUnexpectedEOF},
+	}
+	if len(diags) != len(expected) {
+		t.Fatalf("expected %d diagnostics, but got %v", len(expected), diags)
+	}
+	for i, e := range expected {
+		d := diags[i]
+		if d.Start.Line != e.line || d.Start.Column != e.column || d.Code != e.code {
+			t.Errorf("diagnostic %d: expected %d:%d %s, but got %v (%s)", i, e.line, e.column, e.code, d, d.Code)
+		}
+	}
+	if got := " " + strings.Join(diags[2].Expected, " ") + " "; !strings.Contains(got, " ) ") || !strings.Contains(got, " , ") || strings.Contains(got, " local ") {
+		t.Errorf("unexpected expected tokens: %q", got)
+	}
+	if diags[0].End.Column != 12 {
+		t.Errorf("unexpected end: %v", diags[0].End)
+	}
+
+	// the function without its broken statement, local b and the closed if statement.
+	if len(chunk) != 3 || len(chunk[0].(*ast.FuncDefStmt).Func.Stmts) != 1 {
+		t.Errorf("unexpected partial chunk: %s", Dump(chunk))
+	}
+}
+
+func TestParseRecoverStatements(t *testing.T) {
+	cases := []struct {
+		src      string
+		expected []string
+		excluded []string
+	}{
+		{"return return", []string{"<eof>", "<name>", "nil", ";"}, []string{"return", "end"}},
+		{"x = 1 +\ny = 2", []string{"<eof>", "+", "(", "local", "return"}, []string{"=", "end"}},
+		{"function f()\n  return return\nend", []string{"end", "<name>", ";"}, []string{"<eof>"}},
+		{"while x do\n  local = 1\nend", []string{"<name>", "function"}, []string{"<eof>", "end"}},
+		{"if x end", []string{"then", "=="}, []string{"<eof>", "end"}},
+	}
+	for _, c := range cases {
+		_, diags := ParseRecover(strings.NewReader(c.src), "test.lua")
+		if len(diags) == 0 {
+			t.Errorf("%q: expected diagnostics", c.src)
+			continue
+		}
+		expected := map[string]bool{}
+		for _, tok := range diags[0].Expected {
+			expected[tok] = true
+		}
+		for _, tok := range c.expected {
+			if !expected[tok] {
+				t.Errorf("%q: %q is not in the expected tokens %q", c.src, tok, diags[0].Expected)
+			}
+		}
+		for _, tok := range c.excluded {
+			if expected[tok] {
+				t.Errorf("%q: %q is in the expected tokens %q", c.src, tok, diags[0].Expected)
+			}
+		}
+	}
+}
+
+func TestParseRecoverValid(t *testing.T) {
+	files, _ := filepath.Glob("../_glua-tests/*.lua")
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := Parse(strings.NewReader(string(src)), file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunk, diags := ParseRecover(strings.NewReader(string(src)), file)
+		if len(diags) != 0 {
+			t.Errorf("%s: unexpected diagnostics %v", file, diags)
+		}
+		if Dump(chunk) != Dump(expected) {
+			t.Errorf("%s: the recovering parser returns another chunk", file)
+		}
+	}
+}
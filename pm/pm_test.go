@@ -0,0 +1,216 @@
+package pm
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// recursiveVM is the original recursive matcher. It is kept as a reference for the iterative one.
+func recursiveVM(src []byte, insts []inst, pc, sp int, ms ...*MatchData) (bool, int, *MatchData) {
+	var m *MatchData
+	if len(ms) == 0 {
+		m = &MatchData{[]uint32{}}
+	} else {
+		m = ms[0]
+	}
+redo:
+	inst := insts[pc]
+	switch inst.OpCode {
+	case opChar:
+		if sp >= len(src) || !inst.Class.Matches(int(src[sp])) {
+			return false, sp, m
+		}
+		pc++
+		sp++
+		goto redo
+	case opMatch:
+		return true, sp, m
+	case opTailMatch:
+		return sp >= len(src), sp, m
+	case opJmp:
+		pc = inst.Operand1
+		goto redo
+	case opSplit:
+		if ok, nsp, _ := recursiveVM(src, insts, inst.Operand1, sp, m); ok {
+			return true, nsp, m
+		}
+		pc = inst.Operand2
+		goto redo
+	case opSave:
+		s := m.setCapture(inst.Operand1, sp)
+		if ok, nsp, _ := recursiveVM(src, insts, pc+1, sp, m); ok {
+			return true, nsp, m
+		}
+		m.restoreCapture(inst.Operand1, s)
+		return false, sp, m
+	case opPSave:
+		m.addPosCapture(inst.Operand1, sp+1)
+		pc++
+		goto redo
+	case opBrace:
+		if sp >= len(src) || int(src[sp]) != inst.Operand1 {
+			return false, sp, m
+		}
+		count := 1
+		for sp = sp + 1; sp < len(src); sp++ {
+			if int(src[sp]) == inst.Operand2 {
+				count--
+			}
+			if count == 0 {
+				pc++
+				sp++
+				goto redo
+			}
+			if int(src[sp]) == inst.Operand1 {
+				count++
+			}
+		}
+		return false, sp, m
+	case opNumber:
+		idx := inst.Operand1 * 2
+		if idx >= m.CaptureLength()-1 {
+			panic(newError(_UNKNOWN, "invalid capture index"))
+		}
+		capture := src[m.Capture(idx):m.Capture(idx+1)]
+		for i := 0; i < len(capture); i++ {
+			if i+sp >= len(src) || capture[i] != src[i+sp] {
+				return false, sp, m
+			}
+		}
+		pc++
+		sp += len(capture)
+		goto redo
+	}
+	panic("should not reach here")
+}
+
+func recursiveFind(p string, src []byte, offset, limit int) []*MatchData {
+	pat := parsePattern(newScanner([]byte(p)), true)
+	insts := compilePattern(pat)
+	matches := []*MatchData{}
+	for sp := offset; sp <= len(src); {
+		ok, nsp, ms := recursiveVM(src, insts, 0, sp)
+		sp++
+		if ok {
+			if sp < nsp {
+				sp = nsp
+			}
+			matches = append(matches, ms)
+		}
+		if len(matches) == limit || pat.MustHead {
+			break
+		}
+	}
+	return matches
+}
+
+func dumpMatches(mds []*MatchData) string {
+	buf := []string{}
+	for _, md := range mds {
+		caps := []string{}
+		for i := 0; i < md.CaptureLength(); i++ {
+			caps = append(caps, fmt.Sprintf("%v:%v", md.IsPosCapture(i), md.Capture(i)))
+		}
+		buf = append(buf, strings.Join(caps, ","))
+	}
+	return strings.Join(buf, "|")
+}
+
+var findTests = []struct {
+	pattern string
+	src     string
+}{
+	{"a", "banana"},
+	{"an*", "banana"},
+	{"(an)+", "banana"},
+	{"^b(.-)a$", "banana"},
+	{"(%w+)=(%w+)", "k1=v1, k2=v2"},
+	{"%s*(%d+)%s*", "  12  345 6"},
+	{"()a()", "banana"},
+	{"%b()", "f(a(b)c) (d)"},
+	{"(a)%1", "xaayaa"},
+	{"[%a_][%w_]*", "local foo_1 = bar2"},
+	{"[^%s]+$", "a b c"},
+	{"x?y-z", "xyyz yz z"},
+	{"", "abc"},
+}
+
+func TestFindMatchesRecursiveVM(t *testing.T) {
+	for _, test := range findTests {
+		expected := dumpMatches(recursiveFind(test.pattern, []byte(test.src), 0, -1))
+		mds, err := Find(test.pattern, []byte(test.src), 0, -1)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", test.pattern, err)
+			continue
+		}
+		if got := dumpMatches(mds); got != expected {
+			t.Errorf("%q on %q: expected %s, but got %s", test.pattern, test.src, expected, got)
+		}
+	}
+}
+
+func TestFindLongSubject(t *testing.T) {
+	src := []byte(strings.Repeat("a", 1000000) + "b")
+	mds, err := Find("^a-b", src, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mds) != 1 || mds[0].Capture(1) != len(src) {
+		t.Errorf("expected a single match of the whole subject, but got %s", dumpMatches(mds))
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, p := range []string{"(a", "a)", "[a", "%1", strings.Repeat("(", MaxCaptures+1)} {
+		if _, err := Find(p, []byte("aaa"), 0, -1); err == nil {
+			t.Errorf("%q: error expected", p)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	c := NewCache(2)
+	p1, _ := c.Compile("a+")
+	c.Compile("b+")
+	if p, _ := c.Compile("a+"); p != p1 {
+		t.Errorf("cached pattern expected")
+	}
+	c.Compile("c+")
+	if c.Len() != 2 {
+		t.Errorf("2 cached patterns expected, but got %d", c.Len())
+	}
+	if _, ok := c.items["b+"]; ok {
+		t.Errorf("least recently used pattern should be evicted")
+	}
+	if _, err := c.Compile("(x"); err == nil || c.Len() != 2 {
+		t.Errorf("invalid pattern should not be cached")
+	}
+}
+
+var benchSubject = []byte(strings.Repeat("key_1 = value1, other = 22; ", 40))
+
+const benchPattern = "(%w+)%s*=%s*(%w+)"
+
+func BenchmarkRecursiveFind(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		recursiveFind(benchPattern, benchSubject, 0, -1)
+	}
+}
+
+func BenchmarkFind(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Find(benchPattern, benchSubject, 0, -1)
+	}
+}
+
+func BenchmarkCachedPatternFind(b *testing.B) {
+	c := NewCache(16)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		pat, _ := c.Compile(benchPattern)
+		pat.Find(benchSubject, 0, -1)
+	}
+}
@@ -0,0 +1,178 @@
+package lua
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrPoolClosed is returned by Pool.Get after the pool is closed.
+var ErrPoolClosed = errors.New("pool: closed")
+
+// PoolOptions is a configuration that is used to create a new Pool.
+type PoolOptions struct {
+	// Options used to create the states of the pool.
+	Options Options
+	// Modules are registered in package.preload of every state.
+	Modules map[string]LGFunction
+	// Scripts are run in order when a state is created, after the modules are registered.
+	Scripts []string
+	// Maximum number of idle states kept by the pool. Extra states are closed by Put.
+	// A value of 0 means no limit.
+	MaxSize int
+}
+
+// PoolStats holds the counters of a Pool.
+type PoolStats struct {
+	// Created is the number of states created by the pool.
+	Created uint64
+	// Reused is the number of times Get returned an idle state.
+	Reused uint64
+	// Resets is the number of states reset by Put.
+	Resets uint64
+	// Discarded is the number of states closed by Discard, or by Put because they could not
+	// be reset or because the pool was full.
+	Discarded uint64
+}
+
+// Pool is a set of warmed-up states. It is safe for concurrent use.
+type Pool struct {
+	opts   PoolOptions
+	mu     sync.Mutex
+	idle   []*LState
+	snaps  map[*LState]*Snapshot
+	closed bool
+	stats  PoolStats
+}
+
+func NewPool(opts PoolOptions) *Pool {
+	return &Pool{
+		opts:  opts,
+		snaps: make(map[*LState]*Snapshot),
+	}
+}
+
+func (p *Pool) newState() (*LState, error) {
+	L := NewState(p.opts.Options)
+	for name, loader := range p.opts.Modules {
+		L.PreloadModule(name, loader)
+	}
+	for _, script := range p.opts.Scripts {
+		if err := L.DoString(script); err != nil {
+			L.Close()
+			return nil, err
+		}
+	}
+	L.SetTop(0)
+	snap := L.Snapshot()
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		L.Close()
+		return nil, ErrPoolClosed
+	}
+	p.snaps[L] = snap
+	p.mu.Unlock()
+	atomic.AddUint64(&p.stats.Created, 1)
+	return L, nil
+}
+
+// Get returns an idle state, or creates a new one and runs the warm-up scripts in it.
+// It returns ErrPoolClosed after Close.
+func (p *Pool) Get() (*LState, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrPoolClosed
+	}
+	if n := len(p.idle); n > 0 {
+		L := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		atomic.AddUint64(&p.stats.Reused, 1)
+		return L, nil
+	}
+	p.mu.Unlock()
+	return p.newState()
+}
+
+// Put resets L and returns it to the pool. The global environment is restored to a snapshot
+// taken after the warm-up, the stack is cleared and the context is removed. States that were not created
+// by the pool, that are closed or that were left inside a call by a fatal error are closed.
+func (p *Pool) Put(L *LState) {
+	p.mu.Lock()
+	snap, ok := p.snaps[L]
+	p.mu.Unlock()
+	if !ok || !p.reset(L, snap) {
+		p.Discard(L)
+		return
+	}
+	atomic.AddUint64(&p.stats.Resets, 1)
+
+	p.mu.Lock()
+	if p.closed || (p.opts.MaxSize > 0 && len(p.idle) >= p.opts.MaxSize) {
+		delete(p.snaps, L)
+		p.mu.Unlock()
+		atomic.AddUint64(&p.stats.Discarded, 1)
+		L.Close()
+		return
+	}
+	p.idle = append(p.idle, L)
+	p.mu.Unlock()
+}
+
+func (p *Pool) reset(L *LState, snap *Snapshot) bool {
+	if L.IsClosed() || L.stack.Sp() != 0 {
+		return false
+	}
+	L.RemoveContext()
+	L.reg.SetTop(0)
+
+	L.Restore(snap)
+	return true
+}
+
+// Discard closes L instead of returning it to the pool, for example after a fatal error.
+func (p *Pool) Discard(L *LState) {
+	p.mu.Lock()
+	delete(p.snaps, L)
+	p.mu.Unlock()
+	atomic.AddUint64(&p.stats.Discarded, 1)
+	if !L.IsClosed() {
+		L.Close()
+	}
+}
+
+// Stats returns the counters of the pool.
+func (p *Pool) Stats() PoolStats {
+	return PoolStats{
+		Created:   atomic.LoadUint64(&p.stats.Created),
+		Reused:    atomic.LoadUint64(&p.stats.Reused),
+		Resets:    atomic.LoadUint64(&p.stats.Resets),
+		Discarded: atomic.LoadUint64(&p.stats.Discarded),
+	}
+}
+
+// Len returns the number of idle states.
+func (p *Pool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.idle)
+}
+
+// Close closes the idle states. States returned afterwards by Put are closed as well, and
+// Get fails with ErrPoolClosed.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.closed = true
+	for _, L := range idle {
+		delete(p.snaps, L)
+	}
+	p.mu.Unlock()
+	for _, L := range idle {
+		L.Close()
+	}
+}
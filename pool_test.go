@@ -0,0 +1,85 @@
+package lua
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func newTestPool(maxSize int) *Pool {
+	return NewPool(PoolOptions{
+		Modules: map[string]LGFunction{
+			"answer": func(L *LState) int {
+				L.Push(LNumber(42))
+				return 1
+			},
+		},
+		Scripts: []string{`helper = function(x) return x + require("answer") end`},
+		MaxSize: maxSize,
+	})
+}
+
+func TestPoolGetPut(t *testing.T) {
+	p := newTestPool(1)
+	defer p.Close()
+	L, err := p.Get()
+	errorIfNotNil(t, err)
+	errorIfScriptFail(t, L, `
+    assert(helper(1) == 43)
+    leaked = true
+    print = nil
+    `)
+	L.Push(LNumber(1))
+	L.SetContext(context.Background())
+	p.Put(L)
+	errorIfNotEqual(t, 1, p.Len())
+
+	L2, err := p.Get()
+	errorIfNotNil(t, err)
+	errorIfFalse(t, L == L2, "pooled state expected")
+	errorIfNotEqual(t, 0, L2.GetTop())
+	errorIfFalse(t, L2.Context() == nil, "context should be removed")
+	errorIfScriptFail(t, L2, `
+    assert(leaked == nil)
+    assert(type(print) == "function")
+    assert(helper(0) == 42)
+    `)
+
+	L3, err := p.Get()
+	errorIfNotNil(t, err)
+	p.Put(L2)
+	p.Put(L3)
+	errorIfNotEqual(t, 1, p.Len())
+	errorIfFalse(t, L3.IsClosed(), "state should be closed when the pool is full")
+	errorIfNotEqual(t, PoolStats{Created: 2, Reused: 1, Resets: 3, Discarded: 1}, p.Stats())
+}
+
+func TestPoolDiscard(t *testing.T) {
+	p := newTestPool(0)
+	L, _ := p.Get()
+	p.Discard(L)
+	errorIfFalse(t, L.IsClosed(), "discarded state should be closed")
+	errorIfNotEqual(t, 0, p.Len())
+
+	L, _ = p.Get()
+	L.Close()
+	p.Put(L)
+	errorIfNotEqual(t, 0, p.Len())
+
+	other := NewState()
+	p.Put(other)
+	errorIfFalse(t, other.IsClosed(), "foreign state should be closed")
+	errorIfNotEqual(t, uint64(3), p.Stats().Discarded)
+
+	L, _ = p.Get()
+	p.Close()
+	p.Put(L)
+	errorIfFalse(t, L.IsClosed(), "state put after Close should be closed")
+	_, err := p.Get()
+	errorIfFalse(t, errors.Is(err, ErrPoolClosed), "Get after Close should fail with ErrPoolClosed: %v", err)
+	errorIfNotEqual(t, uint64(3), p.Stats().Created)
+
+	p = NewPool(PoolOptions{Scripts: []string{`error("boom")`}})
+	_, err = p.Get()
+	errorIfNil(t, err)
+}
@@ -0,0 +1,382 @@
+package lua
+
+import (
+	"regexp"
+	"sync"
+)
+
+const lRegexpClass = "REGEXP*"
+
+// ReCacheSize is the maximum number of literal patterns compiled by the re
+// library that are kept per state.
+var ReCacheSize = 256
+
+type reCache struct {
+	mu      sync.Mutex
+	entries map[string]*regexp.Regexp
+}
+
+func (c *reCache) get(pattern string) (*regexp.Regexp, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if re, ok := c.entries[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if c.entries == nil || len(c.entries) >= ReCacheSize {
+		c.entries = make(map[string]*regexp.Regexp)
+	}
+	c.entries[pattern] = re
+	return re, nil
+}
+
+func OpenRe(L *LState) int {
+	mod := L.RegisterModule(ReLibName, reFuncs).(*LTable)
+	mod.RawSetString("gmatch", L.NewClosure(reGmatch, L.NewFunction(reGmatchIter)))
+
+	mt := L.NewTypeMetatable(lRegexpClass)
+	mt.RawSetString("__index", mt)
+	L.SetFuncs(mt, regexpMethods)
+	mt.RawSetString("gmatch", L.NewClosure(regexpGmatch, L.NewFunction(reGmatchIter)))
+	L.Push(mod)
+	return 1
+}
+
+var reFuncs = map[string]LGFunction{
+	"compile": reCompile,
+	"find":    reFind,
+	"gsub":    reGsub,
+	"match":   reMatch,
+	"capture": reCapture,
+	"quote":   reQuote,
+	"split":   reSplit,
+}
+
+var regexpMethods = map[string]LGFunction{
+	"__tostring": regexpToString,
+	"find":       regexpFind,
+	"gsub":       regexpGsub,
+	"match":      regexpMatch,
+	"capture":    regexpCapture,
+	"split":      regexpSplit,
+	"pattern":    regexpPattern,
+}
+
+/* helpers {{{ */
+
+func (ls *LState) compileRegexp(pattern string) (*regexp.Regexp, error) {
+	return ls.G.reCache.get(pattern)
+}
+
+func newRegexp(L *LState, re *regexp.Regexp) *LUserData {
+	ud := L.NewUserData()
+	ud.Value = re
+	L.SetMetatable(ud, L.GetTypeMetatable(lRegexpClass))
+	return ud
+}
+
+// checkRegexp accepts either a compiled regexp or a pattern string at the given index.
+func checkRegexp(L *LState, n int) *regexp.Regexp {
+	switch lv := L.Get(n).(type) {
+	case *LUserData:
+		if re, ok := lv.Value.(*regexp.Regexp); ok {
+			return re
+		}
+	case LString, LNumber:
+		re, err := L.compileRegexp(LVAsString(lv))
+		if err != nil {
+			L.ArgError(n, err.Error())
+		}
+		return re
+	}
+	L.ArgError(n, "regexp expected")
+	return nil
+}
+
+func checkRegexpObj(L *LState) *regexp.Regexp {
+	ud := L.CheckUserData(1)
+	if re, ok := ud.Value.(*regexp.Regexp); ok {
+		return re
+	}
+	L.ArgError(1, "regexp expected")
+	return nil
+}
+
+func reInit(L *LState, str string, n int) int {
+	return luaIndex2StringIndex(str, L.OptInt(n, 1), true)
+}
+
+// pushCaptures pushes the submatches of a match, or the whole match if the regexp
+// has no groups. Unmatched groups are pushed as nil.
+func pushCaptures(L *LState, str string, loc []int) int {
+	if len(loc) == 2 {
+		L.Push(LString(str[loc[0]:loc[1]]))
+		return 1
+	}
+	for i := 2; i < len(loc); i += 2 {
+		if loc[i] < 0 {
+			L.Push(LNil)
+		} else {
+			L.Push(LString(str[loc[i]:loc[i+1]]))
+		}
+	}
+	return len(loc)/2 - 1
+}
+
+/* }}} */
+
+/* re functions {{{ */
+
+func reCompile(L *LState) int {
+	re, err := regexp.Compile(L.CheckString(1))
+	if err != nil {
+		L.Push(LNil)
+		L.Push(LString(err.Error()))
+		return 2
+	}
+	L.Push(newRegexp(L, re))
+	return 1
+}
+
+func reQuote(L *LState) int {
+	L.Push(LString(regexp.QuoteMeta(L.CheckString(1))))
+	return 1
+}
+
+func reFind(L *LState) int {
+	str := L.CheckString(1)
+	return reDoFind(L, checkRegexp(L, 2), str, 3)
+}
+
+func reMatch(L *LState) int {
+	str := L.CheckString(1)
+	return reDoMatch(L, checkRegexp(L, 2), str, 3)
+}
+
+func reCapture(L *LState) int {
+	str := L.CheckString(1)
+	return reDoCapture(L, checkRegexp(L, 2), str, 3)
+}
+
+func reGmatch(L *LState) int {
+	str := L.CheckString(1)
+	return reDoGmatch(L, checkRegexp(L, 2), str)
+}
+
+func reGsub(L *LState) int {
+	str := L.CheckString(1)
+	return reDoGsub(L, checkRegexp(L, 2), str, 3)
+}
+
+func reSplit(L *LState) int {
+	str := L.CheckString(1)
+	return reDoSplit(L, checkRegexp(L, 2), str, 3)
+}
+
+/* }}} */
+
+/* regexp methods {{{ */
+
+func regexpToString(L *LState) int {
+	L.Push(LString("regexp: " + checkRegexpObj(L).String()))
+	return 1
+}
+
+func regexpPattern(L *LState) int {
+	L.Push(LString(checkRegexpObj(L).String()))
+	return 1
+}
+
+func regexpFind(L *LState) int {
+	re := checkRegexpObj(L)
+	return reDoFind(L, re, L.CheckString(2), 3)
+}
+
+func regexpMatch(L *LState) int {
+	re := checkRegexpObj(L)
+	return reDoMatch(L, re, L.CheckString(2), 3)
+}
+
+func regexpCapture(L *LState) int {
+	re := checkRegexpObj(L)
+	return reDoCapture(L, re, L.CheckString(2), 3)
+}
+
+func regexpGmatch(L *LState) int {
+	re := checkRegexpObj(L)
+	return reDoGmatch(L, re, L.CheckString(2))
+}
+
+func regexpGsub(L *LState) int {
+	re := checkRegexpObj(L)
+	return reDoGsub(L, re, L.CheckString(2), 3)
+}
+
+func regexpSplit(L *LState) int {
+	re := checkRegexpObj(L)
+	return reDoSplit(L, re, L.CheckString(2), 3)
+}
+
+/* }}} */
+
+/* implementations {{{ */
+
+func reDoFind(L *LState, re *regexp.Regexp, str string, n int) int {
+	init := reInit(L, str, n)
+	if init > len(str) {
+		L.Push(LNil)
+		return 1
+	}
+	loc := re.FindStringSubmatchIndex(str[init:])
+	if loc == nil {
+		L.Push(LNil)
+		return 1
+	}
+	L.Push(LNumber(init + loc[0] + 1))
+	L.Push(LNumber(init + loc[1]))
+	nret := 2
+	for i := 2; i < len(loc); i += 2 {
+		if loc[i] < 0 {
+			L.Push(LNil)
+		} else {
+			L.Push(LString(str[init+loc[i] : init+loc[i+1]]))
+		}
+		nret++
+	}
+	return nret
+}
+
+func reDoMatch(L *LState, re *regexp.Regexp, str string, n int) int {
+	init := reInit(L, str, n)
+	if init > len(str) {
+		L.Push(LNil)
+		return 1
+	}
+	loc := re.FindStringSubmatchIndex(str[init:])
+	if loc == nil {
+		L.Push(LNil)
+		return 1
+	}
+	return pushCaptures(L, str[init:], loc)
+}
+
+// reDoCapture returns a table holding the whole match at index 0, every group by
+// position and named groups by name.
+func reDoCapture(L *LState, re *regexp.Regexp, str string, n int) int {
+	init := reInit(L, str, n)
+	if init > len(str) {
+		L.Push(LNil)
+		return 1
+	}
+	sub := str[init:]
+	loc := re.FindStringSubmatchIndex(sub)
+	if loc == nil {
+		L.Push(LNil)
+		return 1
+	}
+	names := re.SubexpNames()
+	tb := L.CreateTable(len(names)-1, 0)
+	for i := 0; i < len(names); i++ {
+		if loc[2*i] < 0 {
+			continue
+		}
+		v := LString(sub[loc[2*i]:loc[2*i+1]])
+		if i == 0 {
+			tb.RawSetH(LNumber(0), v)
+			continue
+		}
+		tb.RawSetInt(i, v)
+		if names[i] != "" {
+			tb.RawSetString(names[i], v)
+		}
+	}
+	L.Push(tb)
+	return 1
+}
+
+type reMatchData struct {
+	str     string
+	pos     int
+	matches [][]int
+}
+
+func reGmatchIter(L *LState) int {
+	md := L.CheckUserData(1).Value.(*reMatchData)
+	if md.pos == len(md.matches) {
+		return 0
+	}
+	loc := md.matches[md.pos]
+	md.pos++
+	return pushCaptures(L, md.str, loc)
+}
+
+func reDoGmatch(L *LState, re *regexp.Regexp, str string) int {
+	L.Push(L.Get(UpvalueIndex(1)))
+	ud := L.NewUserData()
+	ud.Value = &reMatchData{str, 0, re.FindAllStringSubmatchIndex(str, -1)}
+	L.Push(ud)
+	return 2
+}
+
+func reDoGsub(L *LState, re *regexp.Regexp, str string, n int) int {
+	L.CheckTypes(n, LTString, LTNumber, LTTable, LTFunction)
+	repl := L.Get(n)
+	limit := L.OptInt(n+1, -1)
+
+	matches := re.FindAllStringSubmatchIndex(str, limit)
+	if len(matches) == 0 {
+		L.Push(LString(str))
+		L.Push(LNumber(0))
+		return 2
+	}
+
+	buf := make([]byte, 0, len(str))
+	last := 0
+	for _, loc := range matches {
+		buf = append(buf, str[last:loc[0]]...)
+		last = loc[1]
+		switch lv := repl.(type) {
+		case LString, LNumber:
+			buf = re.ExpandString(buf, LVAsString(lv), str, loc)
+		case *LTable:
+			key := str[loc[0]:loc[1]]
+			if len(loc) > 2 && loc[2] >= 0 {
+				key = str[loc[2]:loc[3]]
+			}
+			value := L.GetField(lv, key)
+			if LVIsFalse(value) {
+				buf = append(buf, str[loc[0]:loc[1]]...)
+			} else {
+				buf = append(buf, LVAsString(value)...)
+			}
+		case *LFunction:
+			L.Push(lv)
+			L.Call(pushCaptures(L, str, loc), 1)
+			value := L.reg.Pop()
+			if LVIsFalse(value) {
+				buf = append(buf, str[loc[0]:loc[1]]...)
+			} else {
+				buf = append(buf, LVAsString(value)...)
+			}
+		}
+	}
+	buf = append(buf, str[last:]...)
+	L.Push(LString(string(buf)))
+	L.Push(LNumber(len(matches)))
+	return 2
+}
+
+func reDoSplit(L *LState, re *regexp.Regexp, str string, n int) int {
+	parts := re.Split(str, L.OptInt(n, -1))
+	tb := L.CreateTable(len(parts), 0)
+	for _, part := range parts {
+		tb.Append(LString(part))
+	}
+	L.Push(tb)
+	return 1
+}
+
+/* }}} */
@@ -0,0 +1,180 @@
+package lua
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// loRecordFile records the file a module was loaded from, so that a ModuleWatcher can
+// reload the module when the file changes.
+func loRecordFile(L *LState, name string, extra LValue) {
+	path, ok := extra.(LString)
+	if !ok {
+		return
+	}
+	reg := L.G.Registry
+	files, ok := reg.RawGetString("_MODFILES").(*LTable)
+	if !ok {
+		files = L.NewTable()
+		reg.RawSetString("_MODFILES", files)
+	}
+	files.RawSetString(name, path)
+}
+
+// ReloadModule runs the chunk of a module loaded by require again and replaces the module in
+// package.loaded. If both the old and the new module are tables, the contents and the
+// metatable of the new table are moved into the old one, so that references held elsewhere
+// see the new functions. Then the __reload field of the module, if it is a function, is called
+// with the module and a table holding its previous contents.
+//
+// If the module can not be loaded, or if __reload raises an error, the old module is left in
+// place and the error is returned.
+func (ls *LState) ReloadModule(name string) error {
+	loaded, ok := ls.G.Registry.RawGetString("_LOADED").(*LTable)
+	if !ok {
+		return newApiErrorS(ApiErrorRun, "package.loaded must be a table")
+	}
+	old := loaded.RawGetString(name)
+	if old == LNil || old == loopdetection {
+		return newApiErrorS(ApiErrorRun, "module "+name+" is not loaded")
+	}
+
+	top := ls.GetTop()
+	defer ls.SetTop(top)
+	ls.Push(ls.NewFunction(func(L *LState) int {
+		loader, extra := loFindLoader(L, name)
+		L.Push(loader)
+		L.Push(LString(name))
+		L.Push(extra)
+		L.Call(2, 1)
+		loRecordFile(L, name, extra)
+		return 1
+	}))
+	err := ls.PCall(0, 1, nil)
+	current := loaded.RawGetString(name)
+	loaded.RawSetString(name, old)
+	if err != nil {
+		return err
+	}
+	mod := ls.Get(-1)
+	if mod == LNil {
+		mod = current
+		if mod == old {
+			mod = LTrue
+		}
+	}
+
+	prev := LValue(LNil)
+	oldtb, ok1 := old.(*LTable)
+	newtb, ok2 := mod.(*LTable)
+	if ok1 && ok2 && oldtb != newtb {
+		backup := newTableSnapshot(oldtb)
+		newTableSnapshot(newtb).restore(oldtb)
+		prevtb := ls.NewTable()
+		backup.restore(prevtb)
+		prev = prevtb
+		mod = oldtb
+		defer func() {
+			if err != nil {
+				backup.restore(oldtb)
+			}
+		}()
+	}
+	loaded.RawSetString(name, mod)
+
+	ls.Push(ls.NewFunction(func(L *LState) int {
+		if hook, ok := L.GetField(mod, "__reload").(*LFunction); ok {
+			L.Push(hook)
+			L.Push(mod)
+			L.Push(prev)
+			L.Call(2, 0)
+		}
+		return 0
+	}))
+	if err = ls.PCall(0, 0, nil); err != nil {
+		loaded.RawSetString(name, old)
+	}
+	return err
+}
+
+// ModuleWatcher reloads the modules whose file changed since they were loaded by require. It
+// polls the files of the modules, as found by the searchers, in Options.FS or the OS
+// filesystem. Like the state it watches, a ModuleWatcher is not safe for concurrent use.
+type ModuleWatcher struct {
+	L     *LState
+	files map[string]watchedFile
+}
+
+type watchedFile struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+// NewModuleWatcher returns a watcher for the modules loaded by require in the state.
+func (ls *LState) NewModuleWatcher() *ModuleWatcher {
+	w := &ModuleWatcher{L: ls, files: make(map[string]watchedFile)}
+	w.Check()
+	return w
+}
+
+// Check reloads the modules whose file was modified since the previous check, and returns
+// their names. Modules loaded since the previous check are only recorded. If some reloads
+// fail, Check goes on with the other modules and returns the first error.
+func (w *ModuleWatcher) Check() ([]string, error) {
+	files, ok := w.L.G.Registry.RawGetString("_MODFILES").(*LTable)
+	if !ok {
+		return nil, nil
+	}
+	names := []string{}
+	files.ForEach(func(key, value LValue) {
+		if _, ok := value.(LString); ok {
+			names = append(names, key.String())
+		}
+	})
+	sort.Strings(names)
+
+	var reloaded []string
+	var firstErr error
+	for _, name := range names {
+		path := files.RawGetString(name).String()
+		info, err := w.L.statFS(path)
+		if err != nil {
+			continue
+		}
+		cur := watchedFile{path: path, modTime: info.ModTime(), size: info.Size()}
+		prev, seen := w.files[name]
+		w.files[name] = cur
+		if !seen || prev == cur {
+			continue
+		}
+		if err := w.L.ReloadModule(name); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		reloaded = append(reloaded, name)
+	}
+	return reloaded, firstErr
+}
+
+// Watch calls Check every interval until ctx is done, and passes the result of each check
+// that reloaded a module or failed to onCheck, which may be nil. Watch blocks and must be
+// called from the goroutine that uses the state.
+func (w *ModuleWatcher) Watch(ctx context.Context, interval time.Duration, onCheck func(reloaded []string, err error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			reloaded, err := w.Check()
+			if onCheck != nil && (len(reloaded) > 0 || err != nil) {
+				onCheck(reloaded, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package lua
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReloadModule(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rules.lua")
+	write := func(src string, mtime time.Time) {
+		errorIfNotNil(t, os.WriteFile(path, []byte(src), 0600))
+		errorIfNotNil(t, os.Chtimes(path, mtime, mtime))
+	}
+	now := time.Now()
+	write(`
+    local M = {version = 1, hits = 0}
+    function M.check(x) return x > 10 end
+    return M
+    `, now)
+
+	L := NewState()
+	defer L.Close()
+	L.SetField(L.GetField(L.Get(GlobalsIndex), "package"), "path", LString(filepath.Join(dir, "?.lua")))
+	errorIfScriptFail(t, L, `
+    rules = require("rules")
+    check = rules.check
+    rules.hits = 5
+    `)
+	w := L.NewModuleWatcher()
+	reloaded, err := w.Check()
+	errorIfNotNil(t, err)
+	errorIfNotEqual(t, 0, len(reloaded))
+
+	write(`
+    local M = {version = 2}
+    function M.check(x) return x > 20 end
+    function M.__reload(mod, prev) mod.hits = prev.hits; mod.previous = prev.version end
+    return M
+    `, now.Add(time.Second))
+	reloaded, err = w.Check()
+	errorIfNotNil(t, err)
+	errorIfNotEqual(t, "rules", strings.Join(reloaded, ","))
+	errorIfScriptFail(t, L, `
+    assert(require("rules") == rules)
+    assert(rules.version == 2 and rules.previous == 1 and rules.hits == 5)
+    assert(rules.check(15) == false and check(15) == true)
+    `)
+
+	write(`return {`, now.Add(2*time.Second))
+	_, err = w.Check()
+	errorIfNil(t, err)
+	errorIfScriptFail(t, L, `assert(require("rules") == rules and rules.version == 2)`)
+
+	write(`
+    local M = {version = 3}
+    function M.__reload() error("migration failed") end
+    return M
+    `, now.Add(3*time.Second))
+	errorIfScriptFail(t, L, `
+    local ok, err = package.reload("rules")
+    assert(not ok and string.find(err, "migration failed", 1, true))
+    assert(rules.version == 2 and rules.__reload ~= nil)
+    `)
+
+	errorIfNil(t, L.ReloadModule("unknown"))
+}
@@ -0,0 +1,321 @@
+package lua
+
+import (
+	"container/heap"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrSchedulerBlocked is returned by Scheduler.Run when tasks remain but none of them can be
+// woken up: no task is ready, no timer is pending and no Waker is outstanding.
+var ErrSchedulerBlocked = errors.New("sched: all tasks are blocked")
+
+// Scheduler runs many coroutines of a state on a single loop. Tasks are parked while they
+// sleep, wait on a channel, join another task or wait for a rock, and are resumed by Run
+// when they are woken up.
+//
+// A Scheduler is not safe for concurrent use, except for Waker.Wake which may be called from
+// any goroutine.
+type Scheduler struct {
+	L       *LState
+	ready   []*SchedTask
+	timers  schedTimers
+	seq     uint64
+	live    int
+	pending int
+	running bool
+	current *SchedTask
+	failed  []*SchedTask
+	stop    chan struct{}
+
+	// now and newTimer are the clock of the timers. Tests replace them with a fake clock.
+	now      func() time.Time
+	newTimer func(d time.Duration) (c <-chan time.Time, stop func() bool)
+
+	mu     sync.Mutex
+	woken  []*SchedTask
+	signal chan struct{}
+}
+
+// SchedTask is a coroutine run by a Scheduler.
+type SchedTask struct {
+	s       *Scheduler
+	th      *LState
+	fn      *LFunction
+	args    []LValue
+	parked  bool
+	done    bool
+	joined  bool
+	results []LValue
+	err     error
+	joiners []*SchedTask
+}
+
+// Waker wakes up a task parked by Scheduler.Park.
+type Waker struct {
+	t    *SchedTask
+	once sync.Once
+}
+
+type schedTimer struct {
+	when time.Time
+	seq  uint64
+	t    *SchedTask
+}
+
+type schedTimers []schedTimer
+
+func (h schedTimers) Len() int { return len(h) }
+func (h schedTimers) Less(i, j int) bool {
+	if h[i].when.Equal(h[j].when) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].when.Before(h[j].when)
+}
+func (h schedTimers) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *schedTimers) Push(x interface{}) { *h = append(*h, x.(schedTimer)) }
+func (h *schedTimers) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// Scheduler returns the scheduler of the state, creating it on first use. Coroutines of a
+// state share its scheduler, which resumes tasks from the main thread.
+func (ls *LState) Scheduler() *Scheduler {
+	if ls.G.sched == nil {
+		main := ls.G.MainThread
+		if main == nil {
+			main = ls
+		}
+		ls.G.sched = &Scheduler{
+			L:        main,
+			signal:   make(chan struct{}, 1),
+			now:      time.Now,
+			newTimer: newRealTimer,
+		}
+	}
+	return ls.G.sched
+}
+
+func newRealTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	timer := time.NewTimer(d)
+	return timer.C, timer.Stop
+}
+
+// Spawn creates a task that calls fn with args. The task starts when Run resumes it.
+func (s *Scheduler) Spawn(fn *LFunction, args ...LValue) *SchedTask {
+	th, _ := s.L.NewThread()
+	t := &SchedTask{s: s, th: th, fn: fn, args: args}
+	s.live++
+	s.ready = append(s.ready, t)
+	return t
+}
+
+// Current returns the task that is running, or nil.
+func (s *Scheduler) Current() *SchedTask {
+	return s.current
+}
+
+// checkCurrent returns the running task if it runs in L.
+func (s *Scheduler) checkCurrent(L *LState) *SchedTask {
+	if s.current == nil || s.current.th != L {
+		L.RaiseError("sched: not called from a running task")
+	}
+	return s.current
+}
+
+// Park parks the task running in L until the returned Waker is woken up. It must be called
+// by a Go function running in the task, which then returns L.Yield(); the values passed to
+// Wake become the results of that function. Park raises an error if L is not a running task.
+func (s *Scheduler) Park(L *LState) *Waker {
+	t := s.checkCurrent(L)
+	t.parked = true
+	s.pending++
+	return &Waker{t: t}
+}
+
+// Wake makes the parked task ready to be resumed with values. It is safe to call Wake from any
+// goroutine; only the first call has an effect.
+func (w *Waker) Wake(values ...LValue) {
+	w.once.Do(func() {
+		s := w.t.s
+		s.mu.Lock()
+		w.t.args = values
+		s.woken = append(s.woken, w.t)
+		s.mu.Unlock()
+		select {
+		case s.signal <- struct{}{}:
+		default:
+		}
+	})
+}
+
+// Sleep parks the task running in L for d. Like Park, it must be followed by L.Yield().
+func (s *Scheduler) Sleep(L *LState, d time.Duration) {
+	t := s.checkCurrent(L)
+	t.parked = true
+	t.args = nil
+	s.seq++
+	heap.Push(&s.timers, schedTimer{when: s.now().Add(d), seq: s.seq, t: t})
+}
+
+// Join parks the task running in L until t finishes, unless it already has. It returns
+// false if the task was parked, in which case it must be followed by L.Yield() and the task
+// is resumed with the results of Join. It returns true if t is done.
+func (s *Scheduler) Join(L *LState, t *SchedTask) bool {
+	if t.done {
+		t.joined = true
+		return true
+	}
+	cur := s.checkCurrent(L)
+	if cur == t {
+		L.RaiseError("sched: a task can not join itself")
+	}
+	t.joined = true
+	cur.parked = true
+	t.joiners = append(t.joiners, cur)
+	return false
+}
+
+// Run resumes the ready tasks until every task is done. It returns the context error if the
+// context of the state is done, ErrSchedulerBlocked if the remaining tasks can not be woken
+// up, or else the error of the first task that failed and was not joined.
+func (s *Scheduler) Run() error {
+	if s.running {
+		return errors.New("sched: the scheduler is already running")
+	}
+	s.running = true
+	s.stop = make(chan struct{})
+	defer func() {
+		close(s.stop)
+		s.running = false
+		s.failed = nil
+	}()
+
+	for s.live > 0 {
+		s.collect()
+		if len(s.ready) > 0 {
+			t := s.ready[0]
+			s.ready[0] = nil
+			s.ready = s.ready[1:]
+			s.resume(t)
+			continue
+		}
+		if len(s.timers) == 0 && s.pending == 0 {
+			return ErrSchedulerBlocked
+		}
+		if err := s.wait(); err != nil {
+			return err
+		}
+	}
+	for _, t := range s.failed {
+		if !t.joined {
+			return t.err
+		}
+	}
+	return nil
+}
+
+// wait waits until a task is woken up, the next timer expires or the context of the state is done.
+func (s *Scheduler) wait() error {
+	var timeout <-chan time.Time
+	if len(s.timers) > 0 {
+		c, stop := s.newTimer(s.timers[0].when.Sub(s.now()))
+		defer stop()
+		timeout = c
+	}
+	var done <-chan struct{}
+	ctx := s.L.Context()
+	if ctx != nil {
+		done = ctx.Done()
+	}
+	select {
+	case <-s.signal:
+	case <-timeout:
+	case <-done:
+		return ctx.Err()
+	}
+	return nil
+}
+
+// collect makes the woken tasks and the tasks whose timer expired ready.
+func (s *Scheduler) collect() {
+	s.mu.Lock()
+	woken := s.woken
+	s.woken = nil
+	s.mu.Unlock()
+	for _, t := range woken {
+		s.pending--
+		t.parked = false
+		s.ready = append(s.ready, t)
+	}
+	now := s.now()
+	for len(s.timers) > 0 && !s.timers[0].when.After(now) {
+		t := heap.Pop(&s.timers).(schedTimer).t
+		t.parked = false
+		s.ready = append(s.ready, t)
+	}
+}
+
+func (s *Scheduler) resume(t *SchedTask) {
+	args := t.args
+	t.args = nil
+	s.current = t
+	st, err, values := s.L.Resume(t.th, t.fn, args...)
+	s.current = nil
+	switch st {
+	case ResumeYield:
+		if !t.parked {
+			// the task yielded without being parked, it goes on on the next turn
+			s.ready = append(s.ready, t)
+		}
+		return
+	case ResumeOK:
+		t.results = values
+		t.finish(append([]LValue{LTrue}, values...))
+	case ResumeError:
+		t.err = err
+		s.failed = append(s.failed, t)
+		obj := LValue(LString(err.Error()))
+		if aerr, ok := err.(*ApiError); ok {
+			obj = aerr.Object
+		}
+		t.finish([]LValue{LFalse, obj})
+	}
+}
+
+// finish wakes up the tasks joining t with values.
+func (t *SchedTask) finish(values []LValue) {
+	t.done = true
+	t.s.live--
+	for _, j := range t.joiners {
+		j.parked = false
+		j.args = values
+		t.s.ready = append(t.s.ready, j)
+	}
+	t.joiners = nil
+}
+
+// Done reports whether the task has finished.
+func (t *SchedTask) Done() bool {
+	return t.done
+}
+
+// Results returns the values returned by the function of a finished task.
+func (t *SchedTask) Results() []LValue {
+	return t.results
+}
+
+// Err returns the error raised by the function of a finished task.
+func (t *SchedTask) Err() error {
+	return t.err
+}
+
+// Thread returns the coroutine the task runs in.
+func (t *SchedTask) Thread() *LState {
+	return t.th
+}
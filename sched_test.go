@@ -0,0 +1,159 @@
+package lua
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// useFakeClock makes the timers of the scheduler of L run on a fake clock, which moves
+// straight to the next timer when the scheduler waits.
+func useFakeClock(L *LState) {
+	s := L.Scheduler()
+	clock := time.Unix(0, 0)
+	s.now = func() time.Time { return clock }
+	s.newTimer = func(d time.Duration) (<-chan time.Time, func() bool) {
+		clock = clock.Add(d)
+		c := make(chan time.Time, 1)
+		c <- clock
+		return c, func() bool { return false }
+	}
+}
+
+func TestSchedSpawnAndSleep(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	useFakeClock(L)
+	errorIfScriptFail(t, L, `
+    local order = {}
+    local tasks = {}
+    for i = 1, 100 do
+      tasks[i] = sched.spawn(function(n)
+        sched.sleep((100 - n) / 10000)
+        table.insert(order, n)
+        sched.yield()
+        return n * 2
+      end, i)
+    end
+    local sum = 0
+    local main = sched.spawn(function()
+      for i = 1, 100 do
+        local ok, v = sched.join(tasks[i])
+        assert(ok)
+        sum = sum + v
+      end
+      return sum
+    end)
+    assert(main:status() == "ready")
+    assert(sched.run())
+    assert(main:status() == "done")
+    assert(#order == 100 and order[1] == 100 and order[100] == 1)
+    assert(sum == 10100)
+    assert(select(2, main:join()) == 10100)
+
+    local tk = sched.spawn(function()
+      return pcall(function() sched.sleep(0.01); return string.format("%d", 5) end)
+    end)
+    assert(sched.run())
+    assert(tk:status() == "done")
+    local ok, pok, v = tk:join()
+    assert(ok and pok and v == "5")
+    `)
+	errorIfScriptNotFail(t, L, `sched.sleep(1)`, "not called from a running task")
+}
+
+func TestSchedWait(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	ch := make(chan LValue)
+	L.SetGlobal("ch", LChannel(ch))
+	go func() {
+		for i := 1; i <= 3; i++ {
+			ch <- LNumber(i)
+		}
+		close(ch)
+	}()
+	errorIfScriptFail(t, L, `
+    local got = {}
+    local tk = sched.spawn(function()
+      while true do
+        local ok, v, reason = sched.wait(ch)
+        if not ok then return reason end
+        table.insert(got, v)
+      end
+    end)
+    local idle = sched.spawn(function()
+      local tm = channel.make()
+      return select(3, sched.wait(tm, 0.01))
+    end)
+    assert(sched.run())
+    assert(#got == 3 and got[3] == 3)
+    assert(select(2, tk:join()) == "closed")
+    assert(select(2, idle:join()) == "timeout")
+    `)
+}
+
+func TestSchedErrors(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	errorIfScriptFail(t, L, `
+    local tk = sched.spawn(function() error("boom") end)
+    local res
+    sched.spawn(function() res = {sched.join(tk)} end)
+    assert(sched.run())
+    assert(res[1] == false and string.find(res[2], "boom", 1, true))
+    assert(tk:status() == "failed")
+
+    sched.spawn(function() error("unjoined") end)
+    local ok, err = sched.run()
+    assert(ok == false and string.find(err, "unjoined", 1, true))
+    `)
+	errorIfScriptNotFail(t, L, `
+    local tk
+    tk = sched.spawn(function() sched.join(tk) end)
+    local ok, err = sched.run()
+    error(err)
+    `, "can not join itself")
+}
+
+func TestSchedWaker(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	s := L.Scheduler()
+	L.SetGlobal("fetch", L.NewFunction(func(L *LState) int {
+		w := s.Park(L)
+		key := L.CheckString(1)
+		go func() {
+			time.Sleep(time.Millisecond)
+			w.Wake(LString("value of " + key))
+			w.Wake(LString("ignored"))
+		}()
+		return L.Yield()
+	}))
+	errorIfScriptFail(t, L, `
+    function work() return fetch("a") .. ", " .. fetch("b") end
+    `)
+	tk := s.Spawn(L.GetGlobal("work").(*LFunction))
+	errorIfNotNil(t, s.Run())
+	errorIfFalse(t, tk.Done(), "task must be done")
+	errorIfNotEqual(t, LString("value of a, value of b"), tk.Results()[0])
+
+	errorIfScriptFail(t, L, `
+    local a, b
+    a = sched.spawn(function() sched.join(b) end)
+    b = sched.spawn(function() sched.join(a) end)
+    `)
+	errorIfNotEqual(t, ErrSchedulerBlocked, s.Run())
+}
+
+func TestSchedContext(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	L.SetContext(ctx)
+	s := L.Scheduler()
+	errorIfScriptFail(t, L, `function forever() sched.wait(channel.make()) end`)
+	s.Spawn(L.GetGlobal("forever").(*LFunction))
+	errorIfNotEqual(t, context.DeadlineExceeded, s.Run())
+}
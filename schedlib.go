@@ -0,0 +1,156 @@
+package lua
+
+import (
+	"time"
+)
+
+const lSchedTaskClass = "SCHEDTASK*"
+
+func OpenSched(L *LState) int {
+	mod := L.RegisterModule(SchedLibName, schedFuncs)
+	mt := L.NewTypeMetatable(lSchedTaskClass)
+	mt.RawSetString("__index", mt)
+	L.SetFuncs(mt, schedTaskMethods)
+	L.Push(mod)
+	return 1
+}
+
+var schedFuncs = map[string]LGFunction{
+	"spawn": schedSpawn,
+	"sleep": schedSleep,
+	"wait":  schedWait,
+	"join":  schedJoin,
+	"yield": schedYield,
+	"run":   schedRun,
+}
+
+var schedTaskMethods = map[string]LGFunction{
+	"join":   schedJoin,
+	"status": schedTaskStatus,
+}
+
+func checkSchedTask(L *LState, n int) *SchedTask {
+	ud := L.CheckUserData(n)
+	if t, ok := ud.Value.(*SchedTask); ok {
+		return t
+	}
+	L.ArgError(n, "sched task expected")
+	return nil
+}
+
+// pushSchedResults pushes true and the results of a finished task, or false and its error.
+func pushSchedResults(L *LState, t *SchedTask) int {
+	if t.err != nil {
+		L.Push(LFalse)
+		if aerr, ok := t.err.(*ApiError); ok {
+			L.Push(aerr.Object)
+		} else {
+			L.Push(LString(t.err.Error()))
+		}
+		return 2
+	}
+	L.Push(LTrue)
+	for _, v := range t.results {
+		L.Push(v)
+	}
+	return 1 + len(t.results)
+}
+
+func schedSpawn(L *LState) int {
+	fn := L.CheckFunction(1)
+	top := L.GetTop()
+	args := make([]LValue, 0, top-1)
+	for i := 2; i <= top; i++ {
+		args = append(args, L.Get(i))
+	}
+	t := L.Scheduler().Spawn(fn, args...)
+	ud := L.NewUserData()
+	ud.Value = t
+	L.SetMetatable(ud, L.GetTypeMetatable(lSchedTaskClass))
+	L.Push(ud)
+	return 1
+}
+
+func schedSleep(L *LState) int {
+	sec := float64(L.CheckNumber(1))
+	if sec < 0 {
+		sec = 0
+	}
+	L.Scheduler().Sleep(L, time.Duration(sec*float64(time.Second)))
+	return L.Yield()
+}
+
+func schedWait(L *LState) int {
+	ch := L.CheckChannel(1)
+	timeout := channelTimeout(L, 2)
+	s := L.Scheduler()
+	w := s.Park(L)
+	stop := s.stop
+	go func() {
+		var expired <-chan time.Time
+		if timeout >= 0 {
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+			expired = timer.C
+		}
+		select {
+		case v, ok := <-ch:
+			if ok {
+				w.Wake(LTrue, v)
+			} else {
+				w.Wake(LFalse, LNil, LString("closed"))
+			}
+		case <-expired:
+			w.Wake(LFalse, LNil, LString("timeout"))
+		case <-stop:
+			w.Wake(LFalse, LNil, LString("stopped"))
+		}
+	}()
+	return L.Yield()
+}
+
+func schedJoin(L *LState) int {
+	t := checkSchedTask(L, 1)
+	if L.Scheduler().Join(L, t) {
+		return pushSchedResults(L, t)
+	}
+	return L.Yield()
+}
+
+func schedYield(L *LState) int {
+	L.Scheduler().checkCurrent(L)
+	return L.Yield()
+}
+
+func schedRun(L *LState) int {
+	s := L.Scheduler()
+	if L != s.L {
+		L.RaiseError("sched.run must be called from the main thread")
+	}
+	if err := s.Run(); err != nil {
+		L.Push(LFalse)
+		if aerr, ok := err.(*ApiError); ok {
+			L.Push(aerr.Object)
+		} else {
+			L.Push(LString(err.Error()))
+		}
+		return 2
+	}
+	L.Push(LTrue)
+	return 1
+}
+
+func schedTaskStatus(L *LState) int {
+	t := checkSchedTask(L, 1)
+	switch {
+	case t.err != nil:
+		L.Push(LString("failed"))
+	case t.done:
+		L.Push(LString("done"))
+	case t.parked:
+		L.Push(LString("parked"))
+	default:
+		L.Push(LString("ready"))
+	}
+	return 1
+}
@@ -0,0 +1,105 @@
+package lua
+
+// Snapshot is the state of the global environment of an LState at some point. It is created
+// by LState.Snapshot and applied by LState.Restore.
+type Snapshot struct {
+	g          *Global
+	tables     map[*LTable]*tableSnapshot
+	builtinMts map[int]LValue
+}
+
+type tableSnapshot struct {
+	metatable LValue
+	frozen    bool
+	keys      []LValue
+	values    []LValue
+}
+
+// Snapshot captures the global environment: the globals table, the registry (which holds
+// package.loaded and the type metatables), the metatables of builtin types and every table
+// reachable from them through keys, values and metatables. Tables are recorded by identity,
+// so a library table such as string keeps its identity and only its contents are restored.
+// Functions and userdata are recorded by reference; their upvalues and values are not.
+func (ls *LState) Snapshot() *Snapshot {
+	snap := &Snapshot{
+		g:          ls.G,
+		tables:     make(map[*LTable]*tableSnapshot),
+		builtinMts: make(map[int]LValue, len(ls.G.builtinMts)),
+	}
+	for typ, mt := range ls.G.builtinMts {
+		snap.builtinMts[typ] = mt
+	}
+
+	pending := []*LTable{ls.G.Global, ls.G.Registry}
+	visit := func(lv LValue) {
+		if tb, ok := lv.(*LTable); ok {
+			if _, seen := snap.tables[tb]; !seen {
+				pending = append(pending, tb)
+			}
+		}
+	}
+	for _, mt := range ls.G.builtinMts {
+		visit(mt)
+	}
+	for len(pending) > 0 {
+		tb := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if _, seen := snap.tables[tb]; seen {
+			continue
+		}
+		ts := newTableSnapshot(tb)
+		snap.tables[tb] = ts
+		visit(tb.Metatable)
+		for i, key := range ts.keys {
+			visit(key)
+			visit(ts.values[i])
+		}
+	}
+	return snap
+}
+
+// Restore reverts the global environment to a snapshot taken by Snapshot on a state that
+// shares the same Global. Globals, modules in package.loaded and builtin metatables added
+// since are removed, and the contents and metatables of the recorded tables are restored.
+func (ls *LState) Restore(snap *Snapshot) {
+	if snap.g != ls.G {
+		ls.RaiseError("can not restore a snapshot of another state")
+	}
+	for tb, ts := range snap.tables {
+		ts.restore(tb)
+	}
+	for typ := range ls.G.builtinMts {
+		if _, ok := snap.builtinMts[typ]; !ok {
+			delete(ls.G.builtinMts, typ)
+		}
+	}
+	for typ, mt := range snap.builtinMts {
+		ls.G.builtinMts[typ] = mt
+	}
+}
+
+func newTableSnapshot(tb *LTable) *tableSnapshot {
+	ts := &tableSnapshot{metatable: tb.Metatable, frozen: tb.frozen}
+	tb.ForEach(func(key, value LValue) {
+		ts.keys = append(ts.keys, key)
+		ts.values = append(ts.values, value)
+	})
+	return ts
+}
+
+// restore replaces the contents, the metatable and the frozen flag of tb by the recorded ones.
+func (ts *tableSnapshot) restore(tb *LTable) {
+	tb.frozen = false
+	keys := make([]LValue, 0, len(ts.keys))
+	tb.ForEach(func(key, _ LValue) {
+		keys = append(keys, key)
+	})
+	for _, key := range keys {
+		tb.RawSet(key, LNil)
+	}
+	for i, key := range ts.keys {
+		tb.RawSet(key, ts.values[i])
+	}
+	tb.Metatable = ts.metatable
+	tb.frozen = ts.frozen
+}
@@ -0,0 +1,47 @@
+package lua
+
+import (
+	"testing"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	errorIfScriptFail(t, L, `
+    config = {name = "app", list = {1, 2}}
+    config.self = config
+    setmetatable(config.list, {__index = function() return 0 end})
+    `)
+	snap := L.Snapshot()
+	stringlib := L.GetGlobal("string")
+	errorIfScriptFail(t, L, `
+    polluted = true
+    config.name = "changed"
+    config.list[3] = 3
+    setmetatable(config.list, nil)
+    config = {}
+    string.upper = function() return "patched" end
+    string = nil
+    package.loaded.evil = {}
+    getmetatable("").__index = {len = function() return -1 end}
+    debug.setmetatable(1, {__index = {twice = function(n) return n * 2 end}})
+    `)
+	L.Restore(snap)
+	errorIfNotEqual(t, stringlib, L.GetGlobal("string"))
+	errorIfScriptFail(t, L, `
+    assert(polluted == nil)
+    assert(config.name == "app" and config.self == config)
+    assert(#config.list == 2 and config.list[5] == 0)
+    assert(string.upper("a") == "A")
+    assert(("abc"):len() == 3)
+    assert(package.loaded.evil == nil)
+    assert(getmetatable(1) == nil)
+    `)
+
+	other := NewState()
+	defer other.Close()
+	errorIfGFuncNotFail(t, other, func(L *LState) int {
+		L.Restore(snap)
+		return 0
+	}, "can not restore a snapshot of another state")
+}
@@ -2,6 +2,8 @@ package lua
 
 import (
 	"context"
+	"errors"
+	"io/fs"
 	"strings"
 	"testing"
 	"time"
@@ -376,6 +378,121 @@ func TestCoroutineApi1(t *testing.T) {
 
 }
 
+func TestCoroutineYieldAcrossPCall(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	errorIfScriptFail(t, L, `
+      function coro()
+        local ok, v = pcall(function()
+          return coroutine.yield(1) + 1
+        end)
+        assert(ok)
+        local ok, err = pcall(function()
+          coroutine.yield(v)
+          error("--failed--")
+        end)
+        assert(not ok)
+        return err
+      end
+    `)
+	fn := L.GetGlobal("coro").(*LFunction)
+	co, _ := L.NewThread()
+	st, err, values := L.Resume(co, fn)
+	errorIfNotEqual(t, ResumeYield, st)
+	errorIfNotNil(t, err)
+	errorIfNotEqual(t, LNumber(1), values[0])
+
+	st, err, values = L.Resume(co, fn, LNumber(10))
+	errorIfNotEqual(t, ResumeYield, st)
+	errorIfNotNil(t, err)
+	errorIfNotEqual(t, LNumber(11), values[0])
+
+	st, err, values = L.Resume(co, fn)
+	errorIfNotEqual(t, ResumeOK, st)
+	errorIfNotNil(t, err)
+	errorIfFalse(t, strings.Contains(values[0].String(), "--failed--"), "error message must be '--failed--'")
+}
+
+func TestCoroutineYieldK(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	L.Register("read", func(L *LState) int {
+		name := L.CheckString(1)
+		return L.YieldK(func(L *LState) int {
+			L.Push(LString(name + "=" + L.CheckString(1)))
+			return 1
+		}, LString("read "+name))
+	})
+	L.Register("readtwice", func(L *LState) int {
+		return L.YieldK(func(L *LState) int {
+			first := L.CheckString(1)
+			return L.YieldK(func(L *LState) int {
+				L.Push(LString(first + L.CheckString(1)))
+				return 1
+			}, LString("second"))
+		}, LString("first"))
+	})
+	errorIfScriptFail(t, L, `
+      function coro()
+        local a = read("a")
+        local ok, b = pcall(read, "b")
+        assert(ok)
+        local c = readtwice()
+        return a, b, c
+      end
+    `)
+	fn := L.GetGlobal("coro").(*LFunction)
+	co, _ := L.NewThread()
+	for _, step := range []struct {
+		arg   LValue
+		yield string
+	}{
+		{LNil, "read a"},
+		{LString("1"), "read b"},
+		{LString("2"), "first"},
+		{LString("x"), "second"},
+	} {
+		st, err, values := L.Resume(co, fn, step.arg)
+		errorIfNotEqual(t, ResumeYield, st)
+		errorIfNotNil(t, err)
+		errorIfNotEqual(t, LString(step.yield), values[0])
+	}
+	st, err, values := L.Resume(co, fn, LString("y"))
+	errorIfNotEqual(t, ResumeOK, st)
+	errorIfNotNil(t, err)
+	errorIfNotEqual(t, 3, len(values))
+	errorIfNotEqual(t, LString("a=1"), values[0])
+	errorIfNotEqual(t, LString("b=2"), values[1])
+	errorIfNotEqual(t, LString("xy"), values[2])
+
+	err = L.DoString(`read("main")`)
+	errorIfNil(t, err)
+	errorIfFalse(t, strings.Contains(err.Error(), "can not yield from outside of a coroutine"), "yield outside of a coroutine must fail")
+}
+
+func TestCoroutineWrapTraceback(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	err := L.DoString(`
+      local function inner()
+        error("--failed--")
+      end
+      local co = coroutine.wrap(function()
+        inner()
+      end)
+      local ok, err = pcall(co)
+      assert(not ok)
+      co = coroutine.wrap(function()
+        inner()
+      end)
+      co()
+    `)
+	errorIfNil(t, err)
+	trace := err.(*ApiError).StackTrace
+	errorIfFalse(t, strings.Contains(trace, "function 'inner'"), "traceback of the coroutine expected: %v", trace)
+	errorIfFalse(t, strings.Contains(trace, "main chunk"), "traceback of the caller expected: %v", trace)
+}
+
 func TestContextTimeout(t *testing.T) {
 	L := NewState()
 	defer L.Close()
@@ -452,6 +569,87 @@ func TestContextWithCroutine(t *testing.T) {
 
 }
 
+func TestApiErrorFrames(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	err := L.DoString(`
+    local function inner()
+      error("boom")
+    end
+    function outer()
+      inner()
+    end
+    outer()
+    `)
+	errorIfNil(t, err)
+	aerr := err.(*ApiError)
+	errorIfFalse(t, len(aerr.Frames) >= 4, "expected frames, got %v", aerr.Frames)
+	errorIfNotEqual(t, StackFrame{Source: "[G]", Function: "error"}, aerr.Frames[0])
+	errorIfNotEqual(t, StackFrame{Source: "<string>", Line: 3, Column: 7, Function: "inner"}, aerr.Frames[1])
+	errorIfNotEqual(t, StackFrame{Source: "<string>", Line: 6, Column: 7, Function: "outer"}, aerr.Frames[2])
+	errorIfNotEqual(t, StackFrame{Source: "<string>", Line: 8, Column: 5, Function: "main chunk"}, aerr.Frames[3])
+}
+
+func TestErrorColumns(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	errorIfScriptNotFail(t, L, `
+    local t = {a = {b = {}}}
+    return t.a.b.c.d`, `^<string>:3:20: attempt to index`)
+	errorIfScriptNotFail(t, L, `t = {a = {}}
+t.a.b()`, `^<string>:2:5: attempt to call`)
+	errorIfScriptNotFail(t, L, `error("boom", 1)`, `^<string>:1:1: boom`)
+	errorIfScriptFail(t, L, `
+    local info = debug.getinfo(1, "l")
+    assert(info.currentline == 2 and info.currentcolumn == 24)
+    `)
+}
+
+func TestRaiseErrorWrap(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	L.SetGlobal("open", L.NewFunction(func(L *LState) int {
+		L.RaiseErrorWrap(&fs.PathError{Op: "open", Path: L.CheckString(1), Err: fs.ErrNotExist})
+		return 0
+	}))
+	errorIfScriptFail(t, L, `
+    local ok, err = pcall(open, "a.txt")
+    assert(not ok and type(err) == "userdata")
+    assert(tostring(err) == "<string>:2:21: open a.txt: file does not exist")
+    assert("error: " .. err == "error: " .. tostring(err))
+    `)
+
+	err := L.DoString(`
+    local ok, err = pcall(open, "b.txt")
+    error(err)
+    `)
+	errorIfNil(t, err)
+	errorIfFalse(t, errors.Is(err, fs.ErrNotExist), "error must wrap fs.ErrNotExist")
+	var perr *fs.PathError
+	errorIfFalse(t, errors.As(err, &perr), "error must wrap a *fs.PathError")
+	errorIfNotEqual(t, "b.txt", perr.Path)
+	errorIfFalse(t, strings.HasPrefix(err.Error(), "<string>:2:21: open b.txt: file does not exist\n"), "unexpected message %s", err.Error())
+
+	err = L.CallByParam(P{Fn: L.NewFunction(func(L *LState) int {
+		L.Error(L.NewError(context.Canceled), 1)
+		return 0
+	}), Protect: true})
+	errorIfFalse(t, errors.Is(err, context.Canceled), "error must wrap context.Canceled")
+
+	err = L.DoString(`error("plain")`)
+	errorIfNotNil(t, errors.Unwrap(err))
+}
+
+func TestContextTimeoutError(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	L.SetContext(ctx)
+	err := L.DoString(`while true do end`)
+	errorIfFalse(t, errors.Is(err, context.DeadlineExceeded), "error must wrap context.DeadlineExceeded: %v", err)
+}
+
 func TestPCallAfterFail(t *testing.T) {
 	L := NewState()
 	defer L.Close()
@@ -2,13 +2,28 @@ package lua
 
 import (
 	"fmt"
+	"math"
 	"strings"
+	"unsafe"
 
 	"github.com/edunx/lua/pm"
 )
 
 const emptyLString LString = LString("")
 
+// PatternCacheSize is the number of compiled Lua patterns kept by the string library.
+const PatternCacheSize = 256
+
+var patternCache = pm.NewCache(PatternCacheSize)
+
+func checkPattern(L *LState, pattern string) *pm.Pattern {
+	pat, err := patternCache.Compile(pattern)
+	if err != nil {
+		L.RaiseError(err.Error())
+	}
+	return pat
+}
+
 func OpenString(L *LState) int {
 	var mod *LTable
 	//_, ok := L.G.builtinMts[int(LTString)]
@@ -25,19 +40,22 @@ func OpenString(L *LState) int {
 }
 
 var strFuncs = map[string]LGFunction{
-	"byte":    strByte,
-	"char":    strChar,
-	"dump":    strDump,
-	"find":    strFind,
-	"format":  strFormat,
-	"gsub":    strGsub,
-	"len":     strLen,
-	"lower":   strLower,
-	"match":   strMatch,
-	"rep":     strRep,
-	"reverse": strReverse,
-	"sub":     strSub,
-	"upper":   strUpper,
+	"byte":     strByte,
+	"char":     strChar,
+	"dump":     strDump,
+	"find":     strFind,
+	"format":   strFormat,
+	"gsub":     strGsub,
+	"len":      strLen,
+	"lower":    strLower,
+	"match":    strMatch,
+	"pack":     strPack,
+	"packsize": strPackSize,
+	"rep":      strRep,
+	"reverse":  strReverse,
+	"sub":      strSub,
+	"unpack":   strUnpack,
+	"upper":    strUpper,
 }
 
 func strByte(L *LState) int {
@@ -112,7 +130,7 @@ func strFind(L *LState) int {
 		return 2
 	}
 
-	mds, err := pm.Find(pattern, unsafeFastStringToReadOnlyBytes(str), init, 1)
+	mds, err := checkPattern(L, pattern).Find(unsafeFastStringToReadOnlyBytes(str), init, 1)
 	if err != nil {
 		L.RaiseError(err.Error())
 	}
@@ -152,7 +170,7 @@ func strGsub(L *LState) int {
 	repl := L.CheckAny(3)
 	limit := L.OptInt(4, -1)
 
-	mds, err := pm.Find(pat, unsafeFastStringToReadOnlyBytes(str), 0, limit)
+	mds, err := checkPattern(L, pat).Find(unsafeFastStringToReadOnlyBytes(str), 0, limit)
 	if err != nil {
 		L.RaiseError(err.Error())
 	}
@@ -327,7 +345,7 @@ func strGmatchIter(L *LState) int {
 func strGmatch(L *LState) int {
 	str := L.CheckString(1)
 	pattern := L.CheckString(2)
-	mds, err := pm.Find(pattern, []byte(str), 0, -1)
+	mds, err := checkPattern(L, pattern).Find(unsafeFastStringToReadOnlyBytes(str), 0, -1)
 	if err != nil {
 		L.RaiseError(err.Error())
 	}
@@ -363,7 +381,7 @@ func strMatch(L *LState) int {
 		offset = 0
 	}
 
-	mds, err := pm.Find(pattern, unsafeFastStringToReadOnlyBytes(str), offset, 1)
+	mds, err := checkPattern(L, pattern).Find(unsafeFastStringToReadOnlyBytes(str), offset, 1)
 	if err != nil {
 		L.RaiseError(err.Error())
 	}
@@ -445,4 +463,371 @@ func luaIndex2StringIndex(str string, i int, start bool) int {
 	return i
 }
 
+/* string.pack {{{ */
+
+const packMaxIntSize = 16
+const packNativeAlign = 8
+
+var packNativeLittle = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}()
+
+type packOption int
+
+const (
+	packInt packOption = iota
+	packUint
+	packFloat
+	packDouble
+	packChar
+	packString
+	packZstr
+	packPadding
+	packPaddAlign
+	packNop
+)
+
+type packHeader struct {
+	L        *LState
+	format   string
+	pos      int
+	little   bool
+	maxAlign int
+}
+
+func newPackHeader(L *LState, format string) *packHeader {
+	return &packHeader{L: L, format: format, little: packNativeLittle, maxAlign: 1}
+}
+
+func packIsDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func (h *packHeader) eof() bool {
+	return h.pos >= len(h.format)
+}
+
+func (h *packHeader) readNum(df int) int {
+	if h.eof() || !packIsDigit(h.format[h.pos]) {
+		return df
+	}
+	a := 0
+	for !h.eof() && packIsDigit(h.format[h.pos]) && a <= (math.MaxInt32-9)/10 {
+		a = a*10 + int(h.format[h.pos]-'0')
+		h.pos++
+	}
+	return a
+}
+
+func (h *packHeader) numLimit(df int) int {
+	sz := h.readNum(df)
+	if sz > packMaxIntSize || sz <= 0 {
+		h.L.RaiseError("integral size (%d) out of limits [1,%d]", sz, packMaxIntSize)
+	}
+	return sz
+}
+
+func (h *packHeader) option() (packOption, int) {
+	opt := h.format[h.pos]
+	h.pos++
+	switch opt {
+	case 'b':
+		return packInt, 1
+	case 'B':
+		return packUint, 1
+	case 'h':
+		return packInt, 2
+	case 'H':
+		return packUint, 2
+	case 'l', 'j':
+		return packInt, 8
+	case 'L', 'J', 'T':
+		return packUint, 8
+	case 'f':
+		return packFloat, 4
+	case 'd', 'n':
+		return packDouble, 8
+	case 'i':
+		return packInt, h.numLimit(4)
+	case 'I':
+		return packUint, h.numLimit(4)
+	case 's':
+		return packString, h.numLimit(8)
+	case 'c':
+		size := h.readNum(-1)
+		if size == -1 {
+			h.L.RaiseError("missing size for format option 'c'")
+		}
+		return packChar, size
+	case 'z':
+		return packZstr, 0
+	case 'x':
+		return packPadding, 1
+	case 'X':
+		return packPaddAlign, 0
+	case ' ':
+	case '<':
+		h.little = true
+	case '>':
+		h.little = false
+	case '=':
+		h.little = packNativeLittle
+	case '!':
+		h.maxAlign = h.numLimit(packNativeAlign)
+	default:
+		h.L.RaiseError("invalid format option '%c'", opt)
+	}
+	return packNop, 0
+}
+
+// details reads the next option and returns it with its size and the number of
+// padding bytes needed to align it at the given total size.
+func (h *packHeader) details(total int) (packOption, int, int) {
+	opt, size := h.option()
+	align := size
+	if opt == packPaddAlign {
+		if h.eof() {
+			h.L.RaiseError("invalid next option for option 'X'")
+		}
+		var next packOption
+		next, align = h.option()
+		if next == packChar || align == 0 {
+			h.L.RaiseError("invalid next option for option 'X'")
+		}
+	}
+	if align <= 1 || opt == packChar {
+		return opt, size, 0
+	}
+	if align > h.maxAlign {
+		align = h.maxAlign
+	}
+	if align&(align-1) != 0 {
+		h.L.RaiseError("format asks for alignment not power of 2")
+	}
+	return opt, size, (align - (total & (align - 1))) & (align - 1)
+}
+
+func packInteger(buf []byte, v uint64, little bool, size int, neg bool) []byte {
+	b := make([]byte, size)
+	for i := 0; i < size; i++ {
+		var c byte
+		if i < 8 {
+			c = byte(v >> uint(8*i))
+		} else if neg {
+			c = 0xff
+		}
+		if little {
+			b[i] = c
+		} else {
+			b[size-1-i] = c
+		}
+	}
+	return append(buf, b...)
+}
+
+func unpackInteger(L *LState, str string, little bool, size int, signed bool) LNumber {
+	var v uint64
+	limit := size
+	if limit > 8 {
+		limit = 8
+	}
+	for i := limit - 1; i >= 0; i-- {
+		v <<= 8
+		if little {
+			v |= uint64(str[i])
+		} else {
+			v |= uint64(str[size-1-i])
+		}
+	}
+	if size < 8 {
+		if signed {
+			mask := uint64(1) << uint(size*8-1)
+			v = (v ^ mask) - mask
+		}
+	} else if size > 8 {
+		var mask byte
+		if signed && int64(v) < 0 {
+			mask = 0xff
+		}
+		for i := limit; i < size; i++ {
+			var c byte
+			if little {
+				c = str[i]
+			} else {
+				c = str[size-1-i]
+			}
+			if c != mask {
+				L.RaiseError("%d-byte integer does not fit into Lua Integer", size)
+			}
+		}
+	}
+	if signed {
+		return LNumber(int64(v))
+	}
+	return LNumber(v)
+}
+
+func strPack(L *LState) int {
+	h := newPackHeader(L, L.CheckString(1))
+	buf := make([]byte, 0, len(h.format))
+	arg := 1
+	for !h.eof() {
+		opt, size, ntoalign := h.details(len(buf))
+		for ; ntoalign > 0; ntoalign-- {
+			buf = append(buf, 0)
+		}
+		switch opt {
+		case packInt, packUint:
+			arg++
+			n := L.CheckNumber(arg)
+			if !isInteger(n) {
+				L.ArgError(arg, "number has no integer representation")
+			}
+			var v uint64
+			neg := n < 0
+			if opt == packInt {
+				if size < 8 {
+					lim := int64(1) << uint(size*8-1)
+					if int64(n) < -lim || int64(n) >= lim {
+						L.ArgError(arg, "integer overflow")
+					}
+				}
+				v = uint64(int64(n))
+			} else {
+				if size < 8 && (neg || uint64(n) >= uint64(1)<<uint(size*8)) {
+					L.ArgError(arg, "unsigned overflow")
+				}
+				if neg {
+					v = uint64(int64(n))
+				} else {
+					v = uint64(n)
+				}
+			}
+			buf = packInteger(buf, v, h.little, size, neg)
+		case packFloat:
+			arg++
+			buf = packInteger(buf, uint64(math.Float32bits(float32(L.CheckNumber(arg)))), h.little, size, false)
+		case packDouble:
+			arg++
+			buf = packInteger(buf, math.Float64bits(float64(L.CheckNumber(arg))), h.little, size, false)
+		case packChar:
+			arg++
+			s := L.CheckString(arg)
+			if len(s) > size {
+				L.ArgError(arg, "string longer than given size")
+			}
+			buf = append(buf, s...)
+			for i := len(s); i < size; i++ {
+				buf = append(buf, 0)
+			}
+		case packString:
+			arg++
+			s := L.CheckString(arg)
+			if size < 8 && uint64(len(s)) >= uint64(1)<<uint(size*8) {
+				L.ArgError(arg, "string length does not fit in given size")
+			}
+			buf = packInteger(buf, uint64(len(s)), h.little, size, false)
+			buf = append(buf, s...)
+		case packZstr:
+			arg++
+			s := L.CheckString(arg)
+			if strings.IndexByte(s, 0) >= 0 {
+				L.ArgError(arg, "string contains zeros")
+			}
+			buf = append(buf, s...)
+			buf = append(buf, 0)
+		case packPadding:
+			buf = append(buf, 0)
+		}
+	}
+	L.Push(LString(string(buf)))
+	return 1
+}
+
+func strPackSize(L *LState) int {
+	h := newPackHeader(L, L.CheckString(1))
+	total := 0
+	for !h.eof() {
+		opt, size, ntoalign := h.details(total)
+		if opt == packString || opt == packZstr {
+			L.ArgError(1, "variable-length format")
+		}
+		size += ntoalign
+		if total > math.MaxInt32-size {
+			L.ArgError(1, "format result too large")
+		}
+		total += size
+	}
+	L.Push(LNumber(total))
+	return 1
+}
+
+func strUnpack(L *LState) int {
+	h := newPackHeader(L, L.CheckString(1))
+	data := L.CheckString(2)
+	ld := len(data)
+	pos := L.OptInt(3, 1)
+	if pos < 0 {
+		pos = ld + pos + 1
+	}
+	pos--
+	if pos < 0 || pos > ld {
+		L.ArgError(3, "initial position out of string")
+	}
+	n := 0
+	for !h.eof() {
+		opt, size, ntoalign := h.details(pos)
+		if ntoalign+size > ld-pos {
+			L.ArgError(2, "data string too short")
+		}
+		pos += ntoalign
+		switch opt {
+		case packInt, packUint:
+			L.Push(unpackInteger(L, data[pos:pos+size], h.little, size, opt == packInt))
+			n++
+		case packFloat:
+			bits := uint32(unpackInteger(L, data[pos:pos+size], h.little, size, false))
+			L.Push(LNumber(math.Float32frombits(bits)))
+			n++
+		case packDouble:
+			var bits uint64
+			for i := size - 1; i >= 0; i-- {
+				bits <<= 8
+				if h.little {
+					bits |= uint64(data[pos+i])
+				} else {
+					bits |= uint64(data[pos+size-1-i])
+				}
+			}
+			L.Push(LNumber(math.Float64frombits(bits)))
+			n++
+		case packChar:
+			L.Push(LString(data[pos : pos+size]))
+			n++
+		case packString:
+			length := int64(unpackInteger(L, data[pos:pos+size], h.little, size, false))
+			if length < 0 || length > int64(ld-pos-size) {
+				L.ArgError(2, "data string too short")
+			}
+			L.Push(LString(data[pos+size : pos+size+int(length)]))
+			pos += int(length)
+			n++
+		case packZstr:
+			end := strings.IndexByte(data[pos:], 0)
+			if end < 0 {
+				L.ArgError(2, "unfinished string for format 'z'")
+			}
+			L.Push(LString(data[pos : pos+end]))
+			pos += end + 1
+			n++
+		}
+		pos += size
+	}
+	L.Push(LNumber(pos + 1))
+	return n + 1
+}
+
+/* }}} */
+
 //
@@ -1,10 +1,16 @@
 package lua
 
-import "strings"
+import (
+	"errors"
+	"strings"
+)
 
 const defaultArrayCap = 32
 const defaultHashCap = 32
 
+// ErrFrozenTable is the error raised when a frozen table is modified.
+var ErrFrozenTable = errors.New("attempt to modify a frozen table")
+
 type lValueArraySorter struct {
 	L      *LState
 	Fn     *LFunction
@@ -66,6 +72,9 @@ func (tb *LTable) Len() int {
 
 // Append appends a given LValue to this LTable.
 func (tb *LTable) Append(value LValue) {
+	if tb.frozen {
+		panic(ErrFrozenTable)
+	}
 	if value == LNil {
 		return
 	}
@@ -87,6 +96,9 @@ func (tb *LTable) Append(value LValue) {
 
 // Insert inserts a given LValue at position `i` in this table.
 func (tb *LTable) Insert(i int, value LValue) {
+	if tb.frozen {
+		panic(ErrFrozenTable)
+	}
 	if tb.array == nil {
 		tb.array = make([]LValue, 0, defaultArrayCap)
 	}
@@ -104,6 +116,11 @@ func (tb *LTable) Insert(i int, value LValue) {
 	tb.array[i] = value
 }
 
+// IsFrozen returns true if this table can not be modified. See LState.Freeze.
+func (tb *LTable) IsFrozen() bool {
+	return tb.frozen
+}
+
 // MaxN returns a maximum number key that nil value does not exist before it.
 func (tb *LTable) MaxN() int {
 	if tb.array == nil {
@@ -119,6 +136,9 @@ func (tb *LTable) MaxN() int {
 
 // Remove removes from this table the element at a given position.
 func (tb *LTable) Remove(pos int) LValue {
+	if tb.frozen {
+		panic(ErrFrozenTable)
+	}
 	if tb.array == nil {
 		return LNil
 	}
@@ -147,6 +167,9 @@ func (tb *LTable) Remove(pos int) LValue {
 // It is recommended to use `RawSetString` or `RawSetInt` for performance
 // if you already know the given LValue is a string or number.
 func (tb *LTable) RawSet(key LValue, value LValue) {
+	if tb.frozen {
+		panic(ErrFrozenTable)
+	}
 	switch v := key.(type) {
 	case LNumber:
 		if isArrayKey(v) {
@@ -178,6 +201,9 @@ func (tb *LTable) RawSet(key LValue, value LValue) {
 
 // RawSetInt sets a given LValue at a position `key` without the __newindex metamethod.
 func (tb *LTable) RawSetInt(key int, value LValue) {
+	if tb.frozen {
+		panic(ErrFrozenTable)
+	}
 	if key < 1 || key >= MaxArrayIndex {
 		tb.RawSetH(LNumber(key), value)
 		return
@@ -202,6 +228,9 @@ func (tb *LTable) RawSetInt(key int, value LValue) {
 
 // RawSetString sets a given LValue to a given string index without the __newindex metamethod.
 func (tb *LTable) RawSetString(key string, value LValue) {
+	if tb.frozen {
+		panic(ErrFrozenTable)
+	}
 	if tb.strdict == nil {
 		tb.strdict = make(map[string]LValue, defaultHashCap)
 	}
@@ -225,6 +254,9 @@ func (tb *LTable) RawSetString(key string, value LValue) {
 
 // RawSetH sets a given LValue to a given index without the __newindex metamethod.
 func (tb *LTable) RawSetH(key LValue, value LValue) {
+	if tb.frozen {
+		panic(ErrFrozenTable)
+	}
 	if s, ok := key.(LString); ok {
 		tb.RawSetString(string(s), value)
 		return
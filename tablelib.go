@@ -11,16 +11,19 @@ func OpenTable(L *LState) int {
 }
 
 var tableFuncs = map[string]LGFunction{
-	"getn":   tableGetN,
-	"concat": tableConcat,
-	"insert": tableInsert,
-	"maxn":   tableMaxN,
-	"remove": tableRemove,
-	"sort":   tableSort,
+	"getn":     tableGetN,
+	"concat":   tableConcat,
+	"insert":   tableInsert,
+	"maxn":     tableMaxN,
+	"remove":   tableRemove,
+	"sort":     tableSort,
+	"freeze":   tableFreeze,
+	"isfrozen": tableIsFrozen,
 }
 
 func tableSort(L *LState) int {
 	tbl := L.CheckTable(1)
+	L.checkFrozen(tbl)
 	sorter := lValueArraySorter{L, nil, tbl.array}
 	if L.GetTop() != 1 {
 		sorter.Fn = L.CheckFunction(2)
@@ -41,6 +44,7 @@ func tableMaxN(L *LState) int {
 
 func tableRemove(L *LState) int {
 	tbl := L.CheckTable(1)
+	L.checkFrozen(tbl)
 	if L.GetTop() == 1 {
 		L.Push(tbl.Remove(-1))
 	} else {
@@ -84,6 +88,7 @@ func tableConcat(L *LState) int {
 
 func tableInsert(L *LState) int {
 	tbl := L.CheckTable(1)
+	L.checkFrozen(tbl)
 	nargs := L.GetTop()
 	if nargs == 1 {
 		L.RaiseError("wrong number of arguments")
@@ -97,4 +102,16 @@ func tableInsert(L *LState) int {
 	return 0
 }
 
+func tableFreeze(L *LState) int {
+	tbl := L.CheckTable(1)
+	L.Freeze(tbl, L.OptBool(2, false))
+	L.Push(tbl)
+	return 1
+}
+
+func tableIsFrozen(L *LState) int {
+	L.Push(LBool(L.CheckTable(1).IsFrozen()))
+	return 1
+}
+
 //
@@ -0,0 +1,205 @@
+package lua
+
+import (
+	"context"
+	"sync"
+)
+
+const lTaskClass = "TASK*"
+
+// luaTask is a Lua function running in its own goroutine and LState.
+type luaTask struct {
+	state   *LState
+	cancel  context.CancelFunc
+	done    chan struct{}
+	mu      sync.Mutex
+	results []LValue
+	err     LValue
+	// errmsg is the message of err, pushed when err can not be copied.
+	errmsg string
+}
+
+func OpenTask(L *LState) int {
+	mod := L.RegisterModule(TaskLibName, taskFuncs)
+	L.SetGlobal("go", L.NewFunction(taskFuncs["spawn"]))
+
+	mt := L.NewTypeMetatable(lTaskClass)
+	mt.RawSetString("__index", mt)
+	L.SetFuncs(mt, taskMethods)
+	L.Push(mod)
+	return 1
+}
+
+// taskFuncs is filled in init, as spawning creates states and opens the libraries,
+// which would make a cycle in the initialization of luaLibs.
+var taskFuncs map[string]LGFunction
+
+func init() {
+	taskFuncs = map[string]LGFunction{
+		"spawn": taskSpawn,
+	}
+}
+
+var taskMethods = map[string]LGFunction{
+	"wait":   taskWait,
+	"cancel": taskCancel,
+	"result": taskResult,
+}
+
+// newTaskState creates the state a task runs in. It is configured like L and has
+// the same preloaded modules.
+func newTaskState(L *LState) *LState {
+	child := NewState(L.Options)
+	src, ok1 := L.GetField(L.GetField(L.Get(GlobalsIndex), "package"), "preload").(*LTable)
+	dst, ok2 := child.GetField(child.GetField(child.Get(GlobalsIndex), "package"), "preload").(*LTable)
+	if ok1 && ok2 {
+		c := newValueCopier(L, child)
+		src.ForEach(func(key, value LValue) {
+			if dst.RawGet(key) != LNil {
+				return
+			}
+			if cv, err := c.copy(value); err == nil {
+				dst.RawSet(key, cv)
+			}
+		})
+	}
+	return child
+}
+
+func checkTask(L *LState) *luaTask {
+	ud := L.CheckUserData(1)
+	if t, ok := ud.Value.(*luaTask); ok {
+		return t
+	}
+	L.ArgError(1, "task expected")
+	return nil
+}
+
+func taskSpawn(L *LState) int {
+	fn := L.CheckFunction(1)
+	child := newTaskState(L)
+	c := newValueCopier(L, child)
+	cfn, err := c.copy(fn)
+	if err != nil {
+		child.Close()
+		L.ArgError(1, err.Error())
+	}
+	child.Push(cfn)
+	top := L.GetTop()
+	for i := 2; i <= top; i++ {
+		v, err := c.copy(L.Get(i))
+		if err != nil {
+			child.Close()
+			L.ArgError(i, err.Error())
+		}
+		child.Push(v)
+	}
+
+	parent := L.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parent)
+	child.SetContext(ctx)
+	t := &luaTask{state: child, cancel: cancel, done: make(chan struct{})}
+
+	go func() {
+		defer close(t.done)
+		defer cancel()
+		if err := child.PCall(top-1, MultRet, nil); err != nil {
+			if aerr, ok := err.(*ApiError); ok {
+				t.err, t.errmsg = aerr.Object, taskErrorString(child, aerr)
+			} else {
+				t.err = LString(err.Error())
+			}
+			if ctx.Err() != nil {
+				t.err = LString(ctx.Err().Error())
+			}
+		} else {
+			for i := 1; i <= child.GetTop(); i++ {
+				t.results = append(t.results, child.Get(i))
+			}
+		}
+		child.Close()
+	}()
+
+	ud := L.NewUserData()
+	ud.Value = t
+	L.SetMetatable(ud, L.GetTypeMetatable(lTaskClass))
+	L.Push(ud)
+	return 1
+}
+
+// taskErrorString returns the message of an error raised by a task: the result of the
+// __tostring metamethod of the error value if it has one, or the message of err.
+func taskErrorString(L *LState, err *ApiError) string {
+	if L.GetMetaField(err.Object, "__tostring") != LNil {
+		if L.CallByParam(P{Fn: L.NewFunction(baseToString), NRet: 1, Protect: true}, err.Object) == nil {
+			return L.ToString(-1)
+		}
+	}
+	return err.Error()
+}
+
+// pushTaskResults pushes true and the results of a finished task, or false and its error.
+func pushTaskResults(L *LState, t *luaTask) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c := newValueCopier(t.state, L)
+	if t.err != nil {
+		L.Push(LFalse)
+		if v, err := c.copy(t.err); err == nil {
+			L.Push(v)
+		} else {
+			L.Push(LString(t.errmsg))
+		}
+		return 2
+	}
+	results := make([]LValue, 0, len(t.results))
+	for _, result := range t.results {
+		v, err := c.copy(result)
+		if err != nil {
+			L.Push(LFalse)
+			L.Push(LString("can not return a value from a task: " + err.Error()))
+			return 2
+		}
+		results = append(results, v)
+	}
+	L.Push(LTrue)
+	for _, v := range results {
+		L.Push(v)
+	}
+	return 1 + len(results)
+}
+
+func taskWait(L *LState) int {
+	t := checkTask(L)
+	if L.ctx != nil {
+		select {
+		case <-t.done:
+		case <-L.ctx.Done():
+			L.Push(LFalse)
+			L.Push(LString(L.ctx.Err().Error()))
+			return 2
+		}
+	} else {
+		<-t.done
+	}
+	return pushTaskResults(L, t)
+}
+
+func taskResult(L *LState) int {
+	t := checkTask(L)
+	select {
+	case <-t.done:
+		return pushTaskResults(L, t)
+	default:
+		L.Push(LNil)
+		return 1
+	}
+}
+
+func taskCancel(L *LState) int {
+	checkTask(L).cancel()
+	return 0
+}
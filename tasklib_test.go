@@ -0,0 +1,84 @@
+package lua
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTaskSpawn(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	errorIfScriptFail(t, L, `
+    local base = 10
+    local conf = {step = 2, list = {1, 2, 3}}
+    conf.self = conf
+    local tk = go(function(n, c)
+      assert(c.self == c)
+      local sum = base
+      for _, v in ipairs(c.list) do
+        sum = sum + v * c.step * n
+      end
+      c.list[1] = 100
+      return sum, string.format("%d", sum), {ok = true}
+    end, 1, conf)
+    local ok, sum, str, tb = tk:wait()
+    assert(ok == true)
+    assert(sum == 22 and str == "22" and tb.ok == true)
+    assert(conf.list[1] == 1)
+    assert(tk:result() == true)
+
+    local tk = task.spawn(function() error("boom") end)
+    local ok, msg = tk:wait()
+    assert(ok == false and string.find(msg, "boom"))
+    local tk = task.spawn(function() error(setmetatable({}, {__tostring = function() return "custom error" end})) end)
+    local ok, msg = tk:wait()
+    assert(ok == false and msg == "custom error")
+
+    local ch = channel.make(1)
+    local tk = go(function(ch)
+      ch:send(go(function() return 1 end) ~= nil)
+      return select(2, go(function(x) return x * 2 end, 21):wait())
+    end, ch)
+    assert(select(2, tk:wait()) == 42)
+    assert(ch:receive() == true)
+    `)
+	errorIfScriptNotFail(t, L, `go(1)`, "function expected")
+	errorIfScriptNotFail(t, L, `go(function() end, setmetatable({}, {}))`, "bad argument #2 to go \\(can not copy a table that has an unregistered metatable\\)")
+	errorIfScriptNotFail(t, L, `local co = coroutine.create(print); go(function() return co end)`, "can not copy a thread")
+}
+
+func TestTaskPreload(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	L.PreloadModule("mymod", func(L *LState) int {
+		mod := L.NewTable()
+		mod.RawSetString("value", LNumber(7))
+		L.Push(mod)
+		return 1
+	})
+	errorIfScriptFail(t, L, `
+    local tk = go(function() return require("mymod").value end)
+    assert(select(2, tk:wait()) == 7)
+    `)
+}
+
+func TestTaskCancel(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	errorIfScriptFail(t, L, `
+    local tk = go(function() while true do end end)
+    assert(tk:result() == nil)
+    tk:cancel()
+    local ok, msg = tk:wait()
+    assert(ok == false and msg == "context canceled")
+    `)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	L.SetContext(ctx)
+	errorIfScriptNotFail(t, L, `
+    local tk = go(function() while true do end end)
+    tk:wait()
+    `, "context deadline exceeded")
+}
@@ -175,6 +175,7 @@ type LTable struct {
 	strdict map[string]LValue
 	keys    []LValue
 	k2i     map[LValue]int
+	frozen  bool
 }
 
 func (tb *LTable) String() string                     { return fmt.Sprintf("table: %p", tb) }
@@ -192,6 +193,12 @@ type LFunction struct {
 }
 
 type LGFunction func(*LState) int
+
+// ContinuationFunc continues a Go function that yielded with LState.YieldK. It is called in
+// the frame of the function when the thread is resumed, with the values passed to resume on
+// the stack, and returns the number of results of the function like an LGFunction.
+type ContinuationFunc func(*LState) int
+
 func (fn *LFunction) String() string                     { return fmt.Sprintf("function: %p", fn) }
 func (fn *LFunction) Type() LValueType                   { return LTFunction }
 func (fn *LFunction) assertFloat64() (float64, bool)     { return 0, false }
@@ -207,6 +214,10 @@ type Global struct {
 	builtinMts map[int]LValue
 	tempFiles  []*os.File
 	gccount    int32
+	reCache    *reCache
+	sched      *Scheduler
+	hub        *Hub
+	meta       map[string]Meta
 }
 
 
@@ -229,6 +240,10 @@ type LState struct {
 	hasErrorFunc bool
 	mainLoop     func(*LState, *callFrame)
 	ctx          context.Context
+	nestedCalls  int
+	yieldK       ContinuationFunc
+	onResume     func() int
+	errorObject  LValue
 
 	ExData       ExData
 
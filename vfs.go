@@ -0,0 +1,177 @@
+package lua
+
+import (
+	"archive/zip"
+	"embed"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// WritableFS is a filesystem that can open files for writing. It may be used as Options.FS
+// so that io.open can create and modify files.
+type WritableFS interface {
+	fs.FS
+	// OpenFile opens the named file with the flags of os.OpenFile.
+	OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error)
+}
+
+// WritableFile is a file opened by a WritableFS. Files that implement io.Seeker can be seeked
+// with file:seek.
+type WritableFile interface {
+	fs.File
+	io.Writer
+}
+
+// fsName converts a path of the OS or of a script into a name of an fs.FS.
+func fsName(name string) string {
+	name = strings.TrimLeft(path.Clean(filepath.ToSlash(name)), "/")
+	if len(name) == 0 {
+		return "."
+	}
+	return name
+}
+
+// openFS opens a file of Options.FS, or of the OS filesystem if FS is nil.
+func (ls *LState) openFS(name string, flag int, perm fs.FileMode) (fs.File, error) {
+	fsys := ls.Options.FS
+	if fsys == nil {
+		return os.OpenFile(name, flag, perm)
+	}
+	if flag == os.O_RDONLY {
+		return fsys.Open(fsName(name))
+	}
+	if wfs, ok := fsys.(WritableFS); ok {
+		return wfs.OpenFile(fsName(name), flag, perm)
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+}
+
+// statFS returns the FileInfo of a file of Options.FS, or of the OS filesystem if FS is nil.
+func (ls *LState) statFS(name string) (fs.FileInfo, error) {
+	if ls.Options.FS == nil {
+		return os.Stat(name)
+	}
+	return fs.Stat(ls.Options.FS, fsName(name))
+}
+
+type dirFS string
+
+// DirFS returns a writable filesystem for the tree of files rooted at the directory dir.
+func DirFS(dir string) WritableFS {
+	return dirFS(dir)
+}
+
+func (dir dirFS) join(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(string(dir), filepath.FromSlash(name)), nil
+}
+
+func (dir dirFS) Open(name string) (fs.File, error) {
+	fullname, err := dir.join("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(fullname)
+}
+
+func (dir dirFS) OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error) {
+	fullname, err := dir.join("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.OpenFile(fullname, flag, perm)
+}
+
+// EmbedFS returns the subtree of an embedded filesystem rooted at dir, so that scripts
+// embedded with a directory pattern can be loaded by their path relative to that directory.
+func EmbedFS(efs embed.FS, dir string) (fs.FS, error) {
+	if dir == "" || dir == "." {
+		return efs, nil
+	}
+	return fs.Sub(efs, dir)
+}
+
+// ZipFS returns a read-only filesystem for the zip archive read from r.
+func ZipFS(r io.ReaderAt, size int64) (fs.FS, error) {
+	return zip.NewReader(r, size)
+}
+
+// OpenZipFS opens the zip archive name as a read-only filesystem. The archive must be closed
+// when it is no longer used.
+func OpenZipFS(name string) (*zip.ReadCloser, error) {
+	return zip.OpenReader(name)
+}
+
+type overlayFS []fs.FS
+
+// OverlayFS returns a filesystem that looks up files in layers in order, so that files of a
+// layer hide the files of the same name in the layers that follow. Directories list the
+// entries of every layer. Files opened for writing are opened in the first layer, which must
+// implement WritableFS.
+func OverlayFS(layers ...fs.FS) WritableFS {
+	return overlayFS(layers)
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	var firstErr error
+	for _, layer := range o {
+		f, err := layer.Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr == nil {
+		firstErr = &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return nil, firstErr
+}
+
+func (o overlayFS) OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error) {
+	if len(o) > 0 {
+		if wfs, ok := o[0].(WritableFS); ok {
+			return wfs.OpenFile(name, flag, perm)
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+}
+
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	var entries []fs.DirEntry
+	seen := map[string]bool{}
+	found := false
+	for _, layer := range o {
+		list, err := fs.ReadDir(layer, name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		found = true
+		for _, entry := range list {
+			if !seen[entry.Name()] {
+				seen[entry.Name()] = true
+				entries = append(entries, entry)
+			}
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
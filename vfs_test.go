@@ -0,0 +1,96 @@
+package lua
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFSLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.lua":       {Data: []byte("#!/usr/bin/env glua\nreturn require('lib.util').double(21)")},
+		"lib/util.lua":   {Data: []byte("return {double = function(x) return x * 2 end}")},
+		"scripts/a.lua":  {Data: []byte("return ...")},
+		"scripts/do.lua": {Data: []byte("return 'done'")},
+	}
+	L := NewState(Options{FS: fsys})
+	defer L.Close()
+	L.SetField(L.GetField(L.Get(GlobalsIndex), "package"), "path", LString("./?.lua"))
+
+	errorIfNotNil(t, L.DoFile("/main.lua"))
+	errorIfNotEqual(t, LNumber(42), L.Get(-1))
+	errorIfScriptFail(t, L, `
+    assert(loadfile("scripts/a.lua")(7) == 7)
+    assert(dofile("./scripts/do.lua") == "done")
+    local ok, err = pcall(require, "missing")
+    assert(not ok and string.find(err, "missing.lua", 1, true))
+    `)
+
+	_, err := L.LoadFile("nothing.lua")
+	errorIfFalse(t, errors.Is(err, fs.ErrNotExist), "error must wrap fs.ErrNotExist: %v", err)
+}
+
+func TestFSZip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("mod/hello.lua")
+	errorIfNotNil(t, err)
+	w.Write([]byte("return 'hello from zip'"))
+	errorIfNotNil(t, zw.Close())
+
+	fsys, err := ZipFS(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	errorIfNotNil(t, err)
+	L := NewState(Options{FS: fsys})
+	defer L.Close()
+	L.SetField(L.GetField(L.Get(GlobalsIndex), "package"), "path", LString("?.lua"))
+	errorIfScriptFail(t, L, `assert(require("mod.hello") == "hello from zip")`)
+}
+
+func TestFSOverlayIO(t *testing.T) {
+	dir := t.TempDir()
+	errorIfNotNil(t, os.WriteFile(filepath.Join(dir, "conf.txt"), []byte("upper\n"), 0600))
+	base := fstest.MapFS{
+		"conf.txt": {Data: []byte("lower\n")},
+		"data.txt": {Data: []byte("1\n2\n3\n")},
+	}
+	fsys := OverlayFS(DirFS(dir), base)
+
+	entries, err := fs.ReadDir(fsys, ".")
+	errorIfNotNil(t, err)
+	errorIfNotEqual(t, 2, len(entries))
+
+	L := NewState(Options{FS: fsys, FSForIO: true})
+	defer L.Close()
+	errorIfScriptFail(t, L, `
+    assert(io.open("conf.txt"):read("*l") == "upper")
+    local sum = 0
+    for line in io.lines("data.txt") do sum = sum + tonumber(line) end
+    assert(sum == 6)
+
+    local f = assert(io.open("out.txt", "w"))
+    f:write("written")
+    f:close()
+    assert(io.open("/out.txt"):read("*a") == "written")
+    local f, err = io.open("none.txt")
+    assert(f == nil and string.find(err, "none.txt", 1, true))
+    `)
+	data, err := os.ReadFile(filepath.Join(dir, "out.txt"))
+	errorIfNotNil(t, err)
+	errorIfNotEqual(t, "written", string(data))
+
+	L = NewState(Options{FS: base, FSForIO: true})
+	defer L.Close()
+	errorIfScriptFail(t, L, `
+    local f, err = io.open("new.txt", "w")
+    assert(f == nil and string.find(err, "permission denied", 1, true))
+    local f = assert(io.open("data.txt"))
+    local ok, err = f:setvbuf("full", 64)
+    assert(ok == nil and string.find(err, "only reading", 1, true))
+    f:close()
+    `)
+}
@@ -54,7 +54,7 @@ func mainLoopWithContext(L *LState, baseframe *callFrame) {
 		cf.Pc++
 		select {
 		case <-L.ctx.Done():
-			L.RaiseError(L.ctx.Err().Error())
+			L.RaiseErrorWrap(L.ctx.Err())
 			return
 		default:
 			if jumpTable[int(inst>>26)](L, inst, baseframe) == 1 {
@@ -205,7 +205,7 @@ func callGFunction(L *LState, tailcall bool) bool {
 	}
 
 	if gfnret < 0 {
-		switchToParentThread(L, L.GetTop(), false, false)
+		yieldGFunction(L)
 		return true
 	}
 
@@ -269,18 +269,56 @@ func threadRun(L *LState) {
 		return
 	}
 
+	L.nestedCalls = 0
+	resume := func() int { return 0 }
+	if L.onResume != nil {
+		resume = L.onResume
+		L.onResume = nil
+	}
+	for resume != nil {
+		resume = threadExec(L, resume)
+	}
+}
+
+// threadExec calls resume, then runs the main loop unless resume reports that the thread yielded
+// or finished. If an error is caught by a protected call whose Go function was unwound by a yield,
+// threadExec returns the function that finishes that call.
+func threadExec(L *LState, resume func() int) (next func() int) {
 	defer func() {
 		if rcv := recover(); rcv != nil {
+			if _, ok := rcv.(yieldUnwind); ok {
+				next = nil
+				return
+			}
 			var lv LValue
+			trace := ""
+			var frames []StackFrame
 			if v, ok := rcv.(*ApiError); ok {
 				lv = v.Object
+				trace = v.StackTrace
+				frames = v.Frames
 			} else {
 				lv = LString(fmt.Sprint(rcv))
 			}
 			if parent := L.Parent; parent != nil {
+				if frame := L.protectedFrame(); frame != nil {
+					L.nestedCalls = 0
+					next = func() int { return catchError(L, frame, lv) }
+					return
+				}
+				L.errorObject = lv
 				if L.wrapped {
-					L.Push(lv)
-					parent.Panic(L)
+					if len(trace) == 0 {
+						trace = L.stackTrace(0)
+						frames = L.stackFrames()
+					}
+					err := newApiError(ApiErrorRun, lv)
+					err.StackTrace = trace + "\n" + strings.TrimPrefix(parent.stackTrace(0), "stack traceback:\n")
+					err.Frames = append(frames, parent.stackFrames()...)
+					L.G.CurrentThread = parent
+					L.Parent = nil
+					L.kill()
+					panic(err)
 				} else {
 					L.SetTop(0)
 					L.Push(lv)
@@ -289,9 +327,250 @@ func threadRun(L *LState) {
 			} else {
 				panic(rcv)
 			}
+			next = nil
 		}
 	}()
-	L.mainLoop(L, nil)
+	if resume() == 0 {
+		L.mainLoop(L, nil)
+	}
+	return nil
+}
+
+// yieldUnwind is panicked by a coroutine that yields while Go functions are calling Lua
+// functions, to unwind the Go stack up to threadRun.
+type yieldUnwind struct{}
+
+// continuation finishes a Go function frame whose call to a Lua function was unwound by a
+// yield, once the Lua function returns.
+type continuation struct {
+	// k is called in the frame with the results of the Lua function on top of the stack.
+	// It returns the number of results of the frame, like an LGFunction.
+	k ContinuationFunc
+	// protected is true if the frame catches the errors raised above it, as pcall does.
+	protected bool
+	// errfunc is the index of the error handler in the frame, or 0 if there is none.
+	errfunc int
+	// base is the number of values of the frame kept below false and the error object when
+	// an error is caught.
+	base int
+}
+
+// yieldGFunction suspends the coroutine after the Go function of the current frame returned -1.
+// If Go functions, such as pcall or the VM instructions that call metamethods, are waiting on
+// Lua functions, their Go calls are unwound and their frames are finished by finishCall once
+// the Lua functions return.
+func yieldGFunction(L *LState) {
+	k := L.yieldK
+	L.yieldK = nil
+	parent := L.Parent
+	if parent == nil {
+		L.RaiseError("can not yield from outside of a coroutine")
+	}
+	if L.nestedCalls > 0 && !L.canYield() {
+		L.RaiseError("attempt to yield across metamethod/C-call boundary")
+	}
+	if frame := L.currentFrame; k != nil {
+		// the frame stays on the stack, k is called in it with the values passed to resume
+		L.onResume = func() int { return continueGFunction(L, k) }
+		L.G.CurrentThread = parent
+		L.Parent = nil
+		if !L.wrapped {
+			parent.Push(LTrue)
+		}
+		L.XMoveTo(parent, L.GetTop())
+	} else {
+		if frame.Nested {
+			// the values passed to resume are the results of the frame, its caller is finished with them
+			rbase, nret := frame.ReturnBase, frame.NRet
+			L.onResume = func() int { return finishCall(L, rbase, nret) }
+		}
+		switchToParentThread(L, L.GetTop(), false, false)
+	}
+	if L.nestedCalls > 0 {
+		panic(yieldUnwind{})
+	}
+}
+
+// continueGFunction calls the continuation k of the current Go function frame and returns its
+// results. It returns 1 if the thread yielded or finished.
+func continueGFunction(L *LState, k ContinuationFunc) int {
+	n := k(L)
+	if n < 0 {
+		yieldGFunction(L)
+		return 1
+	}
+	return returnGFrame(L, n)
+}
+
+// canYield reports whether the running thread is a coroutine that can yield, that is whether
+// every frame waiting on a Go call into Lua can be finished after the Go call is unwound.
+func (ls *LState) canYield() bool {
+	if ls.Parent == nil {
+		return false
+	}
+	for i := ls.stack.Sp() - 1; i > 0; i-- {
+		if !ls.stack.At(i).Nested {
+			continue
+		}
+		caller := ls.stack.At(i - 1)
+		if caller.Fn.IsG {
+			if caller.Cont == nil {
+				return false
+			}
+		} else if !canFinishOp(caller) {
+			return false
+		}
+	}
+	return true
+}
+
+// protectedFrame returns the innermost frame that catches errors because its Go call was
+// unwound by a yield.
+func (ls *LState) protectedFrame() *callFrame {
+	for i := ls.stack.Sp() - 1; i >= 0; i-- {
+		if frame := ls.stack.At(i); frame.Cont != nil && frame.Cont.protected {
+			return frame
+		}
+	}
+	return nil
+}
+
+// finishCall finishes the current frame, whose Go call into Lua was unwound by a yield, once
+// the called function has returned its results at rbase. It returns 1 if the thread yielded
+// or finished.
+func finishCall(L *LState, rbase, nret int) int {
+	if nret != MultRet {
+		L.reg.SetTop(rbase + nret)
+	}
+	cf := L.currentFrame
+	if !cf.Fn.IsG {
+		finishOp(L, cf, rbase)
+		return 0
+	}
+	return continueGFunction(L, cf.Cont.k)
+}
+
+// returnGFrame returns the n values on top of the stack from the current Go function frame.
+// It returns 1 if the thread yielded or finished.
+func returnGFrame(L *LState, n int) int {
+	frame := L.currentFrame
+	if L.Parent != nil && L.stack.Sp() == 1 {
+		switchToParentThread(L, n, false, true)
+		return 1
+	}
+	rbase, nret := frame.ReturnBase, frame.NRet
+	if parent := frame.Parent; parent != nil && !parent.Fn.IsG && int(parent.Fn.Proto.Code[parent.Pc-1]>>26) == OP_TAILCALL {
+		// the frame was tail called, its results are returned by the OP_RETURN that follows
+		rbase, nret = frame.Base, MultRet
+	}
+	wantret := nret
+	if wantret == MultRet {
+		wantret = n
+	}
+	L.reg.CopyRange(rbase, L.reg.Top()-n, -1, wantret)
+	L.stack.Pop()
+	L.currentFrame = L.stack.Last()
+	if frame.Nested {
+		return finishCall(L, rbase, nret)
+	}
+	return 0
+}
+
+// catchError finishes a protected frame whose Go call was unwound by a yield with false and
+// the error object lv, as pcall and xpcall do.
+func catchError(L *LState, frame *callFrame, lv LValue) int {
+	if frame.Cont.errfunc > 0 {
+		L.reg.Push(L.reg.Get(frame.LocalBase + frame.Cont.errfunc - 1))
+		L.reg.Push(lv)
+		if err := L.PCall(1, 1, nil); err != nil {
+			lv = err.(*ApiError).Object
+		} else {
+			lv = L.reg.Pop()
+		}
+	}
+	L.stack.SetSp(frame.Idx + 1)
+	L.currentFrame = frame
+	L.reg.SetTop(frame.LocalBase + frame.Cont.base)
+	L.reg.Push(LFalse)
+	L.reg.Push(lv)
+	return returnGFrame(L, 2)
+}
+
+// canFinishOp reports whether finishOp can complete the instruction that cf is executing.
+func canFinishOp(cf *callFrame) bool {
+	switch int(cf.Fn.Proto.Code[cf.Pc-1] >> 26) {
+	case OP_GETGLOBAL, OP_GETTABLE, OP_GETTABLEKS, OP_SELF,
+		OP_SETGLOBAL, OP_SETTABLE, OP_SETTABLEKS,
+		OP_ADD, OP_SUB, OP_MUL, OP_DIV, OP_MOD, OP_POW, OP_UNM, OP_LEN,
+		OP_EQ, OP_LT, OP_LE, OP_CONCAT, OP_TFORLOOP:
+		return true
+	}
+	return false
+}
+
+// finishOp completes the instruction of a Lua frame that called a metamethod or an iterator,
+// once the function it called returns its result at rbase.
+func finishOp(L *LState, cf *callFrame, rbase int) {
+	reg := L.reg
+	inst := cf.Fn.Proto.Code[cf.Pc-1]
+	lbase := cf.LocalBase
+	A := int(inst>>18) & 0xff //GETA
+	RA := lbase + A
+	B := int(inst & 0x1ff)    //GETB
+	C := int(inst>>9) & 0x1ff //GETC
+	ret := reg.Get(rbase)
+	opcode := int(inst >> 26)
+	if opcode == OP_TFORLOOP {
+		if ret != LNil {
+			reg.Set(RA+2, ret)
+			pc := cf.Fn.Proto.Code[cf.Pc]
+			cf.Pc += int(pc&0x3ffff) - opMaxArgSbx
+		}
+		cf.Pc++
+		return
+	}
+	selfobj := reg.Get(lbase + B)
+	// pop the result before setting RA, which may be the same register
+	reg.SetTop(rbase)
+	switch opcode {
+	case OP_SELF:
+		reg.Set(RA+1, selfobj)
+		reg.Set(RA, ret)
+	case OP_GETGLOBAL, OP_GETTABLE, OP_GETTABLEKS, OP_ADD, OP_SUB, OP_MUL, OP_DIV, OP_MOD, OP_POW, OP_UNM:
+		reg.Set(RA, ret)
+	case OP_CONCAT:
+		// the metamethod was called on the operands at rbase-2 and rbase-1, the ones
+		// below them are left to concatenate with its result
+		last := rbase - 2
+		reg.SetTop(lbase + int(cf.Fn.Proto.NumUsedRegisters))
+		reg.Set(last, ret)
+		if total := last - (lbase + B) + 1; total > 1 {
+			ret = stringConcat(L, total, last)
+		}
+		reg.Set(RA, ret)
+	case OP_LEN:
+		if nm, ok := ret.(LNumber); ok {
+			reg.SetNumber(RA, nm)
+		} else {
+			reg.SetNumber(RA, LNumber(0))
+		}
+	case OP_EQ, OP_LT, OP_LE:
+		cond := LVAsBool(ret)
+		if opcode == OP_LE {
+			lhs, rhs := L.rkValue(B), L.rkValue(C)
+			if m := L.metaOp1(lhs, "__le"); m.Type() != LTFunction || m != L.metaOp1(rhs, "__le") {
+				// a <= b was computed as not (b < a)
+				cond = !cond
+			}
+		}
+		v := 1
+		if cond {
+			v = 0
+		}
+		if v == A {
+			cf.Pc++
+		}
+	}
 }
 
 type instFunc func(*LState, uint32, *callFrame) int
@@ -879,6 +1158,7 @@ func init() {
 			}
 			if callable.IsG {
 				luaframe := cf
+				nested, rbase, nret := cf.Nested, cf.ReturnBase, cf.NRet
 				L.pushCallFrame(callFrame{
 					Fn:         callable,
 					Pc:         0,
@@ -893,6 +1173,10 @@ func init() {
 				if callGFunction(L, true) {
 					return 1
 				}
+				if nested && luaframe != baseframe {
+					// the Go function that called this frame was unwound by a yield
+					return finishCall(L, rbase, nret)
+				}
 				if L.currentFrame == nil || L.currentFrame.Fn.IsG || luaframe == baseframe {
 					return 1
 				}
@@ -1304,6 +1588,10 @@ func init() {
 				}
 			}
 			L.currentFrame = L.stack.Last()
+			if cf.Nested && !islast {
+				// the Go function that called this frame was unwound by a yield
+				return finishCall(L, cf.ReturnBase, cf.NRet)
+			}
 			if islast || L.currentFrame == nil || L.currentFrame.Fn.IsG {
 				return 1
 			}
@@ -1620,11 +1908,16 @@ func stringConcat(L *LState, total, last int) LValue {
 		if !(LVCanConvToString(lhs) && LVCanConvToString(rhs)) {
 			op := L.metaOp2(lhs, rhs, "__concat")
 			if op.Type() == LTFunction {
+				// the metamethod is called right above the operands, finishOp finds them
+				// from its position if it yields
+				top := L.reg.Top()
+				L.reg.SetTop(i + 2)
 				L.reg.Push(op)
 				L.reg.Push(lhs)
 				L.reg.Push(rhs)
 				L.Call(2, 1)
 				rhs = L.reg.Pop()
+				L.reg.SetTop(top)
 				total--
 				i--
 			} else {